@@ -0,0 +1,242 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/compose"
+	"github.com/cloudwego/eino/schema"
+	"github.com/pawarison/eino-multi-modal-poc/tools"
+)
+
+// ReactConfig controls the tool-calling loop.
+type ReactConfig struct {
+	// MaxIterations caps model calls that may request tools before a final answer is forced.
+	MaxIterations int `envconfig:"AGENT_MAX_ITERATIONS" default:"5"`
+}
+
+// Input is the context of the response stage: the persona system prompt, the
+// resolved intent and slots, and the conversation so far (ending with the user turn).
+type Input struct {
+	SystemPrompt string
+	Intent       string
+	Slots        map[string]string
+	History      []*schema.Message
+}
+
+// Observation is the result of one tool call. Error is set instead of failing
+// the run so the model can see the problem and recover.
+type Observation struct {
+	ToolCallID string        `json:"tool_call_id"`
+	Tool       string        `json:"tool"`
+	Arguments  string        `json:"arguments"`
+	Output     string        `json:"output,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	Duration   time.Duration `json:"duration"`
+}
+
+// Step is one model call and the tool calls it requested.
+type Step struct {
+	Iteration    int           `json:"iteration"`
+	Thought      string        `json:"thought,omitempty"`
+	Observations []Observation `json:"observations,omitempty"`
+}
+
+// Result is the final answer plus the step trace.
+type Result struct {
+	Message *schema.Message
+	Steps   []Step
+	// Exhausted is true when MaxIterations was reached and the answer was forced.
+	Exhausted bool
+}
+
+// ReactAgent answers with the chat model, calling bound tools in a loop.
+type ReactAgent struct {
+	cfg      ReactConfig
+	base     model.ToolCallingChatModel
+	registry *tools.Registry
+	bound    *toolBinding
+}
+
+// toolBinding is a chat model with a set of tools bound to it.
+type toolBinding struct {
+	model model.ToolCallingChatModel
+	tools map[string]tool.InvokableTool
+}
+
+// NewReactAgent binds a fixed set of tools to chatModel. Tools that are not invokable are rejected.
+func NewReactAgent(ctx context.Context, chatModel model.ToolCallingChatModel, agentTools []tool.BaseTool, cfg *ReactConfig) (*ReactAgent, error) {
+	if err := validate(chatModel, cfg); err != nil {
+		return nil, err
+	}
+	bound, err := bind(ctx, chatModel, agentTools)
+	if err != nil {
+		return nil, err
+	}
+	return &ReactAgent{cfg: *cfg, base: chatModel, bound: bound}, nil
+}
+
+// NewRegistryAgent binds the registry's tools for each run's intent, so every
+// intent only sees the tools the registry exposes for it.
+func NewRegistryAgent(chatModel model.ToolCallingChatModel, registry *tools.Registry, cfg *ReactConfig) (*ReactAgent, error) {
+	if err := validate(chatModel, cfg); err != nil {
+		return nil, err
+	}
+	if registry == nil {
+		return nil, fmt.Errorf("tool registry is nil")
+	}
+	return &ReactAgent{cfg: *cfg, base: chatModel, registry: registry}, nil
+}
+
+func validate(chatModel model.ToolCallingChatModel, cfg *ReactConfig) error {
+	if chatModel == nil {
+		return fmt.Errorf("chat model is nil")
+	}
+	if cfg == nil {
+		return fmt.Errorf("react config is nil")
+	}
+	if cfg.MaxIterations <= 0 {
+		return fmt.Errorf("invalid max iterations: %d", cfg.MaxIterations)
+	}
+	return nil
+}
+
+func bind(ctx context.Context, chatModel model.ToolCallingChatModel, agentTools []tool.BaseTool) (*toolBinding, error) {
+	infos, err := tools.GetToolInfos(ctx, agentTools)
+	if err != nil {
+		return nil, fmt.Errorf("get tool infos: %w", err)
+	}
+	byName := make(map[string]tool.InvokableTool, len(agentTools))
+	for i, t := range agentTools {
+		inv, ok := t.(tool.InvokableTool)
+		if !ok {
+			return nil, fmt.Errorf("tool %s is not invokable", infos[i].Name)
+		}
+		byName[infos[i].Name] = inv
+	}
+
+	bound := chatModel
+	if len(infos) > 0 {
+		bound, err = chatModel.WithTools(infos)
+		if err != nil {
+			return nil, fmt.Errorf("bind tools: %w", err)
+		}
+	}
+	return &toolBinding{model: bound, tools: byName}, nil
+}
+
+// Run executes the ReAct loop: call the model, run any requested tools, feed
+// their observations back, and repeat until the model answers without tool
+// calls or MaxIterations is reached.
+func (a *ReactAgent) Run(ctx context.Context, in *Input) (*Result, error) {
+	if in == nil {
+		return nil, fmt.Errorf("agent input is nil")
+	}
+	msgs := make([]*schema.Message, 0, len(in.History)+1)
+	msgs = append(msgs, schema.SystemMessage(buildSystemPrompt(in)))
+	for _, m := range in.History {
+		if m != nil && m.Role != schema.System {
+			msgs = append(msgs, m)
+		}
+	}
+
+	binding := a.bound
+	if a.registry != nil {
+		var err error
+		binding, err = bind(ctx, a.base, a.registry.ToolsForIntent(in.Intent))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	res := &Result{}
+	for i := 1; i <= a.cfg.MaxIterations; i++ {
+		out, err := binding.model.Generate(ctx, msgs)
+		if err != nil {
+			return nil, fmt.Errorf("iteration %d: generate: %w", i, err)
+		}
+		if out == nil {
+			return nil, fmt.Errorf("iteration %d: generate: empty response", i)
+		}
+		msgs = append(msgs, out)
+
+		step := Step{Iteration: i, Thought: strings.TrimSpace(out.Content)}
+		if len(out.ToolCalls) == 0 {
+			res.Steps = append(res.Steps, step)
+			res.Message = out
+			return res, nil
+		}
+		for _, call := range out.ToolCalls {
+			obs := invoke(ctx, binding.tools, call)
+			step.Observations = append(step.Observations, obs)
+			content := obs.Output
+			if obs.Error != "" {
+				content = "error: " + obs.Error
+			}
+			msgs = append(msgs, schema.ToolMessage(content, call.ID, schema.WithToolName(call.Function.Name)))
+		}
+		res.Steps = append(res.Steps, step)
+	}
+
+	// Out of iterations: ask the unbound model for an answer from what it has.
+	msgs = append(msgs, schema.UserMessage("Tool call limit reached. Answer the user now using only the information above."))
+	out, err := a.base.Generate(ctx, msgs)
+	if err != nil {
+		return nil, fmt.Errorf("final answer: %w", err)
+	}
+	res.Message = out
+	res.Exhausted = true
+	return res, nil
+}
+
+// Lambda wraps the agent as an eino graph node.
+func (a *ReactAgent) Lambda() *compose.Lambda {
+	return compose.InvokableLambda(a.Run)
+}
+
+func invoke(ctx context.Context, available map[string]tool.InvokableTool, call schema.ToolCall) Observation {
+	obs := Observation{
+		ToolCallID: call.ID,
+		Tool:       call.Function.Name,
+		Arguments:  call.Function.Arguments,
+	}
+	t, ok := available[call.Function.Name]
+	if !ok {
+		obs.Error = fmt.Sprintf("unknown tool %q", call.Function.Name)
+		return obs
+	}
+	start := time.Now()
+	out, err := t.InvokableRun(ctx, call.Function.Arguments)
+	obs.Duration = time.Since(start)
+	if err != nil {
+		obs.Error = err.Error()
+		return obs
+	}
+	obs.Output = out
+	return obs
+}
+
+// buildSystemPrompt appends the NLU result to the persona prompt.
+func buildSystemPrompt(in *Input) string {
+	var b strings.Builder
+	b.WriteString(strings.TrimSpace(in.SystemPrompt))
+	b.WriteString("\n<dialogue_context>\n")
+	fmt.Fprintf(&b, "  <intent>%s</intent>\n", in.Intent)
+	keys := make([]string, 0, len(in.Slots))
+	for k := range in.Slots {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	b.WriteString("  <slots>\n")
+	for _, k := range keys {
+		fmt.Fprintf(&b, "    <slot name=%q>%s</slot>\n", k, in.Slots[k])
+	}
+	b.WriteString("  </slots>\n")
+	b.WriteString("</dialogue_context>")
+	return b.String()
+}
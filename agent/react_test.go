@@ -0,0 +1,219 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+	"github.com/pawarison/eino-multi-modal-poc/llm"
+	"github.com/pawarison/eino-multi-modal-poc/tools"
+)
+
+// stubTool answers every call with output or fails with err.
+type stubTool struct {
+	name   string
+	output string
+	err    error
+}
+
+func (s stubTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{Name: s.name, Desc: s.name}, nil
+}
+
+func (s stubTool) InvokableRun(ctx context.Context, args string, opts ...tool.Option) (string, error) {
+	if s.err != nil {
+		return "", s.err
+	}
+	return s.output + " " + args, nil
+}
+
+func call(id, name, args string) schema.ToolCall {
+	return schema.ToolCall{ID: id, Function: schema.FunctionCall{Name: name, Arguments: args}}
+}
+
+func toolNames(infos []*schema.ToolInfo) []string {
+	names := []string{}
+	for _, info := range infos {
+		names = append(names, info.Name)
+	}
+	return names
+}
+
+func testInput() *Input {
+	return &Input{
+		SystemPrompt: "You are a shop assistant.",
+		Intent:       "search_intent",
+		Slots:        map[string]string{"product": "iPhone"},
+		History: []*schema.Message{
+			schema.SystemMessage("dropped"),
+			schema.UserMessage("find me a phone"),
+		},
+	}
+}
+
+func TestRunToolLoop(t *testing.T) {
+	ctx := context.Background()
+	var inputs [][]*schema.Message
+	chatModel := llm.NewToolFake(func(input []*schema.Message, bound []*schema.ToolInfo) (*schema.Message, error) {
+		inputs = append(inputs, input)
+		if got := toolNames(bound); !reflect.DeepEqual(got, []string{"lookup", "broken"}) {
+			t.Errorf("bound tools = %v", got)
+		}
+		if len(inputs) == 1 {
+			return schema.AssistantMessage("let me check", []schema.ToolCall{
+				call("c1", "lookup", `{"q":"phone"}`),
+				call("c2", "missing", `{}`),
+				call("c3", "broken", `{}`),
+			}), nil
+		}
+		return schema.AssistantMessage("Here is the phone.", nil), nil
+	})
+	a, err := NewReactAgent(ctx, chatModel, []tool.BaseTool{
+		stubTool{name: "lookup", output: "found"},
+		stubTool{name: "broken", err: errors.New("backend down")},
+	}, &ReactConfig{MaxIterations: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := a.Run(ctx, testInput())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Message.Content != "Here is the phone." || res.Exhausted || chatModel.Calls() != 2 {
+		t.Fatalf("result = %+v after %d calls", res, chatModel.Calls())
+	}
+
+	first := inputs[0]
+	if len(first) != 2 || first[0].Role != schema.System || first[1].Content != "find me a phone" {
+		t.Fatalf("first input = %v", first)
+	}
+	if !strings.Contains(first[0].Content, "<intent>search_intent</intent>") || !strings.Contains(first[0].Content, `<slot name="product">iPhone</slot>`) {
+		t.Errorf("system prompt = %q", first[0].Content)
+	}
+
+	// the second call sees the assistant turn and one tool message per call, in order
+	second := inputs[1]
+	if len(second) != 6 || second[2].Role != schema.Assistant {
+		t.Fatalf("second input = %v", second)
+	}
+	wantTools := []struct{ id, name, content string }{
+		{"c1", "lookup", `found {"q":"phone"}`},
+		{"c2", "missing", `error: unknown tool "missing"`},
+		{"c3", "broken", "error: backend down"},
+	}
+	for i, want := range wantTools {
+		m := second[3+i]
+		if m.Role != schema.Tool || m.ToolCallID != want.id || m.ToolName != want.name || m.Content != want.content {
+			t.Errorf("tool message %d = %+v, want %+v", i, m, want)
+		}
+	}
+
+	if len(res.Steps) != 2 || res.Steps[0].Thought != "let me check" || len(res.Steps[1].Observations) != 0 {
+		t.Fatalf("steps = %+v", res.Steps)
+	}
+	obs := res.Steps[0].Observations
+	if len(obs) != 3 || obs[0].Output != `found {"q":"phone"}` || obs[0].Error != "" ||
+		obs[1].Error != `unknown tool "missing"` || obs[2].Error != "backend down" || obs[2].Output != "" {
+		t.Errorf("observations = %+v", obs)
+	}
+}
+
+func TestRunMaxIterations(t *testing.T) {
+	ctx := context.Background()
+	var last []*schema.Message
+	chatModel := llm.NewToolFake(func(input []*schema.Message, bound []*schema.ToolInfo) (*schema.Message, error) {
+		last = input
+		if len(bound) == 0 {
+			return schema.AssistantMessage("best effort", nil), nil
+		}
+		return schema.AssistantMessage("", []schema.ToolCall{call("c", "lookup", "{}")}), nil
+	})
+	a, err := NewReactAgent(ctx, chatModel, []tool.BaseTool{stubTool{name: "lookup", output: "found"}}, &ReactConfig{MaxIterations: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := a.Run(ctx, testInput())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Exhausted || res.Message.Content != "best effort" || chatModel.Calls() != 3 {
+		t.Fatalf("result = %+v after %d calls", res, chatModel.Calls())
+	}
+	if len(res.Steps) != 2 || res.Steps[1].Iteration != 2 || len(res.Steps[1].Observations) != 1 {
+		t.Errorf("steps = %+v", res.Steps)
+	}
+	if m := last[len(last)-1]; m.Role != schema.User || !strings.Contains(m.Content, "Tool call limit reached") {
+		t.Errorf("final prompt = %+v", m)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	ctx := context.Background()
+	looping := func(final error) *llm.Fake {
+		return llm.NewToolFake(func(_ []*schema.Message, bound []*schema.ToolInfo) (*schema.Message, error) {
+			if len(bound) == 0 {
+				return nil, final
+			}
+			return schema.AssistantMessage("", []schema.ToolCall{call("c", "lookup", "{}")}), nil
+		})
+	}
+	tests := map[string]struct {
+		model *llm.Fake
+		want  string
+	}{
+		"generate":     {llm.NewFake(func([]*schema.Message) (string, error) { return "", errors.New("quota") }), "iteration 1: generate: quota"},
+		"final answer": {looping(errors.New("quota")), "final answer: quota"},
+	}
+	for name, tt := range tests {
+		a, err := NewReactAgent(ctx, tt.model, []tool.BaseTool{stubTool{name: "lookup"}}, &ReactConfig{MaxIterations: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := a.Run(ctx, testInput()); err == nil || err.Error() != tt.want {
+			t.Errorf("%s: err = %v, want %q", name, err, tt.want)
+		}
+	}
+	a, err := NewReactAgent(ctx, looping(nil), nil, &ReactConfig{MaxIterations: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Run(ctx, nil); err == nil {
+		t.Error("nil input accepted")
+	}
+	if _, err := NewReactAgent(ctx, looping(nil), nil, &ReactConfig{}); err == nil {
+		t.Error("zero max iterations accepted")
+	}
+}
+
+func TestRegistryAgentBindsIntentTools(t *testing.T) {
+	ctx := context.Background()
+	registry := tools.NewRegistry()
+	for _, name := range []string{"lookup", "order"} {
+		if err := registry.Register(ctx, tools.Spec{Tool: stubTool{name: name, output: name}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	registry.SetIntentTools("search_intent", "lookup")
+
+	var bound []string
+	chatModel := llm.NewToolFake(func(_ []*schema.Message, infos []*schema.ToolInfo) (*schema.Message, error) {
+		bound = toolNames(infos)
+		return schema.AssistantMessage("ok", nil), nil
+	})
+	a, err := NewRegistryAgent(chatModel, registry, &ReactConfig{MaxIterations: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Run(ctx, testInput()); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(bound, []string{"lookup"}) {
+		t.Errorf("bound tools = %v, want only the intent's tools", bound)
+	}
+}
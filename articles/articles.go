@@ -0,0 +1,100 @@
+// Package articles defines the article record and how it is laid out in the vector store.
+package articles
+
+import (
+	"github.com/pawarison/eino-multi-modal-poc/dataset"
+	"github.com/pawarison/eino-multi-modal-poc/vectorstore"
+)
+
+// Field names of the articles collection.
+const (
+	FieldTitle       = "title"
+	FieldLink        = "link"
+	FieldPublication = "publication"
+	FieldReadingTime = "reading_time"
+	FieldClaps       = "claps"
+	FieldResponses   = "responses"
+)
+
+// Max lengths for string fields in Milvus VarChar columns.
+const (
+	TitleMaxLength       = 1024
+	LinkMaxLength        = 1024
+	PublicationMaxLength = 512
+)
+
+// Article is one row of the articles dataset.
+type Article struct {
+	ID          int64  `json:"id"`
+	Title       string `json:"title"`
+	Link        string `json:"link"`
+	ReadingTime int32  `json:"reading_time"`
+	Publication string `json:"publication"`
+	Claps       int32  `json:"claps"`
+	Responses   int32  `json:"responses"`
+}
+
+// Mapping maps the Medium articles dataset, a JSON object with a rows array,
+// and embeds the title. Titles are required and counts must not be negative.
+func Mapping() dataset.Mapping {
+	nonNegative := 0.0
+	return dataset.Mapping{
+		Format: dataset.FormatJSON,
+		Rows:   "rows",
+		ID:     "id",
+		Embed:  []string{FieldTitle},
+		Fields: []dataset.Field{
+			{Name: FieldTitle, Type: vectorstore.FieldVarChar, MaxLength: TitleMaxLength, Required: true},
+			{Name: FieldLink, Type: vectorstore.FieldVarChar, MaxLength: LinkMaxLength},
+			{Name: FieldPublication, Type: vectorstore.FieldVarChar, MaxLength: PublicationMaxLength},
+			{Name: FieldReadingTime, Type: vectorstore.FieldInt32, Min: &nonNegative},
+			{Name: FieldClaps, Type: vectorstore.FieldInt32, Min: &nonNegative},
+			{Name: FieldResponses, Type: vectorstore.FieldInt32, Min: &nonNegative},
+		},
+	}
+}
+
+// CollectionSpec returns the schema of an articles collection with title
+// embeddings of dimension dim in vectorField.
+func CollectionSpec(name, vectorField string, dim int) vectorstore.CollectionSpec {
+	return Mapping().CollectionSpec(name, vectorField, dim)
+}
+
+// Document converts the article and its title embedding into a store document.
+func (a Article) Document(vector []float32) vectorstore.Document {
+	return vectorstore.Document{
+		ID:     a.ID,
+		Vector: vector,
+		Fields: map[string]any{
+			FieldTitle:       a.Title,
+			FieldLink:        a.Link,
+			FieldPublication: a.Publication,
+			FieldReadingTime: a.ReadingTime,
+			FieldClaps:       a.Claps,
+			FieldResponses:   a.Responses,
+		},
+	}
+}
+
+// Record converts the article into a dataset record that embeds its title.
+func (a Article) Record() dataset.Record {
+	return dataset.Record{ID: a.ID, Text: a.Title, Fields: a.Document(nil).Fields}
+}
+
+// FromRecord rebuilds an article from a record. Fields the record lacks are zero.
+func FromRecord(r dataset.Record) Article {
+	return FromHit(vectorstore.Hit{ID: r.ID, Fields: r.Fields})
+}
+
+// FromHit rebuilds an article from a search hit.
+func FromHit(h vectorstore.Hit) Article {
+	return Article{
+		ID:          h.ID,
+		Title:       h.String(FieldTitle),
+		Link:        h.String(FieldLink),
+		Publication: h.String(FieldPublication),
+		ReadingTime: int32(h.Int(FieldReadingTime)),
+		Claps:       int32(h.Int(FieldClaps)),
+		Responses:   int32(h.Int(FieldResponses)),
+	}
+}
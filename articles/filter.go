@@ -0,0 +1,113 @@
+package articles
+
+import (
+	"errors"
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pawarison/eino-multi-modal-poc/vectorstore"
+)
+
+// MaxFilterPublications caps the publication set of a filter.
+const MaxFilterPublications = 20
+
+// Filter narrows article searches by metadata. Nil and empty fields do not
+// filter; set fields are ANDed.
+type Filter struct {
+	// Publications matches articles from any of the listed publications.
+	Publications   []string
+	MinReadingTime *int32
+	MaxReadingTime *int32
+	MinClaps       *int32
+	MinResponses   *int32
+}
+
+// IsZero reports whether the filter matches every article.
+func (f Filter) IsZero() bool {
+	return len(f.Publications) == 0 && f.MinReadingTime == nil && f.MaxReadingTime == nil &&
+		f.MinClaps == nil && f.MinResponses == nil
+}
+
+// Validate checks the values before they reach a store: publications must be
+// non-empty printable text within the column limit, and numbers must be
+// non-negative with the reading time range in order.
+func (f Filter) Validate() error {
+	var errs []error
+	if len(f.Publications) > MaxFilterPublications {
+		errs = append(errs, fmt.Errorf("at most %d publications, got %d", MaxFilterPublications, len(f.Publications)))
+	}
+	for _, p := range f.Publications {
+		if err := validatePublication(p); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, n := range []struct {
+		name string
+		v    *int32
+	}{
+		{"min_reading_time", f.MinReadingTime},
+		{"max_reading_time", f.MaxReadingTime},
+		{"min_claps", f.MinClaps},
+		{"min_responses", f.MinResponses},
+	} {
+		if n.v != nil && *n.v < 0 {
+			errs = append(errs, fmt.Errorf("%s must not be negative, got %d", n.name, *n.v))
+		}
+	}
+	if f.MinReadingTime != nil && f.MaxReadingTime != nil && *f.MinReadingTime > *f.MaxReadingTime {
+		errs = append(errs, fmt.Errorf("min_reading_time %d is greater than max_reading_time %d", *f.MinReadingTime, *f.MaxReadingTime))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid filter: %w", err)
+	}
+	return nil
+}
+
+func validatePublication(p string) error {
+	if p == "" {
+		return fmt.Errorf("publication must not be empty")
+	}
+	if !utf8.ValidString(p) {
+		return fmt.Errorf("publication %q is not valid UTF-8", p)
+	}
+	if n := utf8.RuneCountInString(p); n > PublicationMaxLength {
+		return fmt.Errorf("publication is %d characters, max %d", n, PublicationMaxLength)
+	}
+	for _, r := range p {
+		if !unicode.IsPrint(r) && r != ' ' {
+			return fmt.Errorf("publication %q contains control characters", p)
+		}
+	}
+	return nil
+}
+
+// Conditions translates the filter into store conditions. Callers validate first.
+func (f Filter) Conditions() vectorstore.Filter {
+	var conds vectorstore.Filter
+	if len(f.Publications) > 0 {
+		values := make([]any, len(f.Publications))
+		for i, p := range f.Publications {
+			values[i] = p
+		}
+		conds = append(conds, vectorstore.In(FieldPublication, values...))
+	}
+	if f.MinReadingTime != nil {
+		conds = append(conds, vectorstore.Gte(FieldReadingTime, *f.MinReadingTime))
+	}
+	if f.MaxReadingTime != nil {
+		conds = append(conds, vectorstore.Lte(FieldReadingTime, *f.MaxReadingTime))
+	}
+	if f.MinClaps != nil {
+		conds = append(conds, vectorstore.Gte(FieldClaps, *f.MinClaps))
+	}
+	if f.MinResponses != nil {
+		conds = append(conds, vectorstore.Gte(FieldResponses, *f.MinResponses))
+	}
+	return conds
+}
+
+// Match reports whether a passes the filter, with the same semantics as the stores.
+func (f Filter) Match(a Article) bool {
+	return f.Conditions().Match(a.ID, a.Document(nil).Fields)
+}
@@ -0,0 +1,197 @@
+package dataset
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/pawarison/eino-multi-modal-poc/vectorstore"
+)
+
+// Fields added to every row of a chunked collection.
+const (
+	// FieldParentID is the id of the record a chunk was cut from.
+	FieldParentID = "parent_id"
+	// FieldChunkIndex is the 0-based position of the chunk in its record.
+	FieldChunkIndex = "chunk_index"
+	// FieldChunkText is the chunk without the embedded fields.
+	FieldChunkText = "chunk_text"
+)
+
+// MaxChunks is the number of chunks a record may have; chunk ids are
+// parent id * MaxChunks + index.
+const MaxChunks = 10000
+
+// maxVarChar is the largest Milvus varchar length.
+const maxVarChar = 65535
+
+// utf8Max is the most bytes one character takes in UTF-8.
+const utf8Max = 4
+
+// Chunking splits a long text of each row into overlapping chunks that are
+// embedded and stored separately, linked to the row by FieldParentID.
+type Chunking struct {
+	// Source is the dataset key of the long text. It is not stored whole.
+	Source string `json:"source"`
+	// Size and Overlap are in characters.
+	Size    int `json:"size"`
+	Overlap int `json:"overlap"`
+}
+
+func (c Chunking) validate(m Mapping) error {
+	var errs []error
+	if c.Source == "" {
+		errs = append(errs, fmt.Errorf("chunking source is required"))
+	}
+	if c.Size <= 0 || c.Size*utf8Max > maxVarChar {
+		errs = append(errs, fmt.Errorf("chunk size %d must be 1-%d", c.Size, maxVarChar/utf8Max))
+	}
+	if c.Overlap < 0 || c.Overlap >= c.Size {
+		errs = append(errs, fmt.Errorf("chunk overlap %d must be at least 0 and less than the size", c.Overlap))
+	}
+	for _, f := range m.Fields {
+		switch f.Name {
+		case FieldParentID, FieldChunkIndex, FieldChunkText:
+			errs = append(errs, fmt.Errorf("field %s: name is reserved for chunks", f.Name))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// chunkFields are the fields chunked collections add to the mapped ones.
+func (c Chunking) fields() []vectorstore.Field {
+	return []vectorstore.Field{
+		{Name: FieldParentID, Type: vectorstore.FieldInt64},
+		{Name: FieldChunkIndex, Type: vectorstore.FieldInt32},
+		{Name: FieldChunkText, Type: vectorstore.FieldVarChar, MaxLength: c.Size * utf8Max},
+	}
+}
+
+// Chunk expands each record into its chunks: the record's fields plus the
+// chunk fields, with the embedded fields prefixed to the chunk text so every
+// chunk carries the record's context. A record without long text becomes one
+// chunk with an empty chunk text. Without chunking the records are returned
+// as they are.
+func (m Mapping) Chunk(records []Record) ([]Record, error) {
+	if m.Chunking == nil {
+		return records, nil
+	}
+	var out []Record
+	for _, r := range records {
+		if r.ID < 0 || r.ID > math.MaxInt64/MaxChunks-1 {
+			return nil, fmt.Errorf("record %d: id out of range for chunk ids", r.ID)
+		}
+		chunks := SplitText(r.Body, m.Chunking.Size, m.Chunking.Overlap)
+		if len(chunks) == 0 {
+			chunks = []string{""}
+		}
+		if len(chunks) > MaxChunks {
+			return nil, fmt.Errorf("record %d: %d chunks, max %d", r.ID, len(chunks), MaxChunks)
+		}
+		for i, chunk := range chunks {
+			fields := cloneFields(r.Fields)
+			fields[FieldParentID] = r.ID
+			fields[FieldChunkIndex] = int32(i)
+			fields[FieldChunkText] = chunk
+			text := chunk
+			if r.Text != "" && chunk != "" {
+				text = r.Text + m.separator() + chunk
+			} else if r.Text != "" {
+				text = r.Text
+			}
+			out = append(out, Record{ID: r.ID*MaxChunks + int64(i), Text: text, Fields: fields})
+		}
+	}
+	return out, nil
+}
+
+// SplitText cuts text into chunks of at most size characters, each starting
+// about overlap characters before the previous one ended. Cuts prefer whitespace;
+// Thai is written without spaces between words, so inside a Thai run the cut
+// falls on a character cluster boundary, which never separates a consonant
+// from its vowels and tone marks. Other text is cut anywhere only when a word
+// is longer than half a chunk.
+func SplitText(text string, size, overlap int) []string {
+	runes := []rune(strings.TrimSpace(text))
+	if len(runes) == 0 || size <= 0 {
+		return nil
+	}
+	overlap = max(0, min(overlap, size-1))
+	var chunks []string
+	for start := 0; start < len(runes); {
+		end := min(start+size, len(runes))
+		if end < len(runes) {
+			end = cut(runes, start+size/2, end)
+		}
+		if chunk := strings.TrimSpace(string(runes[start:end])); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+		if end == len(runes) {
+			break
+		}
+		// start the next chunk at a boundary too, letting the overlap grow
+		// up to twice its size to reach the start of a word
+		next := max(end-overlap, start+1)
+		if overlap > 0 {
+			next = cut(runes, max(start+1, end-2*overlap)-1, next)
+		}
+		for next < end && unicode.IsSpace(runes[next]) {
+			next++
+		}
+		start = next
+	}
+	return chunks
+}
+
+// cut returns the best boundary in (lo, hi]: after whitespace, then at a Thai
+// cluster boundary, then hi itself.
+func cut(runes []rune, lo, hi int) int {
+	for _, wordsOnly := range []bool{true, false} {
+		for i := hi; i > lo; i-- {
+			if isBoundary(runes, i, wordsOnly) {
+				return i
+			}
+		}
+	}
+	return hi
+}
+
+// isBoundary reports whether text may be cut before runes[i]. wordsOnly
+// accepts only cuts after whitespace or sentence punctuation.
+func isBoundary(runes []rune, i int, wordsOnly bool) bool {
+	if i <= 0 || i >= len(runes) {
+		return true
+	}
+	prev, next := runes[i-1], runes[i]
+	if unicode.IsSpace(prev) || (isSentenceEnd(prev) && unicode.IsSpace(next)) {
+		return true
+	}
+	if wordsOnly {
+		return false
+	}
+	return unicode.Is(unicode.Thai, prev) && unicode.Is(unicode.Thai, next) && thaiClusterBoundary(prev, next)
+}
+
+func isSentenceEnd(r rune) bool {
+	return r == '.' || r == '!' || r == '?' || r == 'ฯ' || r == '๚' || r == '๛'
+}
+
+// thaiClusterBoundary reports whether a Thai character cluster may end
+// between prev and next: next is not a vowel or tone mark attached to the
+// preceding consonant, and prev is not a leading vowel waiting for one.
+func thaiClusterBoundary(prev, next rune) bool {
+	switch {
+	case unicode.Is(unicode.Mn, next):
+		// above and below vowels, tone marks, thanthakhat
+		return false
+	case next == 'ะ' || next == 'า' || next == 'ำ' || next == 'ๅ':
+		// following vowels sara a, sara aa, sara am, lakkhangyao
+		return false
+	case prev >= 'เ' && prev <= 'ไ':
+		// leading vowels sara e, ae, o, ai maimuan, ai maimalai
+		return false
+	}
+	return true
+}
@@ -0,0 +1,84 @@
+package dataset
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode"
+	"unicode/utf8"
+)
+
+func TestSplitText(t *testing.T) {
+	tests := []struct {
+		text          string
+		size, overlap int
+		want          []string
+	}{
+		{"", 10, 2, nil},
+		{"  short text ", 100, 10, []string{"short text"}},
+		{"aaa bbb ccc ddd", 8, 0, []string{"aaa bbb", "ccc ddd"}},
+		{"aaa bbb ccc ddd", 8, 4, []string{"aaa bbb", "bbb ccc", "ccc ddd"}},
+		{"One. Two. Three.", 10, 0, []string{"One. Two.", "Three."}},
+		// a word longer than half a chunk is cut anywhere
+		{"abcdefghijklmnop", 5, 0, []string{"abcde", "fghij", "klmno", "p"}},
+	}
+	for _, tt := range tests {
+		if got := SplitText(tt.text, tt.size, tt.overlap); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitText(%q, %d, %d) = %q, want %q", tt.text, tt.size, tt.overlap, got, tt.want)
+		}
+	}
+}
+
+func TestSplitTextThai(t *testing.T) {
+	text := "สวัสดีครับยินดีต้อนรับสู่ร้านของเราเปิดให้บริการทุกวันไม่เว้นวันหยุด"
+	chunks := SplitText(text, 8, 3)
+	if len(chunks) < 2 {
+		t.Fatalf("chunks = %q", chunks)
+	}
+	for _, c := range chunks {
+		first, _ := utf8.DecodeRuneInString(c)
+		last, _ := utf8.DecodeLastRuneInString(c)
+		if n := utf8.RuneCountInString(c); n > 8 {
+			t.Errorf("chunk %q has %d characters", c, n)
+		}
+		if unicode.Is(unicode.Mn, first) || strings.ContainsRune("ะาำๅ", first) {
+			t.Errorf("chunk %q starts with a vowel or tone mark of the previous consonant", c)
+		}
+		if last >= 'เ' && last <= 'ไ' {
+			t.Errorf("chunk %q ends with a leading vowel", c)
+		}
+	}
+	if !strings.HasPrefix(text, chunks[0]) || !strings.HasSuffix(text, chunks[len(chunks)-1]) {
+		t.Errorf("chunks do not cover the text: %q", chunks)
+	}
+}
+
+func TestMappingChunk(t *testing.T) {
+	m := Mapping{
+		ID:       "id",
+		Embed:    []string{"title"},
+		Chunking: &Chunking{Source: "body", Size: 8},
+	}
+	records := []Record{
+		{ID: 2, Text: "Title", Body: "aaa bbb ccc ddd", Fields: map[string]any{"title": "Title"}},
+		{ID: 3, Text: "Empty", Fields: map[string]any{"title": "Empty"}},
+	}
+	out, err := m.Chunk(records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Record{
+		{ID: 20000, Text: "Title\naaa bbb", Fields: map[string]any{"title": "Title", FieldParentID: int64(2), FieldChunkIndex: int32(0), FieldChunkText: "aaa bbb"}},
+		{ID: 20001, Text: "Title\nccc ddd", Fields: map[string]any{"title": "Title", FieldParentID: int64(2), FieldChunkIndex: int32(1), FieldChunkText: "ccc ddd"}},
+		{ID: 30000, Text: "Empty", Fields: map[string]any{"title": "Empty", FieldParentID: int64(3), FieldChunkIndex: int32(0), FieldChunkText: ""}},
+	}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("chunks = %+v\nwant %+v", out, want)
+	}
+	if _, ok := records[0].Fields[FieldParentID]; ok {
+		t.Error("Chunk modified its input")
+	}
+	if _, err := m.Chunk([]Record{{ID: -1}}); err == nil {
+		t.Error("negative id accepted")
+	}
+}
@@ -0,0 +1,282 @@
+package dataset
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pawarison/eino-multi-modal-poc/vectorstore"
+)
+
+// Load reads the dataset at path and maps every row. Rows are numbered from 1
+// in errors.
+func Load(path string, m Mapping) ([]Record, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	format, err := m.format(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("open dataset: %w", err)
+	}
+	defer f.Close()
+
+	var rows []map[string]any
+	switch format {
+	case FormatJSON:
+		rows, err = readJSON(f, m.Rows)
+	case FormatJSONL:
+		rows, err = readJSONL(f)
+	case FormatCSV:
+		rows, err = readCSV(f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("decode dataset %s: %w", path, err)
+	}
+
+	records := make([]Record, len(rows))
+	for i, row := range rows {
+		r, err := m.record(row)
+		if err != nil {
+			return nil, fmt.Errorf("dataset %s: row %d: %w", path, i+1, err)
+		}
+		records[i] = r
+	}
+	return records, nil
+}
+
+func (m Mapping) format(path string) (Format, error) {
+	if m.Format != "" {
+		return m.Format, nil
+	}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		return FormatJSON, nil
+	case ".jsonl", ".ndjson":
+		return FormatJSONL, nil
+	case ".csv":
+		return FormatCSV, nil
+	default:
+		return "", fmt.Errorf("dataset %s: cannot tell the format from %q; set it in the mapping", path, ext)
+	}
+}
+
+func readJSON(r io.Reader, key string) ([]map[string]any, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	if key == "" {
+		var rows []map[string]any
+		if err := dec.Decode(&rows); err != nil {
+			return nil, err
+		}
+		return rows, nil
+	}
+	var payload map[string]json.RawMessage
+	if err := dec.Decode(&payload); err != nil {
+		return nil, err
+	}
+	raw, ok := payload[key]
+	if !ok {
+		return nil, fmt.Errorf("no %q array", key)
+	}
+	dec = json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var rows []map[string]any
+	if err := dec.Decode(&rows); err != nil {
+		return nil, fmt.Errorf("%s: %w", key, err)
+	}
+	return rows, nil
+}
+
+func readJSONL(r io.Reader) ([]map[string]any, error) {
+	var rows []map[string]any
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		text := bytes.TrimSpace(sc.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		dec := json.NewDecoder(bytes.NewReader(text))
+		dec.UseNumber()
+		var row map[string]any
+		if err := dec.Decode(&row); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rows = append(rows, row)
+	}
+	return rows, sc.Err()
+}
+
+func readCSV(r io.Reader) ([]map[string]any, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+	var rows []map[string]any
+	for {
+		values, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		row := make(map[string]any, len(header))
+		for i, name := range header {
+			row[name] = values[i]
+		}
+		rows = append(rows, row)
+	}
+}
+
+// record maps one row. Missing and null values become the zero value of the
+// field type.
+func (m Mapping) record(row map[string]any) (Record, error) {
+	id, err := toID(row[m.ID])
+	if err != nil {
+		return Record{}, fmt.Errorf("id %s: %w", m.ID, err)
+	}
+	r := Record{ID: id, Fields: make(map[string]any, len(m.Fields))}
+	for _, f := range m.Fields {
+		v, err := convert(f.Type, row[f.source()])
+		if err != nil {
+			return Record{}, fmt.Errorf("field %s: %w", f.Name, err)
+		}
+		r.Fields[f.Name] = v
+	}
+	r.Text = m.text(r.Fields)
+	if m.Chunking != nil {
+		body, err := convert(vectorstore.FieldVarChar, row[m.Chunking.Source])
+		if err != nil {
+			return Record{}, fmt.Errorf("chunking source %s: %w", m.Chunking.Source, err)
+		}
+		r.Body = body.(string)
+	}
+	return r, nil
+}
+
+// text joins the non-empty embedded fields.
+func (m Mapping) text(fields map[string]any) string {
+	var parts []string
+	for _, name := range m.Embed {
+		if s, _ := fields[name].(string); s != "" {
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(parts, m.separator())
+}
+
+func toID(v any) (int64, error) {
+	switch id := v.(type) {
+	case json.Number:
+		n, err := id.Int64()
+		if err != nil {
+			return 0, fmt.Errorf("%s is not an integer", id)
+		}
+		return n, nil
+	case string:
+		n, err := strconv.ParseInt(strings.TrimSpace(id), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%q is not an integer", id)
+		}
+		return n, nil
+	case nil:
+		return 0, fmt.Errorf("missing")
+	default:
+		return 0, fmt.Errorf("want integer, got %T", v)
+	}
+}
+
+// convert coerces a JSON or CSV value to the Go type stored for t.
+func convert(t vectorstore.FieldType, v any) (any, error) {
+	if s, ok := v.(string); ok && t != vectorstore.FieldVarChar {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			v = nil
+		} else if t != vectorstore.FieldBool {
+			v = json.Number(s)
+		} else {
+			b, err := strconv.ParseBool(s)
+			if err != nil {
+				return nil, fmt.Errorf("%q is not a bool", s)
+			}
+			v = b
+		}
+	}
+	switch t {
+	case vectorstore.FieldVarChar:
+		switch s := v.(type) {
+		case nil:
+			return "", nil
+		case string:
+			return s, nil
+		case json.Number:
+			return s.String(), nil
+		case bool:
+			return strconv.FormatBool(s), nil
+		}
+	case vectorstore.FieldInt32, vectorstore.FieldInt64:
+		bits := 64
+		if t == vectorstore.FieldInt32 {
+			bits = 32
+		}
+		switch n := v.(type) {
+		case nil:
+			return zero(t), nil
+		case json.Number:
+			i, err := strconv.ParseInt(n.String(), 10, bits)
+			if err != nil {
+				return nil, fmt.Errorf("%s is not a %s", n, t)
+			}
+			if t == vectorstore.FieldInt32 {
+				return int32(i), nil
+			}
+			return i, nil
+		}
+	case vectorstore.FieldDouble:
+		switch n := v.(type) {
+		case nil:
+			return 0.0, nil
+		case json.Number:
+			f, err := n.Float64()
+			if err != nil {
+				return nil, fmt.Errorf("%s is not a number", n)
+			}
+			return f, nil
+		}
+	case vectorstore.FieldBool:
+		switch b := v.(type) {
+		case nil:
+			return false, nil
+		case bool:
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("want %s, got %T", t, v)
+}
+
+func zero(t vectorstore.FieldType) any {
+	if t == vectorstore.FieldInt32 {
+		return int32(0)
+	}
+	return int64(0)
+}
@@ -0,0 +1,194 @@
+// Package dataset loads rows from JSON, JSONL and CSV files and maps them to
+// records for ingestion: an int64 id, the text to embed and typed scalar fields.
+package dataset
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pawarison/eino-multi-modal-poc/vectorstore"
+)
+
+// Format is the encoding of a dataset file.
+type Format string
+
+const (
+	// FormatJSON is a top-level array of objects, or an object holding one.
+	FormatJSON Format = "json"
+	// FormatJSONL is one object per line.
+	FormatJSONL Format = "jsonl"
+	// FormatCSV has a header row naming the columns.
+	FormatCSV Format = "csv"
+)
+
+// DefaultEmbedSeparator joins the embedded fields of a row.
+const DefaultEmbedSeparator = "\n"
+
+// Field maps a source column to a scalar field of the collection.
+type Field struct {
+	// Name is the field in the collection.
+	Name string `json:"name"`
+	// Source is the key or column in the dataset. Empty means Name.
+	Source string                `json:"source,omitempty"`
+	Type   vectorstore.FieldType `json:"type"`
+	// MaxLength is the maximum byte length of a varchar field.
+	MaxLength int `json:"max_length,omitempty"`
+	// Required rejects an empty varchar value.
+	Required bool `json:"required,omitempty"`
+	// Min is the smallest allowed value of a number field.
+	Min *float64 `json:"min,omitempty"`
+}
+
+// Mapping says how rows of a dataset become records.
+type Mapping struct {
+	// Format defaults to the file extension.
+	Format Format `json:"format,omitempty"`
+	// Rows is the key of the row array when a JSON file is an object.
+	Rows string `json:"rows,omitempty"`
+	// ID is the source key of the integer primary key.
+	ID string `json:"id"`
+	// Embed lists the fields whose values are joined with EmbedSeparator and
+	// embedded, such as the title, or the title and the publication.
+	Embed          []string `json:"embed"`
+	EmbedSeparator string   `json:"embed_separator,omitempty"`
+	// Fields are stored next to the vector.
+	Fields []Field `json:"fields"`
+	// Chunking stores a long text as several chunk rows per record. Without
+	// it each record is one row.
+	Chunking *Chunking `json:"chunking,omitempty"`
+}
+
+// LoadMapping reads a JSON mapping file and validates it.
+func LoadMapping(path string) (*Mapping, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("read mapping: %w", err)
+	}
+	var m Mapping
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&m); err != nil {
+		return nil, fmt.Errorf("decode mapping %s: %w", path, err)
+	}
+	if err := m.Validate(); err != nil {
+		return nil, fmt.Errorf("mapping %s: %w", path, err)
+	}
+	return &m, nil
+}
+
+// Validate reports every problem with the mapping.
+func (m Mapping) Validate() error {
+	var errs []error
+	switch m.Format {
+	case "", FormatJSON, FormatJSONL, FormatCSV:
+	default:
+		errs = append(errs, fmt.Errorf("unknown format %q", m.Format))
+	}
+	if m.ID == "" {
+		errs = append(errs, fmt.Errorf("id is required"))
+	}
+	if len(m.Fields) == 0 {
+		errs = append(errs, fmt.Errorf("at least one field is required"))
+	}
+	names := map[string]Field{}
+	for _, f := range m.Fields {
+		switch {
+		case f.Name == "":
+			errs = append(errs, fmt.Errorf("field name is required"))
+			continue
+		case f.Name == vectorstore.PrimaryField:
+			errs = append(errs, fmt.Errorf("field %s: name is reserved for the primary key", f.Name))
+		}
+		if _, dup := names[f.Name]; dup {
+			errs = append(errs, fmt.Errorf("field %s is mapped twice", f.Name))
+		}
+		names[f.Name] = f
+		switch f.Type {
+		case vectorstore.FieldInt32, vectorstore.FieldInt64, vectorstore.FieldDouble, vectorstore.FieldBool:
+			if f.Required {
+				errs = append(errs, fmt.Errorf("field %s: required only applies to varchar", f.Name))
+			}
+			if f.Min != nil && f.Type == vectorstore.FieldBool {
+				errs = append(errs, fmt.Errorf("field %s: min only applies to numbers", f.Name))
+			}
+		case vectorstore.FieldVarChar:
+			if f.MaxLength <= 0 {
+				errs = append(errs, fmt.Errorf("field %s: varchar needs a max length", f.Name))
+			}
+			if f.Min != nil {
+				errs = append(errs, fmt.Errorf("field %s: min only applies to numbers", f.Name))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("field %s: unknown type %q", f.Name, f.Type))
+		}
+	}
+	if len(m.Embed) == 0 {
+		errs = append(errs, fmt.Errorf("at least one embedded field is required"))
+	}
+	for _, name := range m.Embed {
+		f, ok := names[name]
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Errorf("embedded field %s is not mapped", name))
+		case f.Type != vectorstore.FieldVarChar:
+			errs = append(errs, fmt.Errorf("embedded field %s is %s, want varchar", name, f.Type))
+		}
+	}
+	if m.Chunking != nil {
+		if err := m.Chunking.validate(m); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid mapping: %w", err)
+	}
+	return nil
+}
+
+// CollectionSpec returns the schema of a collection holding the mapped fields
+// and embeddings of dimension dim in vectorField, plus the chunk fields when
+// the mapping chunks.
+func (m Mapping) CollectionSpec(name, vectorField string, dim int) vectorstore.CollectionSpec {
+	spec := vectorstore.CollectionSpec{Name: name, VectorField: vectorField, Dim: dim}
+	for _, f := range m.Fields {
+		spec.Fields = append(spec.Fields, vectorstore.Field{Name: f.Name, Type: f.Type, MaxLength: f.MaxLength})
+	}
+	if m.Chunking != nil {
+		spec.Fields = append(spec.Fields, m.Chunking.fields()...)
+	}
+	return spec
+}
+
+func (f Field) source() string {
+	if f.Source != "" {
+		return f.Source
+	}
+	return f.Name
+}
+
+func (m Mapping) separator() string {
+	if m.EmbedSeparator != "" {
+		return m.EmbedSeparator
+	}
+	return DefaultEmbedSeparator
+}
+
+// Record is one mapped row.
+type Record struct {
+	ID int64 `json:"id"`
+	// Text is what gets embedded.
+	Text string `json:"text"`
+	// Body is the long text split by Mapping.Chunk. It is only set when the
+	// mapping chunks.
+	Body   string         `json:"body,omitempty"`
+	Fields map[string]any `json:"fields"`
+}
+
+// Document converts the record and its embedding into a store document.
+func (r Record) Document(vector []float32) vectorstore.Document {
+	return vectorstore.Document{ID: r.ID, Vector: vector, Fields: r.Fields}
+}
@@ -0,0 +1,262 @@
+package dataset
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pawarison/eino-multi-modal-poc/vectorstore"
+)
+
+// ErrInvalid is returned when a dataset has violations that were not fixed.
+var ErrInvalid = errors.New("invalid dataset")
+
+// Rules a record can violate.
+const (
+	// RuleMaxLength: a varchar value is longer than the field's max length in bytes.
+	RuleMaxLength = "max_length"
+	// RuleDuplicateID: an earlier row has the same id.
+	RuleDuplicateID = "duplicate_id"
+	// RuleRequired: a required field is empty.
+	RuleRequired = "required"
+	// RuleMin: a number is below the field's minimum.
+	RuleMin = "min"
+	// RuleEmptyText: all embedded fields and the chunked text are empty, so
+	// there is nothing to embed.
+	RuleEmptyText = "empty_text"
+)
+
+// Fix names accepted by ParseFixes.
+const (
+	FixTruncate = "truncate"
+	FixDedup    = "dedup"
+	FixDrop     = "drop"
+)
+
+// Fixes selects how violations are repaired.
+type Fixes struct {
+	// Truncate cuts values over their max length at a rune boundary.
+	Truncate bool
+	// Dedup keeps the first row of each id.
+	Dedup bool
+	// Drop removes rows with violations that are not otherwise fixed.
+	Drop bool
+}
+
+// ParseFixes reads fix names such as "truncate", "dedup" and "drop".
+func ParseFixes(names []string) (Fixes, error) {
+	var f Fixes
+	for _, name := range names {
+		switch strings.TrimSpace(name) {
+		case FixTruncate:
+			f.Truncate = true
+		case FixDedup:
+			f.Dedup = true
+		case FixDrop:
+			f.Drop = true
+		case "":
+		default:
+			return Fixes{}, fmt.Errorf("unknown fix %q", name)
+		}
+	}
+	return f, nil
+}
+
+// Violation is one rule broken by one row.
+type Violation struct {
+	// Row is the 1-based position of the row in the dataset.
+	Row   int
+	ID    int64
+	Field string
+	Rule  string
+	// Detail says what is wrong.
+	Detail string
+	// Fix is how the violation was repaired, or empty when it was not.
+	Fix string
+}
+
+func (v Violation) String() string {
+	s := fmt.Sprintf("row %d (id %d): ", v.Row, v.ID)
+	if v.Field != "" {
+		s += v.Field + ": "
+	}
+	s += v.Detail
+	if v.Fix != "" {
+		s += " [" + v.Fix + "]"
+	}
+	return s
+}
+
+// ValidationReport lists every violation found by Check.
+type ValidationReport struct {
+	// Rows is the number of rows checked; Kept is the number returned.
+	Rows       int
+	Kept       int
+	Violations []Violation
+}
+
+// Unfixed counts the violations left as they were.
+func (r *ValidationReport) Unfixed() int {
+	n := 0
+	for _, v := range r.Violations {
+		if v.Fix == "" {
+			n++
+		}
+	}
+	return n
+}
+
+// Err summarizes the unfixed violations, or returns nil when there are none.
+// The error wraps ErrInvalid.
+func (r *ValidationReport) Err() error {
+	n := r.Unfixed()
+	if n == 0 {
+		return nil
+	}
+	counts := map[string]int{}
+	var rules []string
+	for _, v := range r.Violations {
+		if v.Fix != "" {
+			continue
+		}
+		if counts[v.Rule] == 0 {
+			rules = append(rules, v.Rule)
+		}
+		counts[v.Rule]++
+	}
+	parts := make([]string, len(rules))
+	for i, rule := range rules {
+		parts[i] = fmt.Sprintf("%d %s", counts[rule], rule)
+	}
+	return fmt.Errorf("%w: %d unfixed violations (%s)", ErrInvalid, n, strings.Join(parts, ", "))
+}
+
+// String renders every violation, one per line, after a summary.
+func (r *ValidationReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "validation: %d rows, %d kept, %d violations, %d unfixed", r.Rows, r.Kept, len(r.Violations), r.Unfixed())
+	for _, v := range r.Violations {
+		fmt.Fprintf(&b, "\n  %s", v)
+	}
+	return b.String()
+}
+
+// Check validates records against the mapping and applies fixes. It reports
+// every violation of the input and returns the rows to ingest; without fixes
+// they are the input rows unchanged. Fixed values are copies, so records is
+// not modified.
+func Check(records []Record, m Mapping, fixes Fixes) ([]Record, *ValidationReport) {
+	report := &ValidationReport{Rows: len(records)}
+	kept := make([]Record, 0, len(records))
+	seen := make(map[int64]int, len(records))
+	for i, r := range records {
+		row := i + 1
+		var found []Violation
+		add := func(field, rule, detail string) *Violation {
+			found = append(found, Violation{Row: row, ID: r.ID, Field: field, Rule: rule, Detail: detail})
+			return &found[len(found)-1]
+		}
+
+		if first, dup := seen[r.ID]; dup {
+			v := add("", RuleDuplicateID, fmt.Sprintf("id already used by row %d", first))
+			if fixes.Dedup {
+				v.Fix = "dropped"
+				report.Violations = append(report.Violations, found...)
+				continue
+			}
+		}
+
+		fields := r.Fields
+		cloned := false
+		for _, f := range m.Fields {
+			v := fields[f.Name]
+			switch f.Type {
+			case vectorstore.FieldVarChar:
+				s, _ := v.(string)
+				if f.Required && strings.TrimSpace(s) == "" {
+					add(f.Name, RuleRequired, "value is empty")
+				}
+				if f.MaxLength > 0 && len(s) > f.MaxLength {
+					viol := add(f.Name, RuleMaxLength, fmt.Sprintf("%d bytes (%d characters) exceeds max length %d",
+						len(s), utf8.RuneCountInString(s), f.MaxLength))
+					if fixes.Truncate {
+						if !cloned {
+							fields, cloned = cloneFields(fields), true
+						}
+						fields[f.Name] = truncate(s, f.MaxLength)
+						viol.Fix = "truncated"
+					}
+				}
+			default:
+				if f.Min == nil {
+					continue
+				}
+				if n, ok := number(v); ok && n < *f.Min {
+					add(f.Name, RuleMin, fmt.Sprintf("%v is below the minimum %v", v, *f.Min))
+				}
+			}
+		}
+
+		text := r.Text
+		if cloned {
+			text = m.text(fields)
+		}
+		if strings.TrimSpace(text) == "" && strings.TrimSpace(r.Body) == "" {
+			add("", RuleEmptyText, "nothing to embed")
+		}
+
+		drop := false
+		for j := range found {
+			if found[j].Fix == "" && fixes.Drop {
+				drop = true
+			}
+		}
+		if drop {
+			for j := range found {
+				found[j].Fix = "row dropped"
+			}
+		} else {
+			kept = append(kept, Record{ID: r.ID, Text: text, Body: r.Body, Fields: fields})
+			// a dropped row does not claim its id
+			if _, dup := seen[r.ID]; !dup {
+				seen[r.ID] = row
+			}
+		}
+		report.Violations = append(report.Violations, found...)
+	}
+	report.Kept = len(kept)
+	return kept, report
+}
+
+func cloneFields(fields map[string]any) map[string]any {
+	out := make(map[string]any, len(fields))
+	for k, v := range fields {
+		out[k] = v
+	}
+	return out
+}
+
+// truncate cuts s to at most n bytes without splitting a rune.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+func number(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,93 @@
+package dataset
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/pawarison/eino-multi-modal-poc/vectorstore"
+)
+
+func checkMapping() Mapping {
+	zero := 0.0
+	return Mapping{
+		ID:    "id",
+		Embed: []string{"title"},
+		Fields: []Field{
+			{Name: "title", Type: vectorstore.FieldVarChar, MaxLength: 8, Required: true},
+			{Name: "claps", Type: vectorstore.FieldInt64, Min: &zero},
+		},
+	}
+}
+
+func record(id int64, title string, claps int64) Record {
+	return Record{ID: id, Text: title, Fields: map[string]any{"title": title, "claps": claps}}
+}
+
+func rules(report *ValidationReport) []string {
+	var out []string
+	for _, v := range report.Violations {
+		out = append(out, v.Rule+":"+v.Fix)
+	}
+	return out
+}
+
+func TestCheck(t *testing.T) {
+	records := []Record{
+		record(1, "ok", 1),
+		record(2, "สวัสดีครับ", 0), // 30 bytes
+		record(1, "again", 0),
+		record(3, "", 0),
+		record(4, "x", -1),
+		record(3, "retry", 0),
+	}
+
+	t.Run("report only", func(t *testing.T) {
+		kept, report := Check(records, checkMapping(), Fixes{})
+		if !reflect.DeepEqual(kept, records) {
+			t.Errorf("rows changed without fixes: %+v", kept)
+		}
+		want := []string{"max_length:", "duplicate_id:", "required:", "empty_text:", "min:", "duplicate_id:"}
+		if got := rules(report); !reflect.DeepEqual(got, want) {
+			t.Errorf("violations = %v, want %v", got, want)
+		}
+		if err := report.Err(); !errors.Is(err, ErrInvalid) || report.Unfixed() != 6 {
+			t.Errorf("Err = %v with %d unfixed", err, report.Unfixed())
+		}
+	})
+
+	t.Run("fix", func(t *testing.T) {
+		kept, report := Check(records, checkMapping(), Fixes{Truncate: true, Dedup: true, Drop: true})
+		var ids []int64
+		for _, r := range kept {
+			ids = append(ids, r.ID)
+		}
+		// the dropped row 4 does not claim id 3, so row 6 is kept
+		if !reflect.DeepEqual(ids, []int64{1, 2, 3}) || report.Kept != 3 || report.Rows != 6 {
+			t.Fatalf("kept ids = %v, report %d/%d", ids, report.Kept, report.Rows)
+		}
+		if kept[1].Fields["title"] != "สว" || kept[1].Text != "สว" {
+			t.Errorf("truncated row = %+v, want the title cut at a rune boundary", kept[1])
+		}
+		if records[1].Fields["title"] != "สวัสดีครับ" {
+			t.Error("Check modified its input")
+		}
+		want := []string{"max_length:truncated", "duplicate_id:dropped", "required:row dropped", "empty_text:row dropped", "min:row dropped"}
+		if got := rules(report); !reflect.DeepEqual(got, want) {
+			t.Errorf("violations = %v, want %v", got, want)
+		}
+		if err := report.Err(); err != nil {
+			t.Errorf("Err = %v after fixing everything", err)
+		}
+	})
+}
+
+func TestParseFixes(t *testing.T) {
+	got, err := ParseFixes([]string{"truncate", " drop", ""})
+	if err != nil || got != (Fixes{Truncate: true, Drop: true}) {
+		t.Errorf("ParseFixes = %+v, %v", got, err)
+	}
+	if _, err := ParseFixes([]string{"repair"}); err == nil {
+		t.Error("unknown fix accepted")
+	}
+}
@@ -0,0 +1,261 @@
+package dialogue
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+	"github.com/pawarison/eino-multi-modal-poc/privacy"
+	"github.com/pawarison/eino-multi-modal-poc/prompt/ask"
+)
+
+// AskConfig controls how follow-up questions are built.
+type AskConfig struct {
+	// MultiSlot asks for several missing slots in one question.
+	MultiSlot bool `envconfig:"NLU_ASK_MULTI_SLOT" default:"true"`
+	// MaxSlotsPerQuestion caps how many slots one question asks for when MultiSlot is on.
+	MaxSlotsPerQuestion int `envconfig:"NLU_ASK_MAX_SLOTS" default:"2"`
+	// DefaultLanguage is used when the detected language has no templates.
+	DefaultLanguage string `envconfig:"NLU_ASK_DEFAULT_LANGUAGE" default:"tha"`
+}
+
+// QuestionSource tells where a follow-up question came from.
+type QuestionSource string
+
+const (
+	SourceTemplate QuestionSource = "template"
+	SourceLLM      QuestionSource = "llm"
+)
+
+// Question is a generated follow-up for missing slots.
+type Question struct {
+	Text     string
+	Slots    []string
+	Language string
+	Source   QuestionSource
+}
+
+// AskGenerator turns missing slots into a follow-up question. It uses the
+// per-slot templates in prompt/ask first and falls back to a small chat model
+// for combined or unknown slots. Without a model the fallback is a generic template.
+type AskGenerator struct {
+	cfg       AskConfig
+	model     model.BaseChatModel
+	redactor  *privacy.Redactor
+	templates map[string]ask.LanguageTemplates
+}
+
+// NewAskGenerator creates a generator. chatModel may be nil to stay template-only.
+func NewAskGenerator(cfg *AskConfig, chatModel model.BaseChatModel) (*AskGenerator, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("ask config is nil")
+	}
+	templates, err := ask.LoadTemplates()
+	if err != nil {
+		return nil, err
+	}
+	return &AskGenerator{cfg: *cfg, model: chatModel, redactor: privacy.NewRedactor(), templates: templates}, nil
+}
+
+// Generate builds a question for the missing slots of intentName. filled is
+// passed to the model as context and may be nil; its PII is swapped for
+// placeholders in vault first and restored in the question. A nil vault uses
+// a throwaway one.
+func (g *AskGenerator) Generate(ctx context.Context, intentName string, missing []string, filled map[string]string, language string, vault *privacy.Vault) (*Question, error) {
+	if len(missing) == 0 {
+		return nil, fmt.Errorf("no missing slots to ask for")
+	}
+	slots := missing[:1]
+	if g.cfg.MultiSlot {
+		limit := g.cfg.MaxSlotsPerQuestion
+		if limit <= 0 || limit > len(missing) {
+			limit = len(missing)
+		}
+		slots = missing[:limit]
+	}
+
+	lang := g.language(language)
+	tpl := g.templates[lang]
+	q := &Question{Slots: append([]string{}, slots...), Language: lang, Source: SourceTemplate}
+
+	if len(slots) == 1 {
+		if text, ok := slotTemplate(tpl, intentName, slots[0]); ok {
+			q.Text = text
+			return q, nil
+		}
+	}
+
+	if g.model != nil {
+		text, err := g.generateLLM(ctx, intentName, slots, filled, lang, vault)
+		if err == nil && text != "" {
+			q.Text = text
+			q.Source = SourceLLM
+			return q, nil
+		}
+	}
+
+	pattern := tpl.Generic
+	if len(slots) > 1 && allLabelled(tpl, slots) {
+		pattern = tpl.Combined
+	}
+	q.Text = strings.ReplaceAll(pattern, "{{slots}}", joinLabels(tpl, slots))
+	return q, nil
+}
+
+// AskFor generates a question for whatever required slots are still missing in
+// state, records it as pending and counts it as an attempt. Slots that were
+// escalated to offer_choices get their options appended. It returns nil when
+// nothing is missing or the conversation was handed off. vault is the session
+// vault the filled slots are redacted through, see Generate.
+func (g *AskGenerator) AskFor(ctx context.Context, state *DialogueState, required []string, vault *privacy.Vault) (*Question, error) {
+	missing := state.Missing(required)
+	if len(missing) == 0 || state.Handoff {
+		return nil, nil
+	}
+	// a slot escalated to offer_choices is asked on its own so the options fit the question
+	for _, k := range missing {
+		if len(state.OfferedChoices[slotKey(state.ActiveIntent, k)]) > 0 {
+			missing = []string{k}
+			break
+		}
+	}
+	q, err := g.Generate(ctx, state.ActiveIntent, missing, state.Slots.Values(), state.Language, vault)
+	if err != nil {
+		return nil, err
+	}
+	if len(q.Slots) == 1 {
+		if choices := state.OfferedChoices[slotKey(state.ActiveIntent, q.Slots[0])]; len(choices) > 0 {
+			tpl := g.templates[q.Language]
+			q.Text = strings.NewReplacer(
+				"{{question}}", q.Text,
+				"{{choices}}", joinWith(choices, tpl.ChoiceJoiner, tpl.ChoiceLastJoiner),
+			).Replace(tpl.Choices)
+		}
+	}
+	state.AskPending(q.Slots, q.Text)
+	state.recordAsk(q.Slots)
+	return q, nil
+}
+
+// HandoffMessage returns the human-agent handoff message in the given language.
+func (g *AskGenerator) HandoffMessage(language string) string {
+	return g.templates[g.language(language)].Handoff
+}
+
+// ResumePrompt reintroduces the active intent after CompleteIntent popped it
+// from the task stack, e.g. "Back to your iPhone order. Which color would you like?".
+// It re-asks the pending confirmation or question of the resumed task.
+func (g *AskGenerator) ResumePrompt(state *DialogueState) string {
+	tpl := g.templates[g.language(state.Language)]
+	task, ok := tpl.Tasks[state.ActiveIntent]
+	if !ok {
+		task = tpl.TaskDefault
+	}
+	var subject string
+	for _, k := range []string{"product", "model", "brand"} {
+		if s, ok := state.Slots.Slots[k]; ok && s.Value != "" {
+			subject = s.Value
+			break
+		}
+	}
+	var question string
+	switch {
+	case state.Confirmation != nil:
+		question = state.Confirmation.Text
+	case len(state.PendingQuestions) > 0:
+		question = state.PendingQuestions[len(state.PendingQuestions)-1].Text
+	}
+	text := strings.NewReplacer(
+		"{{task}}", task,
+		"{{subject}}", subject,
+		"{{question}}", question,
+	).Replace(tpl.Resume)
+	return strings.Join(strings.Fields(text), " ")
+}
+
+func (g *AskGenerator) generateLLM(ctx context.Context, intentName string, slots []string, filled map[string]string, lang string, vault *privacy.Vault) (string, error) {
+	if vault == nil {
+		vault = privacy.NewVault()
+	}
+	redacted := make(map[string]string, len(filled))
+	for k, v := range filled {
+		redacted[k] = g.redactor.Redact(v, vault)
+	}
+	system, err := ask.RenderAskSystem(ctx, &ask.AskModelInput{
+		IntentName:   intentName,
+		MissingSlots: slots,
+		FilledSlots:  redacted,
+		Language:     lang,
+	})
+	if err != nil {
+		return "", err
+	}
+	out, err := g.model.Generate(ctx, []*schema.Message{
+		schema.SystemMessage(system),
+		schema.UserMessage(strings.Join(slots, ",")),
+	})
+	if err != nil {
+		return "", fmt.Errorf("generate follow-up question: %w", err)
+	}
+	if out == nil {
+		return "", fmt.Errorf("generate follow-up question: empty response")
+	}
+	return vault.Restore(strings.Trim(strings.TrimSpace(out.Content), `"`)), nil
+}
+
+func (g *AskGenerator) language(code string) string {
+	return templateLanguage(g.templates, code, g.cfg.DefaultLanguage)
+}
+
+// templateLanguage maps detected codes such as "th", "tha" or "en" onto a template language.
+func templateLanguage(templates map[string]ask.LanguageTemplates, code, fallback string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	switch code {
+	case "th", "tha", "thai":
+		code = "tha"
+	case "en", "eng", "english":
+		code = "eng"
+	}
+	if _, ok := templates[code]; ok {
+		return code
+	}
+	return fallback
+}
+
+func slotTemplate(tpl ask.LanguageTemplates, intentName, slot string) (string, bool) {
+	if text, ok := tpl.Slots[intentName+"."+slot]; ok && intentName != "" {
+		return text, true
+	}
+	text, ok := tpl.Slots[slot]
+	return text, ok
+}
+
+func allLabelled(tpl ask.LanguageTemplates, slots []string) bool {
+	for _, s := range slots {
+		if _, ok := tpl.Labels[s]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func joinLabels(tpl ask.LanguageTemplates, slots []string) string {
+	labels := make([]string, len(slots))
+	for i, s := range slots {
+		if l, ok := tpl.Labels[s]; ok {
+			labels[i] = l
+		} else {
+			labels[i] = strings.ReplaceAll(s, "_", " ")
+		}
+	}
+	return joinWith(labels, tpl.Joiner, tpl.LastJoiner)
+}
+
+func joinWith(items []string, joiner, lastJoiner string) string {
+	if len(items) <= 1 {
+		return strings.Join(items, "")
+	}
+	return strings.Join(items[:len(items)-1], joiner) + lastJoiner + items[len(items)-1]
+}
@@ -0,0 +1,78 @@
+package dialogue
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/pawarison/eino-multi-modal-poc/config"
+	"github.com/pawarison/eino-multi-modal-poc/llm"
+	"github.com/pawarison/eino-multi-modal-poc/privacy"
+)
+
+func askGenerator(t *testing.T, chatModel *llm.Fake) *AskGenerator {
+	t.Helper()
+	cfg, err := config.New[AskConfig]("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := NewAskGenerator(cfg, chatModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func TestAskForRedactsFilledSlots(t *testing.T) {
+	var system string
+	chatModel := llm.NewFake(func(input []*schema.Message) (string, error) {
+		system = input[0].Content
+		return `"Should the receipt for [EMAIL_1] go to your home address?"`, nil
+	})
+	g := askGenerator(t, chatModel)
+
+	state := NewDialogueState()
+	state.ActiveIntent = "purchase_intent"
+	state.Language = "eng"
+	state.Slots.Slots["contact"] = Slot{Key: "contact", Value: "a.b@example.com"}
+	vault := privacy.NewVault()
+
+	q, err := g.AskFor(context.Background(), state, []string{"contact", "address"}, vault)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(system, "a.b@example.com") || !strings.Contains(system, "contact=[EMAIL_1]") {
+		t.Errorf("ask prompt leaks the filled slot:\n%s", system)
+	}
+	if want := "Should the receipt for a.b@example.com go to your home address?"; q.Text != want || q.Source != SourceLLM {
+		t.Errorf("question = %q from %s, want %q from the model", q.Text, q.Source, want)
+	}
+	if len(state.PendingQuestions) != 1 || state.SlotAttempts["purchase_intent.address"] != 1 {
+		t.Errorf("AskFor did not record the question: %+v %v", state.PendingQuestions, state.SlotAttempts)
+	}
+}
+
+func TestGenerateWithoutVault(t *testing.T) {
+	chatModel := llm.NewScripted("Where should we call you, [PHONE_1]?")
+	g := askGenerator(t, chatModel)
+	q, err := g.Generate(context.Background(), "support_intent", []string{"address"}, map[string]string{"phone": "0812345678"}, "eng", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Text != "Where should we call you, 0812345678?" {
+		t.Errorf("question = %q", q.Text)
+	}
+}
+
+func TestGeneratePrefersTemplates(t *testing.T) {
+	chatModel := llm.NewScripted()
+	g := askGenerator(t, chatModel)
+	q, err := g.Generate(context.Background(), "purchase_intent", []string{"color"}, nil, "en", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Text != "Which color would you like?" || q.Source != SourceTemplate || chatModel.Calls() != 0 {
+		t.Errorf("question = %+v after %d model calls", q, chatModel.Calls())
+	}
+}
@@ -0,0 +1,382 @@
+package dialogue
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/pawarison/eino-multi-modal-poc/prompt/ask"
+)
+
+// ConfirmPolicy lists the intents that need explicit agreement after slot filling.
+type ConfirmPolicy struct {
+	Intents         []string `envconfig:"NLU_CONFIRM_INTENTS" default:"cancel_order,purchase_intent"`
+	DefaultLanguage string   `envconfig:"NLU_ASK_DEFAULT_LANGUAGE" default:"tha"`
+}
+
+// ConfirmOutcome is how a reply to a confirmation question was understood.
+type ConfirmOutcome string
+
+const (
+	ConfirmYes       ConfirmOutcome = "yes"
+	ConfirmNo        ConfirmOutcome = "no"
+	ConfirmCorrected ConfirmOutcome = "corrected"
+	ConfirmUnclear   ConfirmOutcome = "unclear"
+)
+
+// PendingConfirmation is a confirmation question waiting for the user's reply.
+type PendingConfirmation struct {
+	Intent    string   `json:"intent"`
+	Keys      []string `json:"keys"`
+	Text      string   `json:"text"`
+	AskedTurn int      `json:"asked_turn"`
+}
+
+// Correction replaces Old with New in slot Key, e.g. from "no, 3 not 2".
+type Correction struct {
+	Key string
+	Old string
+	New string
+}
+
+// ConfirmResult is the outcome of a confirmation reply. Text is the next bot
+// message: the re-confirmation after a correction, the change prompt after a
+// plain no, or the repeated question when the reply was unclear.
+type ConfirmResult struct {
+	Outcome     ConfirmOutcome
+	Corrections []Correction
+	Text        string
+}
+
+// Confirmer runs the confirmation stage for irreversible intents.
+type Confirmer struct {
+	policy    ConfirmPolicy
+	intents   map[string]bool
+	templates map[string]ask.LanguageTemplates
+}
+
+// NewConfirmer creates a confirmer using the templates in prompt/ask.
+func NewConfirmer(policy *ConfirmPolicy) (*Confirmer, error) {
+	if policy == nil {
+		return nil, fmt.Errorf("confirm policy is nil")
+	}
+	templates, err := ask.LoadTemplates()
+	if err != nil {
+		return nil, err
+	}
+	intents := map[string]bool{}
+	for _, name := range policy.Intents {
+		if name = strings.TrimSpace(name); name != "" {
+			intents[name] = true
+		}
+	}
+	return &Confirmer{policy: *policy, intents: intents, templates: templates}, nil
+}
+
+// Required reports whether intentName needs confirmation.
+func (c *Confirmer) Required(intentName string) bool {
+	return c.intents[intentName]
+}
+
+// Begin starts confirmation for the active intent once its slots are filled.
+// keys orders the summary; other filled slots follow alphabetically. It returns
+// false when the intent needs no confirmation or was already confirmed.
+func (c *Confirmer) Begin(state *DialogueState, keys []string) (string, bool) {
+	if !c.Required(state.ActiveIntent) || state.IntentConfirmed {
+		return "", false
+	}
+	if state.Confirmation != nil {
+		return state.Confirmation.Text, true
+	}
+	ordered := summaryKeys(state.Slots, keys)
+	text := c.summary(state, ordered)
+	state.Confirmation = &PendingConfirmation{
+		Intent:    state.ActiveIntent,
+		Keys:      ordered,
+		Text:      text,
+		AskedTurn: state.Turn,
+	}
+	return text, true
+}
+
+// Handle interprets the user's reply to the pending confirmation. Corrections
+// update the slots and produce a new summary to confirm. A plain no drops the
+// pending confirmation, so the changes the user gives next go through slot
+// filling and Begin summarizes them again.
+func (c *Confirmer) Handle(state *DialogueState, reply string) ConfirmResult {
+	pending := state.Confirmation
+	if pending == nil {
+		return ConfirmResult{Outcome: ConfirmUnclear}
+	}
+	tpl := c.templates[templateLanguage(c.templates, state.Language, c.policy.DefaultLanguage)]
+
+	if corrections := applyCorrections(state, pending.Keys, ParseCorrections(reply)); len(corrections) > 0 {
+		text := c.summary(state, pending.Keys)
+		pending.Text = text
+		pending.AskedTurn = state.Turn
+		return ConfirmResult{Outcome: ConfirmCorrected, Corrections: corrections, Text: text}
+	}
+
+	switch outcome := ParseYesNo(reply); outcome {
+	case ConfirmYes:
+		for _, k := range pending.Keys {
+			state.Slots.Confirm(k)
+		}
+		state.IntentConfirmed = true
+		state.Confirmation = nil
+		return ConfirmResult{Outcome: ConfirmYes}
+	case ConfirmNo:
+		state.Confirmation = nil
+		return ConfirmResult{Outcome: ConfirmNo, Text: tpl.AskChange}
+	default:
+		return ConfirmResult{Outcome: ConfirmUnclear, Text: pending.Text}
+	}
+}
+
+func (c *Confirmer) summary(state *DialogueState, keys []string) string {
+	tpl := c.templates[templateLanguage(c.templates, state.Language, c.policy.DefaultLanguage)]
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		slot, ok := state.Slots.Slots[k]
+		if !ok {
+			continue
+		}
+		label, ok := tpl.Labels[k]
+		if !ok {
+			label = strings.ReplaceAll(k, "_", " ")
+		}
+		pairs = append(pairs, strings.NewReplacer(
+			"{{label}}", label,
+			"{{key}}", strings.ReplaceAll(k, "_", " "),
+			"{{value}}", slot.Value,
+		).Replace(tpl.ConfirmPair))
+	}
+	return strings.ReplaceAll(tpl.Confirm, "{{summary}}", strings.Join(pairs, tpl.ConfirmJoiner))
+}
+
+func summaryKeys(m *SlotMemory, keys []string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, k := range keys {
+		if _, ok := m.Slots[k]; ok && !seen[k] {
+			seen[k] = true
+			out = append(out, k)
+		}
+	}
+	var rest []string
+	for k := range m.Slots {
+		if !seen[k] {
+			rest = append(rest, k)
+		}
+	}
+	sort.Strings(rest)
+	return append(out, rest...)
+}
+
+// replyWord is how a word of a confirmation reply counts.
+type replyWord int
+
+const (
+	wordOther replyWord = iota
+	// wordParticle softens a reply without answering, e.g. "please" or "นะ".
+	wordParticle
+	// wordAck is a polite particle that on its own acknowledges, e.g. "ครับ".
+	wordAck
+	wordYes
+	wordNo
+)
+
+// replyWords are the words a yes/no reply is made of. Thai is written without
+// spaces, so Thai runs are segmented against the Thai entries; longer entries
+// such as "ไม่ใช่" keep "ใช่" from being read inside a refusal.
+var replyWords = map[string]replyWord{
+	"ใช่": wordYes, "ใช่แล้ว": wordYes, "โอเค": wordYes, "ตกลง": wordYes, "ได้": wordYes,
+	"ถูกต้อง": wordYes, "ถูก": wordYes, "ยืนยัน": wordYes, "เอา": wordYes,
+	"ไม่": wordNo, "ไม่ใช่": wordNo, "ไม่เอา": wordNo, "ไม่ได้": wordNo, "ไม่ถูก": wordNo,
+	"ไม่ถูกต้อง": wordNo, "ยกเลิก": wordNo, "ผิด": wordNo,
+	"ครับ": wordAck, "คับ": wordAck, "ค่ะ": wordAck, "ค่า": wordAck, "จ้า": wordAck,
+	"คะ": wordParticle, "นะ": wordParticle, "จ้ะ": wordParticle, "ฮะ": wordParticle, "เลย": wordParticle, "แล้ว": wordParticle,
+
+	"yes": wordYes, "yeah": wordYes, "yep": wordYes, "yup": wordYes, "sure": wordYes, "ok": wordYes, "okay": wordYes,
+	"correct": wordYes, "right": wordYes, "confirm": wordYes, "confirmed": wordYes, "fine": wordYes,
+	"no": wordNo, "nope": wordNo, "nah": wordNo, "wrong": wordNo, "cancel": wordNo, "don't": wordNo, "dont": wordNo, "incorrect": wordNo,
+	"please": wordParticle, "thanks": wordParticle, "thank": wordParticle, "you": wordParticle, "go": wordParticle,
+	"ahead": wordParticle, "it": wordParticle, "that's": wordParticle, "thats": wordParticle, "is": wordParticle, "sir": wordParticle,
+}
+
+// maxThaiReplyWord is the longest Thai entry of replyWords in runes.
+const maxThaiReplyWord = 10
+
+// ParseYesNo classifies a reply as yes, no or unclear. A reply counts only
+// when every word in it is a yes or no word or a particle: "ได้ครับ" is yes
+// and "ไม่ใช่ค่ะ" no, while questions and statements such as "ได้ไหม" or
+// "ไม่มีปัญหา" are unclear and get asked again. No words win over yes words,
+// and polite particles alone, such as "ครับ", acknowledge.
+func ParseYesNo(text string) ConfirmOutcome {
+	var yes, no, ack bool
+	for _, w := range replyTokens(strings.ToLower(text)) {
+		switch w {
+		case wordOther:
+			return ConfirmUnclear
+		case wordYes:
+			yes = true
+		case wordNo:
+			no = true
+		case wordAck:
+			ack = true
+		}
+	}
+	switch {
+	case no:
+		return ConfirmNo
+	case yes, ack:
+		return ConfirmYes
+	}
+	return ConfirmUnclear
+}
+
+// replyTokens splits text into words, cutting between Thai and other scripts,
+// and classifies them. A Thai run that is not made up entirely of replyWords
+// is one wordOther.
+func replyTokens(text string) []replyWord {
+	fields := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '\'' && !unicode.Is(unicode.Mn, r)
+	})
+	var out []replyWord
+	for _, field := range fields {
+		for _, w := range splitScripts(field) {
+			if kind, ok := replyWords[w]; ok {
+				out = append(out, kind)
+			} else if words, ok := segmentThai([]rune(w)); ok {
+				out = append(out, words...)
+			} else {
+				out = append(out, wordOther)
+			}
+		}
+	}
+	return out
+}
+
+// splitScripts cuts a word where it changes between Thai and other letters.
+func splitScripts(word string) []string {
+	var out []string
+	start := 0
+	prevThai := false
+	for i, r := range word {
+		thai := unicode.Is(unicode.Thai, r)
+		if i > 0 && thai != prevThai {
+			out = append(out, word[start:i])
+			start = i
+		}
+		prevThai = thai
+	}
+	return append(out, word[start:])
+}
+
+// segmentThai splits a Thai run into replyWords, preferring longer words, and
+// reports whether the whole run was covered.
+func segmentThai(run []rune) ([]replyWord, bool) {
+	if len(run) == 0 {
+		return nil, true
+	}
+	if !unicode.Is(unicode.Thai, run[0]) {
+		return nil, false
+	}
+	for n := min(len(run), maxThaiReplyWord); n > 0; n-- {
+		kind, ok := replyWords[string(run[:n])]
+		if !ok {
+			continue
+		}
+		if rest, ok := segmentThai(run[n:]); ok {
+			return append([]replyWord{kind}, rest...), true
+		}
+	}
+	return nil, false
+}
+
+// correctionPattern extracts an old and a new value from one correction form.
+type correctionPattern struct {
+	re       *regexp.Regexp
+	oldGroup int
+	newGroup int
+}
+
+var correctionPatterns = []correctionPattern{
+	{regexp.MustCompile(`(?i)\bnot\s+([\p{L}\p{N}]+)\s*,?\s*but\s+([\p{L}\p{N}]+)`), 1, 2},
+	{regexp.MustCompile(`(?i)\bchange\s+([\p{L}\p{N}]+)\s+to\s+([\p{L}\p{N}]+)`), 1, 2},
+	{regexp.MustCompile(`(?i)\b([\p{L}\p{N}]+)\s+not\s+([\p{L}\p{N}]+)`), 2, 1},
+	{regexp.MustCompile(`ไม่ใช่\s*([^\s,]+?)\s*(?:แต่)?เป็น\s*([^\s,]+)`), 1, 2},
+	{regexp.MustCompile(`เปลี่ยน(?:จาก)?\s*([^\s,]+?)\s*เป็น\s*([^\s,]+)`), 1, 2},
+	{regexp.MustCompile(`([^\s,]+?)\s*ไม่ใช่\s*([^\s,]+)`), 2, 1},
+}
+
+// ParseCorrections extracts "3 not 2" style corrections from a reply. Key is
+// left empty; it is resolved against the slots being confirmed.
+func ParseCorrections(text string) []Correction {
+	for _, p := range correctionPatterns {
+		var out []Correction
+		for _, m := range p.re.FindAllStringSubmatch(text, -1) {
+			oldVal, newVal := trimParticles(m[p.oldGroup]), trimParticles(m[p.newGroup])
+			if oldVal == "" || newVal == "" || strings.EqualFold(oldVal, newVal) {
+				continue
+			}
+			if kind := replyWords[strings.ToLower(newVal)]; kind == wordYes || kind == wordNo {
+				continue
+			}
+			out = append(out, Correction{Old: oldVal, New: newVal})
+		}
+		if len(out) > 0 {
+			return out
+		}
+	}
+	return nil
+}
+
+// applyCorrections resolves each correction against the slots in keys, first
+// by whole value and then by a single word inside the value, and applies it.
+func applyCorrections(state *DialogueState, keys []string, corrections []Correction) []Correction {
+	var applied []Correction
+	for _, c := range corrections {
+		for _, k := range keys {
+			slot, ok := state.Slots.Slots[k]
+			if !ok {
+				continue
+			}
+			value, matched := replaceValue(slot.Value, c.Old, c.New)
+			if !matched {
+				continue
+			}
+			slot.Value = value
+			slot.Confidence = 1
+			slot.Turn = state.Turn
+			state.Slots.Slots[k] = slot
+			applied = append(applied, Correction{Key: k, Old: c.Old, New: c.New})
+			break
+		}
+	}
+	return applied
+}
+
+func replaceValue(value, oldVal, newVal string) (string, bool) {
+	if strings.EqualFold(strings.TrimSpace(value), oldVal) {
+		return newVal, true
+	}
+	words := strings.Fields(value)
+	for i, w := range words {
+		if strings.EqualFold(w, oldVal) {
+			words[i] = newVal
+			return strings.Join(words, " "), true
+		}
+	}
+	return value, false
+}
+
+func trimParticles(s string) string {
+	s = strings.TrimSpace(s)
+	for _, p := range []string{"ครับ", "ค่ะ", "คะ", "นะ"} {
+		s = strings.TrimSuffix(s, p)
+	}
+	return strings.Trim(s, ".,!? ")
+}
@@ -0,0 +1,116 @@
+package dialogue
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pawarison/eino-multi-modal-poc/config"
+)
+
+func TestParseYesNo(t *testing.T) {
+	tests := []struct {
+		reply string
+		want  ConfirmOutcome
+	}{
+		{"yes", ConfirmYes},
+		{"Yes please, go ahead!", ConfirmYes},
+		{"ok", ConfirmYes},
+		{"ใช่", ConfirmYes},
+		{"ได้ครับ", ConfirmYes},
+		{"ใช่ค่ะ", ConfirmYes},
+		{"โอเคเลย", ConfirmYes},
+		{"ตกลงครับ ยืนยันครับ", ConfirmYes},
+		{"okครับ", ConfirmYes},
+		{"ครับ", ConfirmYes},
+		{"no", ConfirmNo},
+		{"no thanks", ConfirmNo},
+		{"ไม่ครับ", ConfirmNo},
+		{"ไม่ใช่ค่ะ", ConfirmNo},
+		{"ไม่เอาแล้ว", ConfirmNo},
+		{"ยกเลิก", ConfirmNo},
+		{"ผิดครับ", ConfirmNo},
+		{"no, ok", ConfirmNo},
+
+		// questions and statements that only contain a yes or no word
+		{"ส่งกี่วันครับ", ConfirmUnclear},
+		{"ได้ไหม", ConfirmUnclear},
+		{"คะแนน", ConfirmUnclear},
+		{"ไม่มีปัญหา", ConfirmUnclear},
+		{"ไม่มีปัญหาครับ", ConfirmUnclear},
+		{"เอาไหมคะ", ConfirmUnclear},
+		{"how long is delivery?", ConfirmUnclear},
+		{"not sure", ConfirmUnclear},
+		{"คะ", ConfirmUnclear},
+		{"please", ConfirmUnclear},
+		{"", ConfirmUnclear},
+	}
+	for _, tt := range tests {
+		if got := ParseYesNo(tt.reply); got != tt.want {
+			t.Errorf("ParseYesNo(%q) = %s, want %s", tt.reply, got, tt.want)
+		}
+	}
+}
+
+func TestParseCorrections(t *testing.T) {
+	tests := []struct {
+		reply string
+		want  []Correction
+	}{
+		{"no, 3 not 2", []Correction{{Old: "2", New: "3"}}},
+		{"not black but white", []Correction{{Old: "black", New: "white"}}},
+		{"change black to white", []Correction{{Old: "black", New: "white"}}},
+		{"ไม่ใช่ดำ เป็นขาวครับ", []Correction{{Old: "ดำ", New: "ขาว"}}},
+		{"เปลี่ยนจากดำเป็นขาว", []Correction{{Old: "ดำ", New: "ขาว"}}},
+		{"yes", nil},
+		{"not yes", nil},
+	}
+	for _, tt := range tests {
+		if got := ParseCorrections(tt.reply); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseCorrections(%q) = %+v, want %+v", tt.reply, got, tt.want)
+		}
+	}
+}
+
+func TestConfirmerHandle(t *testing.T) {
+	policy, err := config.New[ConfirmPolicy]("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewConfirmer(policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := NewDialogueState()
+	state.ActiveIntent = "purchase_intent"
+	state.Language = "eng"
+	state.Slots.Slots["product"] = Slot{Key: "product", Value: "iPhone"}
+	state.Slots.Slots["quantity"] = Slot{Key: "quantity", Value: "2"}
+	if _, ok := c.Begin(state, []string{"product", "quantity"}); !ok {
+		t.Fatal("purchase_intent needs no confirmation")
+	}
+
+	if res := c.Handle(state, "ส่งกี่วันครับ"); res.Outcome != ConfirmUnclear || res.Text != state.Confirmation.Text {
+		t.Errorf("question = %+v, want the summary asked again", res)
+	}
+	res := c.Handle(state, "no, 3 not 2")
+	if res.Outcome != ConfirmCorrected || state.Slots.Slots["quantity"].Value != "3" {
+		t.Fatalf("correction = %+v, quantity %q", res, state.Slots.Slots["quantity"].Value)
+	}
+	if res := c.Handle(state, "yes"); res.Outcome != ConfirmYes || !state.IntentConfirmed || state.Confirmation != nil {
+		t.Errorf("yes = %+v, confirmed %v", res, state.IntentConfirmed)
+	}
+	if !state.Slots.Slots["quantity"].Confirmed {
+		t.Error("confirmed slots are not marked")
+	}
+
+	state.IntentConfirmed = false
+	c.Begin(state, []string{"product", "quantity"})
+	if res := c.Handle(state, "no"); res.Outcome != ConfirmNo || res.Text == "" || state.Confirmation != nil {
+		t.Errorf("no = %+v, pending %+v, want the change prompt and nothing pending", res, state.Confirmation)
+	}
+	state.Slots.Slots["product"] = Slot{Key: "product", Value: "iPad"}
+	if text, ok := c.Begin(state, []string{"product", "quantity"}); !ok || !strings.Contains(text, "iPad") {
+		t.Errorf("summary after a change = %q, want the new product", text)
+	}
+}
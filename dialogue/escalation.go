@@ -0,0 +1,265 @@
+package dialogue
+
+import (
+	"strings"
+	"time"
+)
+
+// EscalationAction is what happens when a slot or intent runs out of attempts.
+type EscalationAction string
+
+const (
+	// EscalateSkip stops asking for an optional slot.
+	EscalateSkip EscalationAction = "skip"
+	// EscalateOfferChoices re-asks with a fixed list of choices.
+	EscalateOfferChoices EscalationAction = "offer_choices"
+	// EscalateHandoff hands the conversation to a human agent.
+	EscalateHandoff EscalationAction = "handoff"
+)
+
+// EscalationPolicy configures retry limits for slot filling.
+type EscalationPolicy struct {
+	// MaxSlotAttempts is how many times one slot is asked before escalating.
+	MaxSlotAttempts int `envconfig:"NLU_ESCALATE_MAX_SLOT_ATTEMPTS" default:"3"`
+	// MaxIntentAttempts is how many follow-up questions one intent may ask in total.
+	MaxIntentAttempts int `envconfig:"NLU_ESCALATE_MAX_INTENT_ATTEMPTS" default:"6"`
+	// SlotActions maps slot to action; slots mapped to skip are treated as optional.
+	SlotActions map[string]string `envconfig:"NLU_ESCALATE_SLOT_ACTIONS" default:"brand:skip,warranty:skip,delivery:skip,color:offer_choices"`
+	// Choices maps slot to "|"-separated options offered by offer_choices.
+	Choices map[string]string `envconfig:"NLU_ESCALATE_CHOICES" default:"color:black|white|blue"`
+	// IntentActions maps intent to the action taken when it runs out of
+	// attempts: skip its missing slots, offer choices for them, or hand off.
+	IntentActions map[string]string `envconfig:"NLU_ESCALATE_INTENT_ACTIONS"`
+	// DefaultAction applies to slots without an entry in SlotActions and
+	// intents without one in IntentActions.
+	DefaultAction string `envconfig:"NLU_ESCALATE_DEFAULT_ACTION" default:"handoff"`
+}
+
+// EscalationEvent is a structured record of an escalation.
+type EscalationEvent struct {
+	Type     string           `json:"type"` // slot_attempts_exceeded | intent_attempts_exceeded
+	Intent   string           `json:"intent"`
+	Slot     string           `json:"slot,omitempty"`
+	Attempts int              `json:"attempts"`
+	Action   EscalationAction `json:"action"`
+	Choices  []string         `json:"choices,omitempty"`
+	Turn     int              `json:"turn"`
+	At       time.Time        `json:"at"`
+}
+
+const (
+	EventSlotAttemptsExceeded   = "slot_attempts_exceeded"
+	EventIntentAttemptsExceeded = "intent_attempts_exceeded"
+)
+
+// Escalate checks the attempt counters of the active intent against policy,
+// applies the resulting actions to state and records them in state.Events.
+// It returns the events raised this turn.
+func Escalate(state *DialogueState, required []string, policy EscalationPolicy) []EscalationEvent {
+	if state.ActiveIntent == "" || state.Handoff {
+		return nil
+	}
+	now := time.Now()
+	var events []EscalationEvent
+
+	if policy.MaxIntentAttempts > 0 {
+		missing := state.Missing(required)
+		if n := state.IntentAttempts[state.ActiveIntent]; n >= policy.MaxIntentAttempts && len(missing) > 0 {
+			event := func(slot string, action EscalationAction, choices []string) EscalationEvent {
+				return EscalationEvent{
+					Type:     EventIntentAttemptsExceeded,
+					Intent:   state.ActiveIntent,
+					Slot:     slot,
+					Attempts: n,
+					Action:   action,
+					Choices:  choices,
+					Turn:     state.Turn,
+					At:       now,
+				}
+			}
+			switch policy.intentAction(state.ActiveIntent) {
+			case EscalateSkip:
+				for _, slot := range missing {
+					events = append(events, event(slot, EscalateSkip, nil))
+				}
+			case EscalateOfferChoices:
+				for _, slot := range missing {
+					if _, offered := state.OfferedChoices[slotKey(state.ActiveIntent, slot)]; offered {
+						continue
+					}
+					if choices := policy.choices(slot); len(choices) > 0 {
+						events = append(events, event(slot, EscalateOfferChoices, choices))
+					}
+				}
+			}
+			// nothing left to skip or offer
+			if len(events) == 0 {
+				events = append(events, event("", EscalateHandoff, nil))
+			}
+		}
+	}
+
+	if len(events) == 0 && policy.MaxSlotAttempts > 0 {
+		for _, slot := range state.Missing(required) {
+			n := state.SlotAttempts[slotKey(state.ActiveIntent, slot)]
+			if n < policy.MaxSlotAttempts {
+				continue
+			}
+			action, choices := policy.action(slot)
+			if action == EscalateOfferChoices {
+				if _, offered := state.OfferedChoices[slotKey(state.ActiveIntent, slot)]; offered {
+					// choices were already offered and ignored as well
+					action, choices = EscalateHandoff, nil
+				}
+			}
+			events = append(events, EscalationEvent{
+				Type:     EventSlotAttemptsExceeded,
+				Intent:   state.ActiveIntent,
+				Slot:     slot,
+				Attempts: n,
+				Action:   action,
+				Choices:  choices,
+				Turn:     state.Turn,
+				At:       now,
+			})
+		}
+	}
+
+	for _, ev := range events {
+		state.applyEscalation(ev)
+	}
+	return events
+}
+
+// action resolves the configured action of a slot. offer_choices without
+// configured choices falls back to the default action.
+func (p EscalationPolicy) action(slot string) (EscalationAction, []string) {
+	action := EscalationAction(strings.TrimSpace(p.SlotActions[slot]))
+	if action == "" {
+		action = EscalationAction(strings.TrimSpace(p.DefaultAction))
+	}
+	switch action {
+	case EscalateSkip:
+		return EscalateSkip, nil
+	case EscalateOfferChoices:
+		if choices := p.choices(slot); len(choices) > 0 {
+			return EscalateOfferChoices, choices
+		}
+		if EscalationAction(p.DefaultAction) == EscalateSkip {
+			return EscalateSkip, nil
+		}
+	}
+	return EscalateHandoff, nil
+}
+
+// intentAction resolves the configured action of an intent. Unknown actions
+// hand off.
+func (p EscalationPolicy) intentAction(intentName string) EscalationAction {
+	action := EscalationAction(strings.TrimSpace(p.IntentActions[intentName]))
+	if action == "" {
+		action = EscalationAction(strings.TrimSpace(p.DefaultAction))
+	}
+	switch action {
+	case EscalateSkip, EscalateOfferChoices:
+		return action
+	}
+	return EscalateHandoff
+}
+
+// choices returns the configured options of slot.
+func (p EscalationPolicy) choices(slot string) []string {
+	var out []string
+	for _, c := range strings.Split(p.Choices[slot], "|") {
+		if c = strings.TrimSpace(c); c != "" {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func (s *DialogueState) applyEscalation(ev EscalationEvent) {
+	s.ensureCounters()
+	key := slotKey(ev.Intent, ev.Slot)
+	switch ev.Action {
+	case EscalateSkip:
+		s.SkippedSlots[key] = true
+	case EscalateOfferChoices:
+		s.OfferedChoices[key] = ev.Choices
+		// choices get one more round of attempts
+		s.SlotAttempts[key] = 0
+		if ev.Type == EventIntentAttemptsExceeded {
+			s.IntentAttempts[ev.Intent] = 0
+		}
+	case EscalateHandoff:
+		s.Handoff = true
+		s.PendingQuestions = nil
+	}
+	s.Events = append(s.Events, ev)
+}
+
+// recordAsk counts a follow-up question against its slots and the active intent.
+func (s *DialogueState) recordAsk(slots []string) {
+	s.ensureCounters()
+	s.IntentAttempts[s.ActiveIntent]++
+	for _, slot := range slots {
+		s.SlotAttempts[slotKey(s.ActiveIntent, slot)]++
+	}
+}
+
+// resetIntent forgets the attempts, skips and offered choices of intentName
+// and lifts a handoff, so the next run of the intent starts afresh.
+func (s *DialogueState) resetIntent(intentName string) {
+	if intentName == "" {
+		return
+	}
+	delete(s.IntentAttempts, intentName)
+	prefix := slotKey(intentName, "")
+	for k := range s.SlotAttempts {
+		if strings.HasPrefix(k, prefix) {
+			delete(s.SlotAttempts, k)
+		}
+	}
+	for k := range s.SkippedSlots {
+		if strings.HasPrefix(k, prefix) {
+			delete(s.SkippedSlots, k)
+		}
+	}
+	for k := range s.OfferedChoices {
+		if strings.HasPrefix(k, prefix) {
+			delete(s.OfferedChoices, k)
+		}
+	}
+	s.Handoff = false
+}
+
+// resetFilled forgets the attempts and offered choices of the active intent's
+// slots that now have a value.
+func (s *DialogueState) resetFilled() {
+	for k, slot := range s.Slots.Slots {
+		if slot.Value == "" {
+			continue
+		}
+		key := slotKey(s.ActiveIntent, k)
+		delete(s.SlotAttempts, key)
+		delete(s.OfferedChoices, key)
+	}
+}
+
+func (s *DialogueState) ensureCounters() {
+	if s.SlotAttempts == nil {
+		s.SlotAttempts = map[string]int{}
+	}
+	if s.IntentAttempts == nil {
+		s.IntentAttempts = map[string]int{}
+	}
+	if s.SkippedSlots == nil {
+		s.SkippedSlots = map[string]bool{}
+	}
+	if s.OfferedChoices == nil {
+		s.OfferedChoices = map[string][]string{}
+	}
+}
+
+func slotKey(intentName, slot string) string {
+	return intentName + "." + slot
+}
@@ -0,0 +1,191 @@
+package dialogue
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pawarison/eino-multi-modal-poc/config"
+)
+
+func escalationPolicy(t *testing.T) EscalationPolicy {
+	t.Helper()
+	policy, err := config.New[EscalationPolicy]("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *policy
+}
+
+func TestEscalateSlotActions(t *testing.T) {
+	policy := escalationPolicy(t)
+	state := NewDialogueState()
+	MergeState(state, detected("purchase_intent", 0.9, 0.8), mergePolicy(t))
+	required := []string{"brand", "color"}
+	for range 3 {
+		state.recordAsk([]string{"brand", "color"})
+	}
+
+	events := Escalate(state, required, policy)
+	if len(events) != 2 || events[0].Action != EscalateSkip || events[1].Action != EscalateOfferChoices {
+		t.Fatalf("events = %+v, want skip brand and offer color choices", events)
+	}
+	if got := state.Missing(required); !reflect.DeepEqual(got, []string{"color"}) {
+		t.Errorf("missing = %v, want the skipped brand gone", got)
+	}
+	if got := state.OfferedChoices["purchase_intent.color"]; !reflect.DeepEqual(got, []string{"black", "white", "blue"}) {
+		t.Errorf("choices = %v", got)
+	}
+
+	for range 3 {
+		state.recordAsk([]string{"color"})
+	}
+	events = Escalate(state, required, policy)
+	if len(events) != 1 || events[0].Action != EscalateHandoff || !state.Handoff {
+		t.Errorf("ignored choices = %+v, handoff %v, want a handoff", events, state.Handoff)
+	}
+}
+
+func TestEscalateIntentAttempts(t *testing.T) {
+	policy := escalationPolicy(t)
+	policy.MaxSlotAttempts = 0
+	state := NewDialogueState()
+	MergeState(state, detected("purchase_intent", 0.9, 0.8), mergePolicy(t))
+	for range policy.MaxIntentAttempts {
+		state.recordAsk([]string{"product"})
+	}
+	events := Escalate(state, []string{"product"}, policy)
+	if len(events) != 1 || events[0].Type != EventIntentAttemptsExceeded || !state.Handoff {
+		t.Errorf("events = %+v, want an intent handoff", events)
+	}
+}
+
+func TestEscalateIntentActions(t *testing.T) {
+	required := []string{"product", "color"}
+	exhaust := func(t *testing.T, policy EscalationPolicy) (*DialogueState, []EscalationEvent) {
+		t.Helper()
+		state := NewDialogueState()
+		MergeState(state, detected("purchase_intent", 0.9, 0.8), mergePolicy(t))
+		for range policy.MaxIntentAttempts {
+			state.recordAsk([]string{"product"})
+		}
+		return state, Escalate(state, required, policy)
+	}
+	actions := func(events []EscalationEvent) []string {
+		var out []string
+		for _, ev := range events {
+			out = append(out, ev.Slot+":"+string(ev.Action))
+		}
+		return out
+	}
+
+	t.Run("skip", func(t *testing.T) {
+		policy := escalationPolicy(t)
+		policy.IntentActions = map[string]string{"purchase_intent": "skip"}
+		state, events := exhaust(t, policy)
+		if got := actions(events); !reflect.DeepEqual(got, []string{"product:skip", "color:skip"}) || state.Handoff {
+			t.Errorf("events = %v, handoff %v", got, state.Handoff)
+		}
+		if missing := state.Missing(required); len(missing) != 0 {
+			t.Errorf("missing = %v, want every slot skipped", missing)
+		}
+	})
+
+	t.Run("offer choices then hand off", func(t *testing.T) {
+		policy := escalationPolicy(t)
+		policy.IntentActions = map[string]string{"purchase_intent": "offer_choices"}
+		state, events := exhaust(t, policy)
+		if got := actions(events); !reflect.DeepEqual(got, []string{"color:offer_choices"}) || state.Handoff {
+			t.Fatalf("events = %v, handoff %v", got, state.Handoff)
+		}
+		if state.IntentAttempts["purchase_intent"] != 0 {
+			t.Errorf("offering choices kept %d intent attempts", state.IntentAttempts["purchase_intent"])
+		}
+		for range policy.MaxIntentAttempts {
+			state.recordAsk([]string{"color"})
+		}
+		if got := actions(Escalate(state, required, policy)); !reflect.DeepEqual(got, []string{":handoff"}) || !state.Handoff {
+			t.Errorf("ignored choices = %v, handoff %v", got, state.Handoff)
+		}
+	})
+
+	t.Run("default action", func(t *testing.T) {
+		policy := escalationPolicy(t)
+		policy.DefaultAction = "skip"
+		policy.IntentActions = map[string]string{"inquiry_intent": "handoff"}
+		state, events := exhaust(t, policy)
+		if len(events) != 2 || state.Handoff {
+			t.Errorf("events = %v, want the default skip", actions(events))
+		}
+	})
+}
+
+func TestCountersResetWithTheIntent(t *testing.T) {
+	policy := escalationPolicy(t)
+	merge := mergePolicy(t)
+	required := []string{"product", "color"}
+
+	exhaust := func(state *DialogueState) {
+		t.Helper()
+		for range policy.MaxIntentAttempts {
+			state.recordAsk(required)
+		}
+		Escalate(state, required, policy)
+		if !state.Handoff {
+			t.Fatal("no handoff after exhausting the attempts")
+		}
+	}
+
+	t.Run("switch", func(t *testing.T) {
+		state := NewDialogueState()
+		MergeState(state, detected("purchase_intent", 0.9, 0.8), merge)
+		exhaust(state)
+		MergeState(state, detected("inquiry_intent", 0.9, 0.7), merge)
+		if state.Handoff || len(state.SlotAttempts) != 0 || len(state.IntentAttempts) != 0 || len(state.SkippedSlots) != 0 {
+			t.Errorf("switch kept counters: handoff %v, %v %v %v", state.Handoff, state.SlotAttempts, state.IntentAttempts, state.SkippedSlots)
+		}
+	})
+
+	t.Run("restart after completion", func(t *testing.T) {
+		state := NewDialogueState()
+		MergeState(state, detected("purchase_intent", 0.9, 0.8), merge)
+		exhaust(state)
+		state.CompleteIntent()
+		if state.Handoff || len(state.SlotAttempts) != 0 || len(state.IntentAttempts) != 0 {
+			t.Fatalf("CompleteIntent kept counters: %v %v", state.SlotAttempts, state.IntentAttempts)
+		}
+		MergeState(state, detected("purchase_intent", 0.9, 0.8), merge)
+		if events := Escalate(state, required, policy); len(events) != 0 {
+			t.Errorf("a fresh run escalated at once: %+v", events)
+		}
+	})
+
+	t.Run("preempt keeps the interrupted intent", func(t *testing.T) {
+		state := NewDialogueState()
+		MergeState(state, detected("inquiry_intent", 0.9, 0.7), merge)
+		state.recordAsk([]string{"product"})
+		state.AskPending([]string{"product"}, "Which product?")
+		MergeState(state, detected("purchase_intent", 0.9, 0.8), merge)
+		if state.SlotAttempts["inquiry_intent.product"] != 1 || state.IntentAttempts["inquiry_intent"] != 1 {
+			t.Errorf("preempt dropped the counters of the interrupted intent: %v", state.SlotAttempts)
+		}
+	})
+}
+
+func TestFilledSlotResetsItsCounter(t *testing.T) {
+	state := NewDialogueState()
+	MergeState(state, detected("purchase_intent", 0.9, 0.8), mergePolicy(t))
+	state.recordAsk([]string{"product", "color"})
+	state.recordAsk([]string{"product", "color"})
+	state.AskPending([]string{"product", "color"}, "Which product and color?")
+
+	state.Slots.Slots["color"] = Slot{Key: "color", Value: "blue"}
+	state.ClearPending()
+
+	want := map[string]int{"purchase_intent.product": 2}
+	if !reflect.DeepEqual(state.SlotAttempts, want) {
+		t.Errorf("slot attempts = %v, want %v", state.SlotAttempts, want)
+	}
+	if len(state.PendingQuestions) != 1 {
+		t.Errorf("pending = %+v, want the product question kept", state.PendingQuestions)
+	}
+}
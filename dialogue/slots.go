@@ -0,0 +1,278 @@
+package dialogue
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	entity "github.com/pawarison/eino-multi-modal-poc/prompt/entity"
+)
+
+// SlotPolicy controls how new entity spans are merged into accumulated slots.
+type SlotPolicy struct {
+	// MinConfidence drops spans below this confidence (matches EntityOutput.MissingKeys).
+	MinConfidence float64 `envconfig:"NLU_SLOT_MIN_CONFIDENCE" default:"0.5"`
+	// OverwriteConfidence is the confidence a new value needs to replace a confirmed slot
+	// without asking the user first.
+	OverwriteConfidence float64 `envconfig:"NLU_SLOT_OVERWRITE_CONFIDENCE" default:"0.85"`
+	// ReferentKeys are the slots that anaphora such as "that one" or "อันนั้น" point back to.
+	ReferentKeys []string `envconfig:"NLU_SLOT_REFERENT_KEYS" default:"product,model"`
+}
+
+// Slot is a single accumulated entity value.
+type Slot struct {
+	Key        string  `json:"key"`
+	Value      string  `json:"value"`
+	Confidence float64 `json:"confidence"`
+	Turn       int     `json:"turn"`
+	Confirmed  bool    `json:"confirmed"`
+}
+
+// SlotConflict is a new value that disagrees with a confirmed slot and needs
+// the user's confirmation before it replaces it.
+type SlotConflict struct {
+	Key      string `json:"key"`
+	Current  Slot   `json:"current"`
+	Proposed Slot   `json:"proposed"`
+}
+
+// Anaphor is a referring expression in the user message resolved against a slot.
+type Anaphor struct {
+	Phrase string `json:"phrase"`
+	Start  int    `json:"start"`
+	End    int    `json:"end"`
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+}
+
+// SlotUpdate reports what a single Merge changed.
+type SlotUpdate struct {
+	Filled      []string
+	Overwritten []string
+	Conflicts   []SlotConflict
+	Anaphora    []Anaphor
+}
+
+// SlotMemory accumulates entity values across the turns of a session.
+type SlotMemory struct {
+	Slots   map[string]Slot         `json:"slots"`
+	Pending map[string]SlotConflict `json:"pending,omitempty"`
+}
+
+// NewSlotMemory creates an empty slot memory.
+func NewSlotMemory() *SlotMemory {
+	return &SlotMemory{
+		Slots:   map[string]Slot{},
+		Pending: map[string]SlotConflict{},
+	}
+}
+
+// Merge folds the entity output of one turn into the accumulated slots.
+//
+// Rules, per entity type:
+//   - spans below policy.MinConfidence are ignored; the best remaining span wins
+//   - an empty slot is filled
+//   - the same value refreshes the slot's turn and keeps the higher confidence
+//   - a different value overwrites an unconfirmed slot, but a confirmed slot is only
+//     overwritten at policy.OverwriteConfidence or above; otherwise it becomes a
+//     pending conflict that the caller should confirm with the user
+//
+// Anaphora in message are resolved against policy.ReferentKeys when the turn
+// itself did not mention those keys.
+func (m *SlotMemory) Merge(turn int, message string, out *entity.EntityOutput, policy SlotPolicy) SlotUpdate {
+	m.ensure()
+	update := SlotUpdate{}
+
+	mentioned := map[string]bool{}
+	if out != nil {
+		for _, key := range spanKeys(out) {
+			best, ok := bestSpan(out.EntitiesByType(key), policy.MinConfidence)
+			if !ok {
+				continue
+			}
+			mentioned[key] = true
+			proposed := Slot{
+				Key:        key,
+				Value:      strings.TrimSpace(best.Raw),
+				Confidence: best.Confidence,
+				Turn:       turn,
+			}
+
+			current, exists := m.Slots[key]
+			switch {
+			case !exists:
+				m.Slots[key] = proposed
+				update.Filled = append(update.Filled, key)
+			case strings.EqualFold(current.Value, proposed.Value):
+				current.Turn = turn
+				if proposed.Confidence > current.Confidence {
+					current.Confidence = proposed.Confidence
+				}
+				m.Slots[key] = current
+			case current.Confirmed && proposed.Confidence < policy.OverwriteConfidence:
+				conflict := SlotConflict{Key: key, Current: current, Proposed: proposed}
+				m.Pending[key] = conflict
+				update.Conflicts = append(update.Conflicts, conflict)
+			default:
+				m.Slots[key] = proposed
+				delete(m.Pending, key)
+				update.Overwritten = append(update.Overwritten, key)
+			}
+		}
+	}
+
+	for _, a := range m.ResolveAnaphora(message, policy.ReferentKeys) {
+		if mentioned[a.Key] {
+			continue
+		}
+		slot := m.Slots[a.Key]
+		slot.Turn = turn
+		m.Slots[a.Key] = slot
+		update.Anaphora = append(update.Anaphora, a)
+	}
+
+	return update
+}
+
+// ResolveAnaphora finds referring expressions in message and binds each one to
+// the first filled key in referentKeys. Offsets are rune indices like EntitySpan.
+func (m *SlotMemory) ResolveAnaphora(message string, referentKeys []string) []Anaphor {
+	var target *Slot
+	for _, k := range referentKeys {
+		if s, ok := m.Slots[k]; ok && s.Value != "" {
+			target = &s
+			break
+		}
+	}
+	if target == nil {
+		return nil
+	}
+
+	var out []Anaphor
+	for _, loc := range anaphorPattern.FindAllStringIndex(message, -1) {
+		out = append(out, Anaphor{
+			Phrase: message[loc[0]:loc[1]],
+			Start:  utf8.RuneCountInString(message[:loc[0]]),
+			End:    utf8.RuneCountInString(message[:loc[1]]),
+			Key:    target.Key,
+			Value:  target.Value,
+		})
+	}
+	return out
+}
+
+// Confirm marks a slot as confirmed by the user.
+func (m *SlotMemory) Confirm(key string) {
+	m.ensure()
+	if s, ok := m.Slots[key]; ok {
+		s.Confirmed = true
+		m.Slots[key] = s
+	}
+}
+
+// ResolveConflict applies or discards a pending conflict for key.
+func (m *SlotMemory) ResolveConflict(key string, accept bool) {
+	m.ensure()
+	conflict, ok := m.Pending[key]
+	if !ok {
+		return
+	}
+	delete(m.Pending, key)
+	if accept {
+		proposed := conflict.Proposed
+		proposed.Confirmed = true
+		m.Slots[key] = proposed
+	}
+}
+
+// Clear forgets a slot.
+func (m *SlotMemory) Clear(key string) {
+	m.ensure()
+	delete(m.Slots, key)
+	delete(m.Pending, key)
+}
+
+// Values returns the filled slots as key=value, ready for EntityModelInput.FilledSlots.
+func (m *SlotMemory) Values() map[string]string {
+	out := make(map[string]string, len(m.Slots))
+	for k, s := range m.Slots {
+		out[k] = s.Value
+	}
+	return out
+}
+
+// FilledKeys returns the filled slot keys in sorted order.
+func (m *SlotMemory) FilledKeys() []string {
+	keys := make([]string, 0, len(m.Slots))
+	for k := range m.Slots {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Missing returns the required keys that have no accumulated value.
+func (m *SlotMemory) Missing(required []string) []string {
+	miss := []string{}
+	for _, k := range required {
+		if s, ok := m.Slots[k]; !ok || s.Value == "" {
+			miss = append(miss, k)
+		}
+	}
+	return miss
+}
+
+// clone returns a copy that shares nothing with m.
+func (m *SlotMemory) clone() *SlotMemory {
+	cp := NewSlotMemory()
+	for k, s := range m.Slots {
+		cp.Slots[k] = s
+	}
+	for k, c := range m.Pending {
+		cp.Pending[k] = c
+	}
+	return cp
+}
+
+func (m *SlotMemory) ensure() {
+	if m.Slots == nil {
+		m.Slots = map[string]Slot{}
+	}
+	if m.Pending == nil {
+		m.Pending = map[string]SlotConflict{}
+	}
+}
+
+// anaphorPattern matches English and Thai expressions that refer back to an
+// earlier mentioned item, e.g. "that one", "the blue one", "อันนั้น", "รุ่นเดิม".
+var anaphorPattern = regexp.MustCompile(`(?i)\b(?:that|this|the same|the other|same) (?:one|model|item)\b|\bthe same\b|\bthe \p{L}+ one\b|(?:อัน|ตัว|รุ่น|เครื่อง|แบบ|ชิ้น)(?:นั้น|นี้|เดิม)`)
+
+// spanKeys lists entity types in order of first appearance.
+func spanKeys(out *entity.EntityOutput) []string {
+	seen := map[string]bool{}
+	var keys []string
+	for _, e := range out.Entities {
+		if !seen[e.Type] {
+			seen[e.Type] = true
+			keys = append(keys, e.Type)
+		}
+	}
+	return keys
+}
+
+// bestSpan picks the highest-confidence span, preferring the later one on ties.
+func bestSpan(spans []entity.EntitySpan, minConfidence float64) (entity.EntitySpan, bool) {
+	var best entity.EntitySpan
+	found := false
+	for _, s := range spans {
+		if s.Confidence < minConfidence || strings.TrimSpace(s.Raw) == "" {
+			continue
+		}
+		if !found || s.Confidence >= best.Confidence {
+			best = s
+			found = true
+		}
+	}
+	return best, found
+}
@@ -0,0 +1,104 @@
+package dialogue
+
+// TaskFrame is an interrupted intent kept on the task stack so the bot can
+// return to it after a digression.
+type TaskFrame struct {
+	Intent           string               `json:"intent"`
+	Priority         float64              `json:"priority"`
+	PendingQuestions []PendingQuestion    `json:"pending_questions"`
+	Confirmation     *PendingConfirmation `json:"confirmation,omitempty"`
+	IntentConfirmed  bool                 `json:"intent_confirmed"`
+	IntentStartTurn  int                  `json:"intent_start_turn"`
+	// Slots is the slot memory when the task was interrupted; it replaces
+	// whatever the digression filled when the task resumes.
+	Slots       *SlotMemory `json:"slots,omitempty"`
+	PushedTurn  int         `json:"pushed_turn"`
+	ExpiresTurn int         `json:"expires_turn"`
+}
+
+// CompleteIntent finishes the active intent, forgetting its attempt counters,
+// and pops the innermost live task from the stack back into the state. It
+// returns the resumed frame, or nil when there is nothing to return to.
+func (s *DialogueState) CompleteIntent() *TaskFrame {
+	s.resetIntent(s.ActiveIntent)
+	s.ActiveIntent = ""
+	s.ActivePriority = 0
+	s.PendingQuestions = nil
+	s.Confirmation = nil
+	s.IntentConfirmed = false
+
+	s.expireFrames()
+	if len(s.Tasks) == 0 {
+		return nil
+	}
+	frame := s.Tasks[len(s.Tasks)-1]
+	s.restoreFrame(len(s.Tasks) - 1)
+	return &frame
+}
+
+// inProgress reports whether the active intent is mid slot-filling or confirmation.
+func (s *DialogueState) inProgress() bool {
+	return len(s.PendingQuestions) > 0 || s.Confirmation != nil
+}
+
+// pushFrame saves the active intent on the stack, dropping the oldest frame
+// beyond policy.MaxStackDepth.
+func (s *DialogueState) pushFrame(policy MergePolicy) {
+	frame := TaskFrame{
+		Intent:           s.ActiveIntent,
+		Priority:         s.ActivePriority,
+		PendingQuestions: s.PendingQuestions,
+		Confirmation:     s.Confirmation,
+		IntentConfirmed:  s.IntentConfirmed,
+		IntentStartTurn:  s.IntentStartTurn,
+		Slots:            s.Slots.clone(),
+		PushedTurn:       s.Turn,
+	}
+	if policy.FrameTTLTurns > 0 {
+		frame.ExpiresTurn = s.Turn + policy.FrameTTLTurns
+	}
+	s.Tasks = append(s.Tasks, frame)
+	if policy.MaxStackDepth > 0 && len(s.Tasks) > policy.MaxStackDepth {
+		s.Tasks = s.Tasks[len(s.Tasks)-policy.MaxStackDepth:]
+	}
+}
+
+// restoreFrame makes frame i the active intent with its slots and drops it
+// and every frame pushed after it.
+func (s *DialogueState) restoreFrame(i int) {
+	if i < 0 || i >= len(s.Tasks) {
+		return
+	}
+	frame := s.Tasks[i]
+	s.Tasks = s.Tasks[:i]
+	s.ActiveIntent = frame.Intent
+	s.ActivePriority = frame.Priority
+	s.PendingQuestions = frame.PendingQuestions
+	s.Confirmation = frame.Confirmation
+	s.IntentConfirmed = frame.IntentConfirmed
+	s.IntentStartTurn = frame.IntentStartTurn
+	if frame.Slots != nil {
+		s.Slots = frame.Slots
+	}
+}
+
+// findFrame returns the index of the innermost frame for intentName, or -1.
+func (s *DialogueState) findFrame(intentName string) int {
+	for i := len(s.Tasks) - 1; i >= 0; i-- {
+		if s.Tasks[i].Intent == intentName {
+			return i
+		}
+	}
+	return -1
+}
+
+// expireFrames drops frames whose ExpiresTurn has passed.
+func (s *DialogueState) expireFrames() {
+	kept := s.Tasks[:0]
+	for _, f := range s.Tasks {
+		if f.ExpiresTurn == 0 || s.Turn <= f.ExpiresTurn {
+			kept = append(kept, f)
+		}
+	}
+	s.Tasks = kept
+}
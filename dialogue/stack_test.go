@@ -0,0 +1,62 @@
+package dialogue
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDigressionSlotsDoNotLeakIntoResumedTask(t *testing.T) {
+	resumers := map[string]func(*DialogueState, MergePolicy){
+		"complete": func(state *DialogueState, _ MergePolicy) {
+			if frame := state.CompleteIntent(); frame == nil || frame.Intent != "purchase_intent" {
+				t.Fatalf("resumed frame = %+v", frame)
+			}
+		},
+		"switch back": func(state *DialogueState, policy MergePolicy) {
+			if d := MergeState(state, detected("purchase_intent", 0.9, 0.8), policy); d.Action != ActionResume {
+				t.Fatalf("action = %s, want resume", d.Action)
+			}
+		},
+	}
+	for name, resume := range resumers {
+		t.Run(name, func(t *testing.T) {
+			policy := mergePolicy(t)
+			state := NewDialogueState()
+			MergeState(state, detected("purchase_intent", 0.9, 0.8), policy)
+			state.Slots.Slots["product"] = Slot{Key: "product", Value: "iPhone", Turn: 1}
+			state.AskPending([]string{"color"}, "Which color?")
+
+			MergeState(state, detected("delivery_issue", 0.9, 0.7), policy)
+			if got := state.Slots.Values()["product"]; got != "iPhone" {
+				t.Errorf("digression sees product %q, want the interrupted task's iPhone", got)
+			}
+			state.Slots.Slots["product"] = Slot{Key: "product", Value: "iPad", Turn: 2}
+			state.Slots.Slots["delivery"] = Slot{Key: "delivery", Value: "express", Turn: 2}
+
+			resume(state, policy)
+			if got, want := state.Slots.Values(), map[string]string{"product": "iPhone"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("resumed slots = %v, want %v", got, want)
+			}
+			if state.ActiveIntent != "purchase_intent" || len(state.PendingQuestions) != 1 {
+				t.Errorf("resumed %q with %d pending questions", state.ActiveIntent, len(state.PendingQuestions))
+			}
+		})
+	}
+}
+
+func TestPushFrameCapsDepth(t *testing.T) {
+	policy := mergePolicy(t)
+	policy.MaxStackDepth = 2
+	state := NewDialogueState()
+	for _, name := range []string{"inquiry_intent", "ask_price", "compare_product", "delivery_issue"} {
+		state.ActiveIntent = name
+		state.pushFrame(policy)
+	}
+	var got []string
+	for _, f := range state.Tasks {
+		got = append(got, f.Intent)
+	}
+	if want := []string{"compare_product", "delivery_issue"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("tasks = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,285 @@
+package dialogue
+
+import (
+	"context"
+	"strings"
+
+	"github.com/cloudwego/eino/compose"
+	"github.com/pawarison/eino-multi-modal-poc/prompt/intent"
+)
+
+// MergePolicy controls how a newly detected intent is merged into the dialogue state.
+type MergePolicy struct {
+	// MinConfidence ignores detected intents below this confidence.
+	MinConfidence float64 `envconfig:"NLU_MERGE_MIN_CONFIDENCE" default:"0.5"`
+	// PreemptMargin is how much higher a new intent's priority must be than the
+	// active one to interrupt slot filling.
+	PreemptMargin float64 `envconfig:"NLU_MERGE_PREEMPT_MARGIN" default:"0.1"`
+	// HistoryLimit caps the stored intent history.
+	HistoryLimit int `envconfig:"NLU_MERGE_HISTORY_LIMIT" default:"20"`
+	// DigressionConfidence lets a confident, lower-priority intent interrupt slot
+	// filling as a digression; the interrupted task is kept on the task stack.
+	DigressionConfidence float64 `envconfig:"NLU_MERGE_DIGRESSION_CONFIDENCE" default:"0.85"`
+	// MaxStackDepth caps how many interrupted tasks are kept.
+	MaxStackDepth int `envconfig:"NLU_MERGE_MAX_STACK_DEPTH" default:"3"`
+	// FrameTTLTurns is how many turns an interrupted task stays resumable.
+	FrameTTLTurns int `envconfig:"NLU_MERGE_FRAME_TTL_TURNS" default:"5"`
+}
+
+// MergeAction describes what MergeState did with the detected intent.
+type MergeAction string
+
+const (
+	// ActionStart begins the first intent of the session.
+	ActionStart MergeAction = "start"
+	// ActionContinue keeps the active intent, e.g. when the user answers a pending question.
+	ActionContinue MergeAction = "continue"
+	// ActionSwitch replaces the active intent.
+	ActionSwitch MergeAction = "switch"
+	// ActionPreempt replaces the active intent while it still had pending questions.
+	ActionPreempt MergeAction = "preempt"
+	// ActionDigress interrupts the active intent with a confident side question.
+	ActionDigress MergeAction = "digress"
+	// ActionResume returns to an interrupted intent from the task stack.
+	ActionResume MergeAction = "resume"
+)
+
+// IntentTurn is one entry in the intent history.
+type IntentTurn struct {
+	Name       string      `json:"name"`
+	Confidence float64     `json:"confidence"`
+	Priority   float64     `json:"priority"`
+	Turn       int         `json:"turn"`
+	Action     MergeAction `json:"action"`
+}
+
+// PendingQuestion is a follow-up the bot asked and is waiting on.
+type PendingQuestion struct {
+	Intent    string   `json:"intent"`
+	Slots     []string `json:"slots"`
+	Text      string   `json:"text"`
+	AskedTurn int      `json:"asked_turn"`
+}
+
+// MergeDecision is the outcome of MergeState for one turn.
+type MergeDecision struct {
+	Action   MergeAction
+	Intent   string
+	Previous string
+}
+
+// DialogueState is the per-session conversation state. Slots carry their own
+// provenance (turn and confidence), see Slot.
+type DialogueState struct {
+	ActiveIntent     string            `json:"active_intent"`
+	ActivePriority   float64           `json:"active_priority"`
+	IntentHistory    []IntentTurn      `json:"intent_history"`
+	Slots            *SlotMemory       `json:"slots"`
+	PendingQuestions []PendingQuestion `json:"pending_questions"`
+	Turn             int               `json:"turn"`
+	IntentStartTurn  int               `json:"intent_start_turn"`
+	Language         string            `json:"language"`
+	LastDecision     MergeDecision     `json:"last_decision"`
+
+	// Slot-filling attempt counters, keyed by "<intent>.<slot>" and intent name.
+	SlotAttempts   map[string]int      `json:"slot_attempts,omitempty"`
+	IntentAttempts map[string]int      `json:"intent_attempts,omitempty"`
+	SkippedSlots   map[string]bool     `json:"skipped_slots,omitempty"`
+	OfferedChoices map[string][]string `json:"offered_choices,omitempty"`
+	Handoff        bool                `json:"handoff"`
+	Events         []EscalationEvent   `json:"events,omitempty"`
+
+	// Confirmation is the confirmation question awaiting a reply, if any.
+	Confirmation    *PendingConfirmation `json:"confirmation,omitempty"`
+	IntentConfirmed bool                 `json:"intent_confirmed"`
+
+	// Tasks holds interrupted intents, innermost last.
+	Tasks []TaskFrame `json:"tasks,omitempty"`
+}
+
+// NewDialogueState creates an empty state.
+func NewDialogueState() *DialogueState {
+	return &DialogueState{Slots: NewSlotMemory()}
+}
+
+// TurnsInIntent returns how many turns the active intent has been running.
+func (s *DialogueState) TurnsInIntent() int {
+	if s.ActiveIntent == "" {
+		return 0
+	}
+	return s.Turn - s.IntentStartTurn + 1
+}
+
+// Missing returns the required slots of the active intent that are neither
+// filled nor skipped by an escalation.
+func (s *DialogueState) Missing(required []string) []string {
+	miss := []string{}
+	for _, k := range s.Slots.Missing(required) {
+		if !s.SkippedSlots[slotKey(s.ActiveIntent, k)] {
+			miss = append(miss, k)
+		}
+	}
+	return miss
+}
+
+// AskPending records a follow-up question the bot is about to send.
+func (s *DialogueState) AskPending(slots []string, text string) {
+	s.PendingQuestions = append(s.PendingQuestions, PendingQuestion{
+		Intent:    s.ActiveIntent,
+		Slots:     append([]string{}, slots...),
+		Text:      text,
+		AskedTurn: s.Turn,
+	})
+}
+
+// ClearPending drops pending questions whose slots are now all filled and
+// resets the attempt counters of the filled slots.
+func (s *DialogueState) ClearPending() {
+	s.resetFilled()
+	kept := s.PendingQuestions[:0]
+	for _, q := range s.PendingQuestions {
+		if len(s.Missing(q.Slots)) > 0 {
+			kept = append(kept, q)
+		}
+	}
+	s.PendingQuestions = kept
+}
+
+// MergeState starts a new turn and merges the detected intents into state.
+//
+// The top intent (by priority, then confidence) continues the active intent
+// when it has the same name, is below policy.MinConfidence or is unknown.
+// An intent that matches an interrupted task on the stack resumes it.
+// While questions or a confirmation are pending a different intent only takes
+// over when its priority beats the active one by policy.PreemptMargin, or as a
+// digression when its confidence reaches policy.DigressionConfidence; both push
+// the interrupted task onto the stack. Otherwise the utterance is treated as an
+// answer. Without pending questions a different intent simply switches.
+func MergeState(state *DialogueState, out *intent.IntentOutput, policy MergePolicy) MergeDecision {
+	if state.Slots == nil {
+		state.Slots = NewSlotMemory()
+	}
+	state.Turn++
+	state.expireFrames()
+
+	if out != nil {
+		if lang := primaryLanguage(out.Languages); lang != "" {
+			state.Language = lang
+		}
+	}
+
+	top, ok := topIntent(out, policy.MinConfidence)
+	decision := MergeDecision{Previous: state.ActiveIntent}
+	switch {
+	case state.ActiveIntent == "":
+		if !ok {
+			decision.Action = ActionContinue
+			break
+		}
+		decision.Action = ActionStart
+	case !ok || top.Name == state.ActiveIntent:
+		decision.Action = ActionContinue
+	case state.findFrame(top.Name) >= 0:
+		decision.Action = ActionResume
+	case state.inProgress():
+		switch {
+		case top.Priority >= state.ActivePriority+policy.PreemptMargin:
+			decision.Action = ActionPreempt
+		case policy.DigressionConfidence > 0 && top.Confidence >= policy.DigressionConfidence:
+			decision.Action = ActionDigress
+		default:
+			decision.Action = ActionContinue
+		}
+	default:
+		decision.Action = ActionSwitch
+	}
+
+	switch decision.Action {
+	case ActionSwitch:
+		state.resetIntent(state.ActiveIntent)
+	case ActionPreempt, ActionDigress:
+		state.pushFrame(policy)
+	}
+
+	switch decision.Action {
+	case ActionResume:
+		state.restoreFrame(state.findFrame(top.Name))
+	case ActionStart, ActionSwitch, ActionPreempt, ActionDigress:
+		state.resetIntent(top.Name)
+		state.ActiveIntent = top.Name
+		state.ActivePriority = top.Priority
+		state.IntentStartTurn = state.Turn
+		state.PendingQuestions = nil
+		state.Confirmation = nil
+		state.IntentConfirmed = false
+	}
+	decision.Intent = state.ActiveIntent
+
+	if ok {
+		state.IntentHistory = append(state.IntentHistory, IntentTurn{
+			Name:       top.Name,
+			Confidence: top.Confidence,
+			Priority:   top.Priority,
+			Turn:       state.Turn,
+			Action:     decision.Action,
+		})
+		if policy.HistoryLimit > 0 && len(state.IntentHistory) > policy.HistoryLimit {
+			state.IntentHistory = state.IntentHistory[len(state.IntentHistory)-policy.HistoryLimit:]
+		}
+	}
+	state.LastDecision = decision
+	return decision
+}
+
+// GenState returns a compose.GenLocalState that hands the given session state to
+// a graph run, so nodes can read and update it through state handlers.
+func GenState(state *DialogueState) compose.GenLocalState[*DialogueState] {
+	return func(ctx context.Context) *DialogueState {
+		if state == nil {
+			return NewDialogueState()
+		}
+		return state
+	}
+}
+
+// MergeStateHandler is a state post handler for the intent detection node.
+// It merges the node's output into the graph's DialogueState.
+func MergeStateHandler(policy MergePolicy) compose.StatePostHandler[*intent.IntentOutput, *DialogueState] {
+	return func(ctx context.Context, out *intent.IntentOutput, state *DialogueState) (*intent.IntentOutput, error) {
+		MergeState(state, out, policy)
+		return out, nil
+	}
+}
+
+func topIntent(out *intent.IntentOutput, minConfidence float64) (intent.IntentResult, bool) {
+	var best intent.IntentResult
+	found := false
+	if out == nil {
+		return best, false
+	}
+	for _, in := range out.Intents {
+		name := strings.TrimSpace(in.Name)
+		if name == "" || name == "unknown" || in.Confidence < minConfidence {
+			continue
+		}
+		if !found || in.Priority > best.Priority ||
+			(in.Priority == best.Priority && in.Confidence > best.Confidence) {
+			best = in
+			best.Name = name
+			found = true
+		}
+	}
+	return best, found
+}
+
+func primaryLanguage(langs []intent.LanguageResult) string {
+	for _, l := range langs {
+		if l.PrimaryFlag == 1 {
+			return l.Code
+		}
+	}
+	if len(langs) > 0 {
+		return langs[0].Code
+	}
+	return ""
+}
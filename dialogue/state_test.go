@@ -0,0 +1,138 @@
+package dialogue
+
+import (
+	"testing"
+
+	"github.com/pawarison/eino-multi-modal-poc/config"
+	"github.com/pawarison/eino-multi-modal-poc/prompt/intent"
+)
+
+func mergePolicy(t *testing.T) MergePolicy {
+	t.Helper()
+	policy, err := config.New[MergePolicy]("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *policy
+}
+
+func detected(name string, confidence, priority float64) *intent.IntentOutput {
+	return &intent.IntentOutput{Intents: []intent.IntentResult{{Name: name, Confidence: confidence, Priority: priority}}}
+}
+
+func TestMergeState(t *testing.T) {
+	type step struct {
+		out        *intent.IntentOutput
+		pending    bool // ask a question before the step
+		wantAction MergeAction
+		wantIntent string
+		wantTasks  int
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"start", []step{
+			{out: detected("purchase_intent", 0.9, 0.8), wantAction: ActionStart, wantIntent: "purchase_intent"},
+		}},
+		{"low confidence does not start", []step{
+			{out: detected("purchase_intent", 0.3, 0.8), wantAction: ActionContinue},
+		}},
+		{"unknown continues", []step{
+			{out: detected("purchase_intent", 0.9, 0.8), wantAction: ActionStart, wantIntent: "purchase_intent"},
+			{out: detected("unknown", 0.9, 0), wantAction: ActionContinue, wantIntent: "purchase_intent"},
+		}},
+		{"same intent continues", []step{
+			{out: detected("purchase_intent", 0.9, 0.8), wantAction: ActionStart, wantIntent: "purchase_intent"},
+			{out: detected("purchase_intent", 0.7, 0.8), wantAction: ActionContinue, wantIntent: "purchase_intent"},
+		}},
+		{"switch without pending questions", []step{
+			{out: detected("purchase_intent", 0.9, 0.8), wantAction: ActionStart, wantIntent: "purchase_intent"},
+			{out: detected("greet", 0.6, 0.1), wantAction: ActionSwitch, wantIntent: "greet"},
+		}},
+		{"answer to a pending question continues", []step{
+			{out: detected("inquiry_intent", 0.9, 0.7), wantAction: ActionStart, wantIntent: "inquiry_intent"},
+			{out: detected("ask_price", 0.6, 0.6), pending: true, wantAction: ActionContinue, wantIntent: "inquiry_intent"},
+		}},
+		{"higher priority preempts", []step{
+			{out: detected("inquiry_intent", 0.9, 0.7), wantAction: ActionStart, wantIntent: "inquiry_intent"},
+			{out: detected("purchase_intent", 0.6, 0.8), pending: true, wantAction: ActionPreempt, wantIntent: "purchase_intent", wantTasks: 1},
+		}},
+		{"confident side question digresses and resumes", []step{
+			{out: detected("purchase_intent", 0.9, 0.8), wantAction: ActionStart, wantIntent: "purchase_intent"},
+			{out: detected("delivery_issue", 0.9, 0.7), pending: true, wantAction: ActionDigress, wantIntent: "delivery_issue", wantTasks: 1},
+			{out: detected("purchase_intent", 0.9, 0.8), wantAction: ActionResume, wantIntent: "purchase_intent"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := NewDialogueState()
+			policy := mergePolicy(t)
+			for i, st := range tt.steps {
+				if st.pending {
+					state.AskPending([]string{"product"}, "Which product?")
+				}
+				d := MergeState(state, st.out, policy)
+				if d.Action != st.wantAction || d.Intent != st.wantIntent || state.ActiveIntent != st.wantIntent {
+					t.Fatalf("step %d: decision %+v, active %q, want %s %q", i, d, state.ActiveIntent, st.wantAction, st.wantIntent)
+				}
+				if len(state.Tasks) != st.wantTasks {
+					t.Fatalf("step %d: %d tasks, want %d", i, len(state.Tasks), st.wantTasks)
+				}
+			}
+		})
+	}
+}
+
+func TestMergeStateResumeRestoresPendingQuestions(t *testing.T) {
+	state := NewDialogueState()
+	policy := mergePolicy(t)
+	MergeState(state, detected("purchase_intent", 0.9, 0.8), policy)
+	state.AskPending([]string{"color"}, "Which color?")
+	MergeState(state, detected("delivery_issue", 0.9, 0.7), policy)
+	if len(state.PendingQuestions) != 0 {
+		t.Fatalf("digression kept %d pending questions", len(state.PendingQuestions))
+	}
+	MergeState(state, detected("purchase_intent", 0.9, 0.8), policy)
+	if len(state.PendingQuestions) != 1 || state.PendingQuestions[0].Text != "Which color?" {
+		t.Errorf("pending after resume = %+v", state.PendingQuestions)
+	}
+	if state.IntentStartTurn != 1 {
+		t.Errorf("intent start turn = %d, want 1", state.IntentStartTurn)
+	}
+}
+
+func TestMergeStateExpiresFrames(t *testing.T) {
+	state := NewDialogueState()
+	policy := mergePolicy(t)
+	policy.FrameTTLTurns = 2
+	MergeState(state, detected("purchase_intent", 0.9, 0.8), policy)
+	state.AskPending([]string{"color"}, "Which color?")
+	MergeState(state, detected("delivery_issue", 0.9, 0.7), policy)
+	for range 3 {
+		MergeState(state, nil, policy)
+	}
+	if len(state.Tasks) != 0 {
+		t.Errorf("%d tasks left after the frame expired", len(state.Tasks))
+	}
+	if d := MergeState(state, detected("purchase_intent", 0.9, 0.8), policy); d.Action != ActionSwitch {
+		t.Errorf("action after expiry = %s, want switch", d.Action)
+	}
+}
+
+func TestMergeStateLanguageAndHistory(t *testing.T) {
+	state := NewDialogueState()
+	policy := mergePolicy(t)
+	policy.HistoryLimit = 2
+	out := detected("greet", 0.9, 0.1)
+	out.Languages = []intent.LanguageResult{{Code: "eng", PrimaryFlag: 0}, {Code: "tha", PrimaryFlag: 1}}
+	for range 3 {
+		MergeState(state, out, policy)
+	}
+	if state.Language != "tha" {
+		t.Errorf("language = %q, want the primary tha", state.Language)
+	}
+	if len(state.IntentHistory) != 2 || state.IntentHistory[1].Turn != 3 {
+		t.Errorf("history = %+v, want the last 2 turns", state.IntentHistory)
+	}
+}
@@ -0,0 +1,295 @@
+// Package embedcache caches embeddings on local disk so unchanged texts are
+// never embedded twice. Entries are keyed by model, task type, output
+// dimension and the text's content hash, and live in a bbolt file.
+//
+// Ingestion and query-time search use it through tools.Clients. Few-shot
+// example selection is out of scope: nothing in this module selects examples
+// by embedding yet.
+package embedcache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudwego/eino/components/embedding"
+	bolt "go.etcd.io/bbolt"
+)
+
+var bucketName = []byte("embeddings")
+
+// writeQueueSize is how many write-behind batches may wait before new ones
+// are dropped.
+const writeQueueSize = 64
+
+// Store is an on-disk embedding cache. A bbolt file can be open in one
+// process at a time; Open fails after a short wait if another process holds it.
+type Store struct {
+	db *bolt.DB
+
+	// mu guards sending on queue against Close closing it.
+	mu      sync.RWMutex
+	closed  bool
+	queue   chan []entry
+	flushed chan struct{}
+	dropped atomic.Int64
+}
+
+// entry is one cached vector waiting to be written.
+type entry struct {
+	key   []byte
+	value []byte
+}
+
+// Open opens or creates the cache file at path.
+func Open(path string) (*Store, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("create embedding cache dir %s: %w", dir, err)
+		}
+	}
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, fmt.Errorf("open embedding cache %s: file is in use by another process", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open embedding cache %s: %w", path, err)
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucketName)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("init embedding cache: %w", err)
+	}
+	s := &Store{db: db, queue: make(chan []entry, writeQueueSize), flushed: make(chan struct{})}
+	go s.writeBehind()
+	return s, nil
+}
+
+// Close writes the queued entries and closes the cache file.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.mu.Unlock()
+	<-s.flushed
+	return s.db.Close()
+}
+
+// enqueue hands entries to the write-behind goroutine without waiting. When
+// the queue is full or the store closed they are dropped; they are embedded
+// again on the next miss.
+func (s *Store) enqueue(entries []entry) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.queue <- entries:
+	default:
+		s.dropped.Add(int64(len(entries)))
+	}
+}
+
+// writeBehind writes queued entries, one transaction for whatever is waiting.
+func (s *Store) writeBehind() {
+	defer close(s.flushed)
+	for batch := range s.queue {
+		for more := true; more; {
+			select {
+			case next, ok := <-s.queue:
+				if !ok {
+					more = false
+					break
+				}
+				batch = append(batch, next...)
+			default:
+				more = false
+			}
+		}
+		// a failed write only costs a future miss
+		_ = s.put(batch)
+	}
+}
+
+func (s *Store) put(entries []entry) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketName)
+		for _, e := range entries {
+			if err := b.Put(e.key, e.value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Options identify the embedding space of a wrapped embedder. Vectors from
+// different models, task types or dimensions never share cache entries.
+type Options struct {
+	Model     string
+	TaskType  string
+	Dimension int
+	// WriteBehind stores misses in the background instead of in a synced
+	// transaction before returning, for latency-sensitive callers such as
+	// query-time search. Entries can be lost if the queue is full.
+	WriteBehind bool
+}
+
+// Stats counts cache lookups. Dropped counts write-behind entries of the
+// whole store that were not written.
+type Stats struct {
+	Hits    int64
+	Misses  int64
+	Dropped int64
+}
+
+// HitRate is the share of lookups served from the cache.
+func (s Stats) HitRate() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+func (s Stats) String() string {
+	out := fmt.Sprintf("hits %d, misses %d, hit rate %.1f%%", s.Hits, s.Misses, s.HitRate()*100)
+	if s.Dropped > 0 {
+		out += fmt.Sprintf(", %d writes dropped", s.Dropped)
+	}
+	return out
+}
+
+// Embedder is an embedding.Embedder that serves cached vectors and only
+// sends misses to the wrapped embedder.
+type Embedder struct {
+	store  *Store
+	inner  embedding.Embedder
+	opts   Options
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// Wrap returns a caching embedder around inner.
+func (s *Store) Wrap(inner embedding.Embedder, opts Options) *Embedder {
+	return &Embedder{store: s, inner: inner, opts: opts}
+}
+
+// Stats returns the lookups counted so far.
+func (e *Embedder) Stats() Stats {
+	return Stats{Hits: e.hits.Load(), Misses: e.misses.Load(), Dropped: e.store.dropped.Load()}
+}
+
+// EmbedStrings returns embeddings in the order of texts. Repeated texts in
+// one call are embedded once. A per-call embedding.WithModel is part of the key.
+func (e *Embedder) EmbedStrings(ctx context.Context, texts []string, opts ...embedding.Option) ([][]float64, error) {
+	model := e.opts.Model
+	if o := embedding.GetCommonOptions(&embedding.Options{Model: &model}, opts...); o.Model != nil {
+		model = *o.Model
+	}
+
+	keys := make([][]byte, len(texts))
+	for i, t := range texts {
+		keys[i] = e.key(model, t)
+	}
+	out := make([][]float64, len(texts))
+	if err := e.store.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketName)
+		for i, k := range keys {
+			if v := b.Get(k); v != nil {
+				out[i] = decode(v)
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("read embedding cache: %w", err)
+	}
+
+	// group misses by key so duplicates are embedded once
+	var missTexts []string
+	missIdx := map[string][]int{}
+	for i, v := range out {
+		if v != nil {
+			e.hits.Add(1)
+			continue
+		}
+		e.misses.Add(1)
+		k := string(keys[i])
+		if _, seen := missIdx[k]; !seen {
+			missTexts = append(missTexts, texts[i])
+		}
+		missIdx[k] = append(missIdx[k], i)
+	}
+	if len(missTexts) == 0 {
+		return out, nil
+	}
+
+	embedded, err := e.inner.EmbedStrings(ctx, missTexts, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if len(embedded) != len(missTexts) {
+		return nil, fmt.Errorf("embedder returned %d embeddings for %d texts", len(embedded), len(missTexts))
+	}
+
+	entries := make([]entry, len(missTexts))
+	for j, t := range missTexts {
+		k := e.key(model, t)
+		entries[j] = entry{key: k, value: encode(embedded[j])}
+		for _, i := range missIdx[string(k)] {
+			out[i] = embedded[j]
+		}
+	}
+	if e.opts.WriteBehind {
+		e.store.enqueue(entries)
+		return out, nil
+	}
+	if err := e.store.put(entries); err != nil {
+		return nil, fmt.Errorf("write embedding cache: %w", err)
+	}
+	return out, nil
+}
+
+// key is sha256(model, task type, dimension, text) with NUL separators.
+func (e *Embedder) key(model, text string) []byte {
+	h := sha256.New()
+	h.Write([]byte(model))
+	h.Write([]byte{0})
+	h.Write([]byte(e.opts.TaskType))
+	h.Write([]byte{0})
+	h.Write([]byte(strconv.Itoa(e.opts.Dimension)))
+	h.Write([]byte{0})
+	h.Write([]byte(text))
+	return h.Sum(nil)
+}
+
+func encode(v []float64) []byte {
+	buf := make([]byte, 8*len(v))
+	for i, x := range v {
+		binary.LittleEndian.PutUint64(buf[8*i:], math.Float64bits(x))
+	}
+	return buf
+}
+
+// decode copies the value, which bbolt only guarantees during the transaction.
+func decode(buf []byte) []float64 {
+	v := make([]float64, len(buf)/8)
+	for i := range v {
+		v[i] = math.Float64frombits(binary.LittleEndian.Uint64(buf[8*i:]))
+	}
+	return v
+}
@@ -0,0 +1,111 @@
+package embedcache
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/cloudwego/eino/components/embedding"
+)
+
+// countingEmbedder embeds a text as its length and records what it was asked.
+type countingEmbedder struct {
+	calls [][]string
+}
+
+func (c *countingEmbedder) EmbedStrings(_ context.Context, texts []string, _ ...embedding.Option) ([][]float64, error) {
+	c.calls = append(c.calls, texts)
+	out := make([][]float64, len(texts))
+	for i, t := range texts {
+		out[i] = []float64{float64(len(t)), 0.5}
+	}
+	return out, nil
+}
+
+func TestEmbedderCachesAcrossOpens(t *testing.T) {
+	for _, writeBehind := range []bool{false, true} {
+		name := "sync"
+		if writeBehind {
+			name = "write behind"
+		}
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			path := filepath.Join(t.TempDir(), "cache.db")
+			opts := Options{Model: "m", TaskType: "RETRIEVAL_QUERY", Dimension: 2, WriteBehind: writeBehind}
+
+			store, err := Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			inner := &countingEmbedder{}
+			e := store.Wrap(inner, opts)
+			got, err := e.EmbedStrings(ctx, []string{"a", "bb", "a"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := [][]float64{{1, 0.5}, {2, 0.5}, {1, 0.5}}; !reflect.DeepEqual(got, want) {
+				t.Errorf("vectors = %v, want %v", got, want)
+			}
+			if want := [][]string{{"a", "bb"}}; !reflect.DeepEqual(inner.calls, want) {
+				t.Errorf("inner calls = %v, want duplicates embedded once", inner.calls)
+			}
+			if err := store.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			store, err = Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer store.Close()
+			inner = &countingEmbedder{}
+			e = store.Wrap(inner, opts)
+			if _, err := e.EmbedStrings(ctx, []string{"bb", "ccc"}); err != nil {
+				t.Fatal(err)
+			}
+			if want := [][]string{{"ccc"}}; !reflect.DeepEqual(inner.calls, want) {
+				t.Errorf("inner calls after reopen = %v, want only the new text", inner.calls)
+			}
+			if s := e.Stats(); s.Hits != 1 || s.Misses != 1 {
+				t.Errorf("stats = %+v", s)
+			}
+		})
+	}
+}
+
+func TestEmbedderSeparatesEmbeddingSpaces(t *testing.T) {
+	ctx := context.Background()
+	store, err := Open(filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	base := Options{Model: "m", TaskType: "RETRIEVAL_DOCUMENT", Dimension: 2}
+	if _, err := store.Wrap(&countingEmbedder{}, base).EmbedStrings(ctx, []string{"a"}); err != nil {
+		t.Fatal(err)
+	}
+	variants := map[string]Options{
+		"model":     {Model: "other", TaskType: base.TaskType, Dimension: base.Dimension},
+		"task type": {Model: base.Model, TaskType: "RETRIEVAL_QUERY", Dimension: base.Dimension},
+		"dimension": {Model: base.Model, TaskType: base.TaskType, Dimension: 3},
+	}
+	for name, opts := range variants {
+		inner := &countingEmbedder{}
+		if _, err := store.Wrap(inner, opts).EmbedStrings(ctx, []string{"a"}); err != nil {
+			t.Fatal(err)
+		}
+		if len(inner.calls) != 1 {
+			t.Errorf("%s: a different embedding space hit the cache", name)
+		}
+	}
+	model := "other"
+	inner := &countingEmbedder{}
+	if _, err := store.Wrap(inner, base).EmbedStrings(ctx, []string{"a"}, embedding.WithModel(model)); err != nil {
+		t.Fatal(err)
+	}
+	if len(inner.calls) != 0 {
+		t.Errorf("per-call model %q missed the entry it wrote", model)
+	}
+}
@@ -0,0 +1,111 @@
+// Package embedder configures the Gemini embedding model and records that
+// configuration on collections, so documents and queries are always embedded
+// into the same vector space.
+package embedder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+
+	geminiembed "github.com/cloudwego/eino-ext/components/embedding/gemini"
+	"github.com/cloudwego/eino/components/embedding"
+	"github.com/pawarison/eino-multi-modal-poc/vectorstore"
+	"google.golang.org/genai"
+)
+
+// Collection property keys of the embedding config.
+const (
+	PropertyModel            = "embedding.model"
+	PropertyDocumentTaskType = "embedding.document_task_type"
+	PropertyQueryTaskType    = "embedding.query_task_type"
+	PropertyDimension        = "embedding.dimension"
+)
+
+// ErrMismatch is returned when a collection was embedded with a different config.
+var ErrMismatch = errors.New("embedding config mismatch")
+
+// Config selects the model, the task types of documents and queries, and the
+// output dimension. Include it in a config struct as
+//
+//	Embedding embedder.Config `envconfig:"EMBEDDING"`
+//
+// to read EMBEDDING_MODEL, EMBEDDING_DOCUMENT_TASK_TYPE, EMBEDDING_QUERY_TASK_TYPE and EMBEDDING_DIMENSION.
+type Config struct {
+	Model            string `envconfig:"MODEL" default:"gemini-embedding-001"`
+	DocumentTaskType string `envconfig:"DOCUMENT_TASK_TYPE" default:"RETRIEVAL_DOCUMENT"`
+	QueryTaskType    string `envconfig:"QUERY_TASK_TYPE" default:"RETRIEVAL_QUERY"`
+	// Dimension truncates the output embedding. 0 keeps the model default.
+	Dimension int `envconfig:"DIMENSION" default:"768"`
+}
+
+// Properties returns the config as collection properties.
+func (c Config) Properties() map[string]string {
+	return map[string]string{
+		PropertyModel:            c.Model,
+		PropertyDocumentTaskType: c.DocumentTaskType,
+		PropertyQueryTaskType:    c.QueryTaskType,
+		PropertyDimension:        strconv.Itoa(c.Dimension),
+	}
+}
+
+// Check compares c with the config recorded on existing. A collection without
+// a recorded config predates this check: it is accepted with a warning when
+// its dimension fits. The error wraps ErrMismatch.
+func (c Config) Check(existing vectorstore.CollectionSpec) error {
+	props := existing.Properties
+	if _, ok := props[PropertyModel]; !ok {
+		if c.Dimension > 0 && existing.Dim > 0 && existing.Dim != c.Dimension {
+			return fmt.Errorf("collection %s: %w: dimension is %d, want %d", existing.Name, ErrMismatch, existing.Dim, c.Dimension)
+		}
+		log.Printf("collection %s has no recorded embedding config; reindex it to record one", existing.Name)
+		return nil
+	}
+	var errs []error
+	for _, p := range []struct{ key, want string }{
+		{PropertyModel, c.Model},
+		{PropertyDocumentTaskType, c.DocumentTaskType},
+		{PropertyQueryTaskType, c.QueryTaskType},
+		{PropertyDimension, strconv.Itoa(c.Dimension)},
+	} {
+		if got := props[p.key]; got != p.want {
+			errs = append(errs, fmt.Errorf("%s is %q, want %q", p.key, got, p.want))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("collection %s: %w: %w", existing.Name, ErrMismatch, errors.Join(errs...))
+	}
+	return nil
+}
+
+// NewDocument creates an embedder for documents.
+func NewDocument(ctx context.Context, client *genai.Client, cfg Config) (embedding.Embedder, error) {
+	return newGemini(ctx, client, cfg, cfg.DocumentTaskType)
+}
+
+// NewQuery creates an embedder for search queries.
+func NewQuery(ctx context.Context, client *genai.Client, cfg Config) (embedding.Embedder, error) {
+	return newGemini(ctx, client, cfg, cfg.QueryTaskType)
+}
+
+func newGemini(ctx context.Context, client *genai.Client, cfg Config, taskType string) (embedding.Embedder, error) {
+	if cfg.Dimension < 0 {
+		return nil, fmt.Errorf("invalid embedding dimension %d", cfg.Dimension)
+	}
+	geminiCfg := &geminiembed.EmbeddingConfig{
+		Client:   client,
+		Model:    cfg.Model,
+		TaskType: taskType,
+	}
+	if cfg.Dimension > 0 {
+		dim := int32(cfg.Dimension)
+		geminiCfg.OutputDimensionality = &dim
+	}
+	e, err := geminiembed.NewEmbedder(ctx, geminiCfg)
+	if err != nil {
+		return nil, fmt.Errorf("create %s embedder: %w", taskType, err)
+	}
+	return e, nil
+}
@@ -0,0 +1,117 @@
+package ingest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pawarison/eino-multi-modal-poc/dataset"
+)
+
+// Checkpoint records which batches of a dataset were embedded and upserted.
+// It only applies to the same collection, dataset content and batch size.
+type Checkpoint struct {
+	Collection  string `json:"collection"`
+	DatasetHash string `json:"dataset_hash"`
+	BatchSize   int    `json:"batch_size"`
+	Completed   []int  `json:"completed"`
+
+	done map[int]bool
+}
+
+func newCheckpoint(collection, datasetHash string, batchSize int) *Checkpoint {
+	return &Checkpoint{Collection: collection, DatasetHash: datasetHash, BatchSize: batchSize, done: map[int]bool{}}
+}
+
+// loadCheckpoint reads the checkpoint at path. A missing file, or one written
+// for another collection, dataset or batch size, yields an empty checkpoint.
+func loadCheckpoint(path, collection, datasetHash string, batchSize int) (*Checkpoint, error) {
+	fresh := newCheckpoint(collection, datasetHash, batchSize)
+	if path == "" {
+		return fresh, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fresh, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read checkpoint %s: %w", path, err)
+	}
+	var cp Checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("decode checkpoint %s: %w", path, err)
+	}
+	if cp.Collection != collection || cp.DatasetHash != datasetHash || cp.BatchSize != batchSize {
+		return fresh, nil
+	}
+	cp.done = make(map[int]bool, len(cp.Completed))
+	for _, b := range cp.Completed {
+		cp.done[b] = true
+	}
+	return &cp, nil
+}
+
+// Done reports whether batch was completed.
+func (c *Checkpoint) Done(batch int) bool {
+	return c.done[batch]
+}
+
+func (c *Checkpoint) markDone(batch int) {
+	if c.done[batch] {
+		return
+	}
+	c.done[batch] = true
+	c.Completed = append(c.Completed, batch)
+	sort.Ints(c.Completed)
+}
+
+func (c *Checkpoint) reset() {
+	c.Completed = nil
+	c.done = map[int]bool{}
+}
+
+// save writes the checkpoint atomically through a temp file and rename.
+func (c *Checkpoint) save(path string) error {
+	if path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode checkpoint: %w", err)
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("create checkpoint dir %s: %w", dir, err)
+	}
+	tmp, err := os.CreateTemp(dir, ".checkpoint-*")
+	if err != nil {
+		return fmt.Errorf("write checkpoint: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write checkpoint: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("commit checkpoint %s: %w", path, err)
+	}
+	return nil
+}
+
+// datasetHash fingerprints the rows so a changed dataset invalidates the checkpoint.
+func datasetHash(rows []dataset.Record) (string, error) {
+	h := sha256.New()
+	if err := json.NewEncoder(h).Encode(rows); err != nil {
+		return "", fmt.Errorf("hash dataset: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
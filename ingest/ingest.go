@@ -0,0 +1,506 @@
+// Package ingest embeds dataset records and writes them to the vector store.
+// It never drops data: the collection is created only when missing, an
+// existing one must match the mapped schema, rows are upserted by id, and a
+// checkpoint of completed batches lets an interrupted run resume. The only
+// deletes are of chunks past the last one of a record whose text got shorter.
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/eino/components/embedding"
+	"github.com/pawarison/eino-multi-modal-poc/articles"
+	"github.com/pawarison/eino-multi-modal-poc/dataset"
+	"github.com/pawarison/eino-multi-modal-poc/embedder"
+	"github.com/pawarison/eino-multi-modal-poc/retrieval"
+	"github.com/pawarison/eino-multi-modal-poc/vectorstore"
+)
+
+// Config controls an ingestion run.
+type Config struct {
+	Collection  string `envconfig:"MILVUS_COLLECTION" default:"articles"`
+	VectorField string `envconfig:"MILVUS_VECTOR_FIELD" default:"title_vector"`
+	// Embedding is recorded on a new collection and must match an existing one.
+	Embedding embedder.Config `envconfig:"EMBEDDING"`
+	// BatchSize is the number of texts per embedding request; Gemini allows at most 100.
+	BatchSize int `envconfig:"INGEST_BATCH_SIZE" default:"100"`
+	// CheckpointPath stores completed batches. Empty disables checkpointing.
+	CheckpointPath string `envconfig:"INGEST_CHECKPOINT" default:".ingest/checkpoint.json"`
+	// Concurrency is the number of batches embedded and upserted at once.
+	Concurrency int `envconfig:"INGEST_CONCURRENCY" default:"4"`
+	// RequestsPerMinute and TokensPerMinute cap embedding calls; 0 disables a limit.
+	RequestsPerMinute int `envconfig:"INGEST_RPM" default:"100"`
+	TokensPerMinute   int `envconfig:"INGEST_TPM" default:"30000"`
+	// MaxRetries bounds retries of an embedding call after a 429 or 5xx response.
+	MaxRetries     int           `envconfig:"INGEST_MAX_RETRIES" default:"5"`
+	RetryBaseDelay time.Duration `envconfig:"INGEST_RETRY_BASE_DELAY" default:"1s"`
+	RetryMaxDelay  time.Duration `envconfig:"INGEST_RETRY_MAX_DELAY" default:"32s"`
+	// ProgressInterval is the minimum time between progress log lines.
+	ProgressInterval time.Duration `envconfig:"INGEST_PROGRESS_INTERVAL" default:"5s"`
+	// Fixes repairs dataset violations: a comma-separated set of truncate,
+	// dedup and drop.
+	Fixes []string `envconfig:"INGEST_FIX"`
+	// AllowInvalid ingests despite violations left after Fixes instead of
+	// refusing to start.
+	AllowInvalid bool `envconfig:"INGEST_ALLOW_INVALID"`
+	// LexicalIndexPath receives the BM25 index of the dataset after a
+	// successful run, when the mapping has a title field. Empty disables it.
+	LexicalIndexPath string `envconfig:"SEARCH_LEXICAL_INDEX" default:".index/articles_bm25.json"`
+}
+
+// Report describes what a run did, or would do in dry-run mode.
+type Report struct {
+	Collection string
+	DryRun     bool
+	// CollectionExists is true when the collection existed before the run.
+	CollectionExists bool
+	// CreateCollection is true when the run created, or would create, the collection.
+	CreateCollection bool
+	Dim              int
+	// Records is the number of dataset records after validation. Rows equals
+	// it unless the mapping chunks, when Rows counts the chunks.
+	Records int
+	Rows    int
+	Batches int
+	// SkippedBatches were completed by an earlier run according to the checkpoint.
+	SkippedBatches int
+	// PendingBatches and PendingRows are what this run has to embed and upsert.
+	PendingBatches int
+	PendingRows    int
+	// UpsertedBatches and UpsertedRows were written by this run.
+	UpsertedBatches int
+	UpsertedRows    int
+	// Retries counts embedding calls retried after 429 or 5xx responses.
+	Retries int
+	Elapsed time.Duration
+	// Validation lists the dataset violations and how they were fixed.
+	Validation *dataset.ValidationReport
+	// Refused is true when the run did not start because of violations.
+	Refused bool
+	// LexicalIndexPath is where the BM25 index was written, or empty.
+	LexicalIndexPath string
+}
+
+// String renders the report for the command line.
+func (r *Report) String() string {
+	var b strings.Builder
+	if r.Validation != nil && len(r.Validation.Violations) > 0 {
+		fmt.Fprintf(&b, "%s\n", r.Validation)
+	}
+	if r.Refused {
+		b.WriteString("refused to start, nothing was written")
+		return b.String()
+	}
+	verb := "upserted"
+	if r.DryRun {
+		b.WriteString("dry run, nothing was written\n")
+		verb = "would upsert"
+	}
+	switch {
+	case r.CreateCollection && r.DryRun:
+		fmt.Fprintf(&b, "collection %s: missing, would be created\n", r.Collection)
+	case r.CreateCollection:
+		fmt.Fprintf(&b, "collection %s: created (dim %d)\n", r.Collection, r.Dim)
+	default:
+		fmt.Fprintf(&b, "collection %s: exists (dim %d), schema ok\n", r.Collection, r.Dim)
+	}
+	if r.Records != r.Rows {
+		fmt.Fprintf(&b, "records: %d chunked into %d rows\n", r.Records, r.Rows)
+	}
+	fmt.Fprintf(&b, "rows: %d in %d batches, %d batches already done\n", r.Rows, r.Batches, r.SkippedBatches)
+	if r.DryRun {
+		fmt.Fprintf(&b, "%s: %d rows in %d batches", verb, r.PendingRows, r.PendingBatches)
+	} else {
+		fmt.Fprintf(&b, "%s: %d rows in %d of %d pending batches", verb, r.UpsertedRows, r.UpsertedBatches, r.PendingBatches)
+		if secs := r.Elapsed.Seconds(); secs > 0 {
+			fmt.Fprintf(&b, " in %s (%.1f rows/s, %d retries)", r.Elapsed.Round(time.Millisecond), float64(r.UpsertedRows)/secs, r.Retries)
+		}
+		if r.LexicalIndexPath != "" {
+			fmt.Fprintf(&b, "\nlexical index: %s", r.LexicalIndexPath)
+		}
+	}
+	return b.String()
+}
+
+// Ingester writes mapped records into one collection.
+type Ingester struct {
+	cfg      Config
+	mapping  dataset.Mapping
+	fixes    dataset.Fixes
+	embedder embedding.Embedder
+	store    vectorstore.Store
+	limiter  *limiter
+	retry    retryPolicy
+	logf     func(format string, args ...any)
+}
+
+// New creates an ingester for records loaded with mapping. Progress is logged
+// with the standard logger.
+func New(cfg *Config, mapping dataset.Mapping, embedder embedding.Embedder, store vectorstore.Store) (*Ingester, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("ingest config is nil")
+	}
+	if err := mapping.Validate(); err != nil {
+		return nil, err
+	}
+	if embedder == nil {
+		return nil, fmt.Errorf("embedder is nil")
+	}
+	if store == nil {
+		return nil, fmt.Errorf("vector store is nil")
+	}
+	if cfg.BatchSize <= 0 || cfg.BatchSize > 100 {
+		return nil, fmt.Errorf("invalid batch size %d: must be 1-100", cfg.BatchSize)
+	}
+	if cfg.Concurrency <= 0 {
+		return nil, fmt.Errorf("invalid concurrency %d", cfg.Concurrency)
+	}
+	fixes, err := dataset.ParseFixes(cfg.Fixes)
+	if err != nil {
+		return nil, err
+	}
+	return &Ingester{
+		cfg:      *cfg,
+		mapping:  mapping,
+		fixes:    fixes,
+		embedder: embedder,
+		store:    store,
+		limiter:  newLimiter(cfg.RequestsPerMinute, cfg.TokensPerMinute, time.Now, sleepContext),
+		retry:    retryPolicy{maxRetries: cfg.MaxRetries, baseDelay: cfg.RetryBaseDelay, maxDelay: cfg.RetryMaxDelay, sleep: sleepContext},
+		logf:     log.Printf,
+	}, nil
+}
+
+// Check validates rows against the mapping and applies the configured
+// fixes. It returns the rows to ingest, and an error wrapping
+// dataset.ErrInvalid when violations are left and AllowInvalid is off.
+func (in *Ingester) Check(rows []dataset.Record) ([]dataset.Record, *dataset.ValidationReport, error) {
+	rows, report := dataset.Check(rows, in.mapping, in.fixes)
+	if err := report.Err(); err != nil {
+		if !in.cfg.AllowInvalid {
+			return rows, report, fmt.Errorf("%w; fix the dataset, set INGEST_FIX, or set INGEST_ALLOW_INVALID to ingest anyway", err)
+		}
+		in.logf("ingesting despite %v", err)
+	}
+	return rows, report, nil
+}
+
+// Run checks rows and ingests them. It refuses to start on violations that
+// Check does not allow. With dryRun it only checks the dataset, the
+// collection and the checkpoint and reports the pending work. On a failed
+// batch the checkpoint keeps every batch completed before it, and the partial
+// report is returned with the error.
+func (in *Ingester) Run(ctx context.Context, rows []dataset.Record, dryRun bool) (*Report, error) {
+	report := &Report{Collection: in.cfg.Collection, DryRun: dryRun}
+	rows, validation, err := in.Check(rows)
+	report.Validation = validation
+	if err != nil {
+		report.Refused = true
+		return report, err
+	}
+	records := rows
+	if rows, err = in.mapping.Chunk(records); err != nil {
+		return report, err
+	}
+	report.Records = len(records)
+	report.Rows = len(rows)
+	report.Batches = (len(rows) + in.cfg.BatchSize - 1) / in.cfg.BatchSize
+	if len(rows) == 0 {
+		return report, fmt.Errorf("dataset has no rows")
+	}
+
+	spec := in.mapping.CollectionSpec(in.cfg.Collection, in.cfg.VectorField, 0)
+	existing, err := in.store.Describe(ctx, in.cfg.Collection)
+	switch {
+	case err == nil:
+		if err := spec.Check(existing); err != nil {
+			return report, err
+		}
+		if err := in.cfg.Embedding.Check(existing); err != nil {
+			return report, err
+		}
+		report.CollectionExists = true
+		report.Dim = existing.Dim
+	case errors.Is(err, vectorstore.ErrCollectionNotFound):
+		report.CreateCollection = true
+	default:
+		return report, fmt.Errorf("describe collection: %w", err)
+	}
+
+	hash, err := datasetHash(rows)
+	if err != nil {
+		return report, err
+	}
+	cp, err := loadCheckpoint(in.cfg.CheckpointPath, in.cfg.Collection, hash, in.cfg.BatchSize)
+	if err != nil {
+		return report, err
+	}
+	if !report.CollectionExists && len(cp.Completed) > 0 {
+		// the checkpoint refers to a collection that is gone
+		in.logf("collection %s is missing, ignoring %d checkpointed batches", in.cfg.Collection, len(cp.Completed))
+		cp.reset()
+	}
+
+	var pending []int
+	for batch := 0; batch < report.Batches; batch++ {
+		if cp.Done(batch) {
+			report.SkippedBatches++
+			continue
+		}
+		pending = append(pending, batch)
+		start, end := in.bounds(batch, len(rows))
+		report.PendingRows += end - start
+	}
+	report.PendingBatches = len(pending)
+	if dryRun {
+		return report, nil
+	}
+	if len(pending) == 0 {
+		return report, in.saveLexicalIndex(records, report)
+	}
+
+	start := time.Now()
+	tracker := newProgressTracker(len(pending), report.PendingRows, in.cfg.ProgressInterval)
+	record := func(r batchResult) error {
+		report.Retries += r.retries
+		if r.err != nil {
+			return fmt.Errorf("batch %d (rows %d-%d): %w", r.batch, r.start, r.end, r.err)
+		}
+		cp.markDone(r.batch)
+		if err := cp.save(in.cfg.CheckpointPath); err != nil {
+			return err
+		}
+		report.UpsertedBatches++
+		report.UpsertedRows += r.end - r.start
+		if p, ok := tracker.add(r.end-r.start, r.retries); ok {
+			in.logf("progress: %s", p)
+		}
+		return nil
+	}
+
+	dim := report.Dim
+	if dim == 0 {
+		// the collection is missing: create it from the first batch before
+		// the workers upsert into it
+		r := in.runBatch(ctx, rows, pending[0], dim)
+		if err := record(r); err != nil {
+			report.Elapsed = time.Since(start)
+			return report, err
+		}
+		dim, pending = r.dim, pending[1:]
+		report.Dim = dim
+	}
+
+	err = in.runPool(ctx, rows, pending, dim, record)
+	report.Elapsed = time.Since(start)
+	if err != nil {
+		return report, err
+	}
+
+	if err := in.store.Flush(ctx, in.cfg.Collection); err != nil {
+		return report, err
+	}
+	return report, in.saveLexicalIndex(records, report)
+}
+
+// saveLexicalIndex rebuilds the BM25 index from the whole dataset, so it
+// always matches the rows in the collection. It indexes records, not chunks. The index serves article search,
+// so datasets without a title field are skipped.
+func (in *Ingester) saveLexicalIndex(rows []dataset.Record, report *Report) error {
+	if in.cfg.LexicalIndexPath == "" {
+		return nil
+	}
+	if _, ok := in.mapping.CollectionSpec("", "", 0).Field(articles.FieldTitle); !ok {
+		return nil
+	}
+	index := retrieval.NewLexicalIndex()
+	for _, r := range rows {
+		index.Add(articles.FromRecord(r))
+	}
+	if err := index.Save(in.cfg.LexicalIndexPath); err != nil {
+		return err
+	}
+	report.LexicalIndexPath = in.cfg.LexicalIndexPath
+	return nil
+}
+
+// batchResult is the outcome of one batch.
+type batchResult struct {
+	batch, start, end int
+	dim               int
+	retries           int
+	err               error
+}
+
+// runPool embeds and upserts batches on cfg.Concurrency workers. Upserts are
+// keyed by id, so batches may finish in any order. Results are recorded on
+// the calling goroutine; the first error cancels the remaining batches and is
+// returned. Batches queued when ctx is cancelled are not started.
+func (in *Ingester) runPool(ctx context.Context, rows []dataset.Record, batches []int, dim int, record func(batchResult) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan int)
+	results := make(chan batchResult)
+	go func() {
+		defer close(jobs)
+		for _, b := range batches {
+			select {
+			case jobs <- b:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for range min(in.cfg.Concurrency, len(batches)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b := range jobs {
+				if ctx.Err() != nil {
+					// cancelled: drain the queue without starting batches
+					continue
+				}
+				results <- in.runBatch(ctx, rows, b, dim)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var firstErr error
+	for r := range results {
+		if firstErr != nil {
+			// keep completed batches in the checkpoint after a failure
+			if r.err == nil {
+				_ = record(r)
+			}
+			continue
+		}
+		if err := record(r); err != nil {
+			firstErr = err
+			cancel()
+		}
+	}
+	if firstErr == nil {
+		// the caller cancelled while batches were still queued
+		return ctx.Err()
+	}
+	return firstErr
+}
+
+func (in *Ingester) runBatch(ctx context.Context, rows []dataset.Record, batch, dim int) batchResult {
+	start, end := in.bounds(batch, len(rows))
+	r := batchResult{batch: batch, start: start, end: end}
+	var stale []vectorstore.Filter
+	if in.mapping.Chunking != nil {
+		stale = staleChunks(rows, start, end)
+	}
+	r.dim, r.retries, r.err = in.ingestBatch(ctx, rows[start:end], stale, dim)
+	return r
+}
+
+// staleChunks returns filters matching the chunks an earlier ingestion left
+// beyond the new last chunk of each parent that ends in rows[start:end]: the
+// same parent id with a higher chunk index. A parent's chunks may span
+// batches that run in any order, so only chunks past its last one are
+// deleted. Parents are grouped by chunk count to keep the deletes few.
+func staleChunks(rows []dataset.Record, start, end int) []vectorstore.Filter {
+	var counts []int32
+	parents := map[int32][]any{}
+	for i := start; i < end; i++ {
+		parent := rows[i].Fields[dataset.FieldParentID]
+		if i+1 < len(rows) && rows[i+1].Fields[dataset.FieldParentID] == parent {
+			continue
+		}
+		n, _ := rows[i].Fields[dataset.FieldChunkIndex].(int32)
+		n++
+		if _, ok := parents[n]; !ok {
+			counts = append(counts, n)
+		}
+		parents[n] = append(parents[n], parent)
+	}
+	filters := make([]vectorstore.Filter, len(counts))
+	for i, n := range counts {
+		filters[i] = vectorstore.Filter{
+			vectorstore.In(dataset.FieldParentID, parents[n]...),
+			vectorstore.Gte(dataset.FieldChunkIndex, n),
+		}
+	}
+	return filters
+}
+
+func (in *Ingester) bounds(batch, total int) (int, int) {
+	start := batch * in.cfg.BatchSize
+	return start, min(start+in.cfg.BatchSize, total)
+}
+
+// ingestBatch embeds the texts of batch, deletes the documents matching
+// stale and upserts the batch. The collection is created from the first
+// embedding's dimension when dim is 0. It returns the dimension and the
+// number of retried embedding calls.
+func (in *Ingester) ingestBatch(ctx context.Context, batch []dataset.Record, stale []vectorstore.Filter, dim int) (int, int, error) {
+	texts := make([]string, len(batch))
+	for i, r := range batch {
+		texts[i] = r.Text
+	}
+	tokens := estimateTokens(texts)
+	var embeddings [][]float64
+	retries, err := in.retry.do(ctx, func() error {
+		if err := in.limiter.wait(ctx, tokens); err != nil {
+			return err
+		}
+		var err error
+		embeddings, err = in.embedder.EmbedStrings(ctx, texts)
+		return err
+	})
+	if err != nil {
+		return dim, retries, fmt.Errorf("embed: %w", err)
+	}
+	if len(embeddings) != len(batch) {
+		return dim, retries, fmt.Errorf("embed: got %d embeddings for %d texts", len(embeddings), len(batch))
+	}
+
+	if dim == 0 {
+		if len(embeddings[0]) == 0 {
+			return dim, retries, fmt.Errorf("embed: empty embedding returned")
+		}
+		dim = len(embeddings[0])
+		if want := in.cfg.Embedding.Dimension; want > 0 && dim != want {
+			return dim, retries, fmt.Errorf("embed: got dimension %d, configured %d", dim, want)
+		}
+		spec := in.mapping.CollectionSpec(in.cfg.Collection, in.cfg.VectorField, dim)
+		spec.Properties = in.cfg.Embedding.Properties()
+		if err := in.store.EnsureCollection(ctx, spec); err != nil {
+			return dim, retries, err
+		}
+	}
+
+	docs := make([]vectorstore.Document, len(batch))
+	for i, emb := range embeddings {
+		if len(emb) != dim {
+			return dim, retries, fmt.Errorf("embedding %d has dimension %d, collection has %d", i, len(emb), dim)
+		}
+		vec := make([]float32, len(emb))
+		for j, v := range emb {
+			vec[j] = float32(v)
+		}
+		docs[i] = batch[i].Document(vec)
+	}
+	for _, filter := range stale {
+		if err := in.store.DeleteWhere(ctx, in.cfg.Collection, filter); err != nil {
+			return dim, retries, fmt.Errorf("delete stale chunks: %w", err)
+		}
+	}
+	return dim, retries, in.store.Upsert(ctx, in.cfg.Collection, docs)
+}
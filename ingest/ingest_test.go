@@ -0,0 +1,441 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/components/embedding"
+	"github.com/pawarison/eino-multi-modal-poc/dataset"
+	"github.com/pawarison/eino-multi-modal-poc/embedder"
+	"github.com/pawarison/eino-multi-modal-poc/vectorstore"
+)
+
+// fakeEmbedder returns dim-sized vectors and fails on a batch containing failOn.
+type fakeEmbedder struct {
+	dim int
+
+	mu       sync.Mutex
+	failOn   string
+	embedded []string
+}
+
+func (e *fakeEmbedder) EmbedStrings(ctx context.Context, texts []string, _ ...embedding.Option) ([][]float64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	out := make([][]float64, len(texts))
+	for i, text := range texts {
+		if text == e.failOn {
+			return nil, errors.New("invalid input")
+		}
+		out[i] = make([]float64, e.dim)
+		out[i][0] = 1
+	}
+	e.embedded = append(e.embedded, texts...)
+	return out, nil
+}
+
+// countingStore counts the upserts of each id.
+type countingStore struct {
+	vectorstore.Store
+
+	mu      sync.Mutex
+	upserts map[int64]int
+}
+
+func newCountingStore() *countingStore {
+	return &countingStore{Store: vectorstore.NewMemory(), upserts: map[int64]int{}}
+}
+
+func (s *countingStore) Upsert(ctx context.Context, collection string, docs []vectorstore.Document) error {
+	s.mu.Lock()
+	for _, d := range docs {
+		s.upserts[d.ID]++
+	}
+	s.mu.Unlock()
+	return s.Store.Upsert(ctx, collection, docs)
+}
+
+func testMapping() dataset.Mapping {
+	return dataset.Mapping{
+		ID:     "id",
+		Embed:  []string{"title"},
+		Fields: []dataset.Field{{Name: "title", Type: vectorstore.FieldVarChar, MaxLength: 64}},
+	}
+}
+
+func testConfig(t *testing.T) *Config {
+	return &Config{
+		Collection:       "docs",
+		VectorField:      "vector",
+		Embedding:        embedder.Config{Model: "fake", Dimension: 2},
+		BatchSize:        2,
+		Concurrency:      1,
+		CheckpointPath:   filepath.Join(t.TempDir(), "checkpoint.json"),
+		ProgressInterval: time.Hour,
+	}
+}
+
+func testRows(n int) []dataset.Record {
+	rows := make([]dataset.Record, n)
+	for i := range rows {
+		title := "title " + strconv.Itoa(i+1)
+		rows[i] = dataset.Record{ID: int64(i + 1), Text: title, Fields: map[string]any{"title": title}}
+	}
+	return rows
+}
+
+func newTestIngester(t *testing.T, cfg *Config, emb embedding.Embedder, store vectorstore.Store) *Ingester {
+	t.Helper()
+	in, err := New(cfg, testMapping(), emb, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in.logf = t.Logf
+	return in
+}
+
+func completed(t *testing.T, path string) []int {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cp Checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		t.Fatal(err)
+	}
+	return cp.Completed
+}
+
+func TestRunResumesFromCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	cfg := testConfig(t)
+	emb := &fakeEmbedder{dim: 2, failOn: "title 3"}
+	store := newCountingStore()
+	in := newTestIngester(t, cfg, emb, store)
+	rows := testRows(6)
+
+	// the second of three batches fails: the first stays checkpointed, and
+	// the third is kept only if it finished before the failure cancelled it
+	report, err := in.Run(ctx, rows, false)
+	if err == nil {
+		t.Fatal("failing batch did not stop the run")
+	}
+	done := completed(t, cfg.CheckpointPath)
+	if len(done) == 0 || done[0] != 0 || (len(done) > 1 && !reflect.DeepEqual(done, []int{0, 2})) {
+		t.Fatalf("checkpoint after failure = %v", done)
+	}
+	if !report.CreateCollection || report.UpsertedBatches != len(done) {
+		t.Errorf("first run = %+v", report)
+	}
+	var pending []string
+	for batch := range 3 {
+		if batch == 0 || (batch == 2 && len(done) == 2) {
+			continue
+		}
+		pending = append(pending, "title "+strconv.Itoa(2*batch+1), "title "+strconv.Itoa(2*batch+2))
+	}
+
+	report, err = in.Run(ctx, rows, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.CreateCollection || report.SkippedBatches != len(done) || report.PendingRows != len(pending) || report.UpsertedRows != 0 {
+		t.Errorf("dry run after failure = %+v", report)
+	}
+
+	emb.failOn = ""
+	emb.embedded = nil
+	report, err = in.Run(ctx, rows, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.SkippedBatches != len(done) || report.UpsertedRows != len(pending) {
+		t.Errorf("resumed run = %+v", report)
+	}
+	if got := completed(t, cfg.CheckpointPath); !reflect.DeepEqual(got, []int{0, 1, 2}) {
+		t.Errorf("checkpoint after resume = %v", got)
+	}
+	if !reflect.DeepEqual(emb.embedded, pending) {
+		t.Errorf("resumed run embedded %v, want only the pending batches %v", emb.embedded, pending)
+	}
+	for id := int64(1); id <= 6; id++ {
+		if n := store.upserts[id]; n != 1 {
+			t.Errorf("row %d upserted %d times", id, n)
+		}
+	}
+	if n, err := store.Count(ctx, cfg.Collection); err != nil || n != 6 {
+		t.Errorf("count = %d, %v", n, err)
+	}
+
+	// a finished checkpoint leaves nothing to do
+	report, err = in.Run(ctx, rows, false)
+	if err != nil || report.SkippedBatches != 3 || report.UpsertedBatches != 0 {
+		t.Errorf("rerun = %+v, %v", report, err)
+	}
+}
+
+func TestRunDryRunWritesNothing(t *testing.T) {
+	ctx := context.Background()
+	cfg := testConfig(t)
+	emb := &fakeEmbedder{dim: 2}
+	store := newCountingStore()
+	in := newTestIngester(t, cfg, emb, store)
+
+	report, err := in.Run(ctx, testRows(5), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.DryRun || !report.CreateCollection || report.Batches != 3 || report.PendingBatches != 3 || report.PendingRows != 5 {
+		t.Errorf("report = %+v", report)
+	}
+	if names, err := store.ListCollections(ctx); err != nil || len(names) != 0 {
+		t.Errorf("collections = %v, %v", names, err)
+	}
+	if len(emb.embedded) != 0 || len(store.upserts) != 0 {
+		t.Errorf("dry run embedded %d texts and upserted %d rows", len(emb.embedded), len(store.upserts))
+	}
+	if _, err := os.Stat(cfg.CheckpointPath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("dry run wrote a checkpoint: %v", err)
+	}
+}
+
+func TestRunRefusesMismatchedCollection(t *testing.T) {
+	ctx := context.Background()
+	spec := func(dim int, fields ...vectorstore.Field) vectorstore.CollectionSpec {
+		return vectorstore.CollectionSpec{Name: "docs", VectorField: "vector", Dim: dim, Fields: fields}
+	}
+	title := vectorstore.Field{Name: "title", Type: vectorstore.FieldVarChar, MaxLength: 64}
+	withProps := spec(2, title)
+	withProps.Properties = embedder.Config{Model: "other", Dimension: 2}.Properties()
+
+	tests := map[string]struct {
+		existing *vectorstore.CollectionSpec
+		dim      int
+		want     error
+	}{
+		"field type":       {existing: ptr(spec(2, vectorstore.Field{Name: "title", Type: vectorstore.FieldInt64})), dim: 2, want: vectorstore.ErrSchemaMismatch},
+		"missing field":    {existing: ptr(spec(2, vectorstore.Field{Name: "body", Type: vectorstore.FieldVarChar, MaxLength: 64})), dim: 2, want: vectorstore.ErrSchemaMismatch},
+		"dimension":        {existing: ptr(spec(3, title)), dim: 2, want: embedder.ErrMismatch},
+		"embedding model":  {existing: &withProps, dim: 2, want: embedder.ErrMismatch},
+		"embedded vectors": {dim: 3},
+	}
+	for name, tt := range tests {
+		store := newCountingStore()
+		if tt.existing != nil {
+			if err := store.EnsureCollection(ctx, *tt.existing); err != nil {
+				t.Fatal(err)
+			}
+		}
+		in := newTestIngester(t, testConfig(t), &fakeEmbedder{dim: tt.dim}, store)
+		_, err := in.Run(ctx, testRows(3), false)
+		if err == nil || (tt.want != nil && !errors.Is(err, tt.want)) {
+			t.Errorf("%s: err = %v, want %v", name, err, tt.want)
+		}
+		if len(store.upserts) != 0 {
+			t.Errorf("%s: upserted %d rows", name, len(store.upserts))
+		}
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// embedFunc adapts a function to embedding.Embedder.
+type embedFunc func(ctx context.Context, texts []string) ([][]float64, error)
+
+func (f embedFunc) EmbedStrings(ctx context.Context, texts []string, _ ...embedding.Option) ([][]float64, error) {
+	return f(ctx, texts)
+}
+
+func TestRunPool(t *testing.T) {
+	ctx := context.Background()
+	cfg := testConfig(t)
+	cfg.BatchSize = 1
+	cfg.Concurrency = 3
+	rows := testRows(10)
+	batches := []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	store := vectorstore.NewMemory()
+	spec := testMapping().CollectionSpec(cfg.Collection, cfg.VectorField, 2)
+	if err := store.EnsureCollection(ctx, spec); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("all batches", func(t *testing.T) {
+		in := newTestIngester(t, cfg, &fakeEmbedder{dim: 2}, store)
+		recorded := map[int]bool{}
+		err := in.runPool(ctx, rows, batches, 2, func(r batchResult) error {
+			if r.err != nil {
+				return r.err
+			}
+			recorded[r.batch] = true
+			return nil
+		})
+		if err != nil || len(recorded) != len(batches) {
+			t.Errorf("recorded %v, err %v", recorded, err)
+		}
+	})
+
+	t.Run("first error", func(t *testing.T) {
+		// batch 0 fails while the others block until the pool cancels them,
+		// so the failure is the first result and nothing else completes
+		failure := errors.New("invalid input")
+		var mu sync.Mutex
+		started := 0
+		emb := embedFunc(func(ctx context.Context, texts []string) ([][]float64, error) {
+			mu.Lock()
+			started++
+			mu.Unlock()
+			if texts[0] == "title 1" {
+				return nil, failure
+			}
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+		in := newTestIngester(t, cfg, emb, store)
+		var results []batchResult
+		err := in.runPool(ctx, rows, batches, 2, func(r batchResult) error {
+			results = append(results, r)
+			if r.err != nil {
+				return r.err
+			}
+			return nil
+		})
+		if !errors.Is(err, failure) {
+			t.Fatalf("err = %v, want the failing batch's error", err)
+		}
+		if len(results) != 1 || results[0].batch != 0 {
+			t.Errorf("recorded %+v, want only the failing batch", results)
+		}
+		if started > cfg.Concurrency+1 {
+			t.Errorf("%d batches started after the failure, want the pool to stop", started)
+		}
+	})
+
+	t.Run("record error", func(t *testing.T) {
+		in := newTestIngester(t, cfg, &fakeEmbedder{dim: 2}, store)
+		saveErr := errors.New("disk full")
+		recorded := 0
+		err := in.runPool(ctx, rows, batches, 2, func(r batchResult) error {
+			if r.err != nil {
+				return r.err
+			}
+			recorded++
+			if recorded == 2 {
+				return saveErr
+			}
+			return nil
+		})
+		if !errors.Is(err, saveErr) || recorded >= len(batches) {
+			t.Errorf("recorded %d batches, err %v", recorded, err)
+		}
+	})
+	t.Run("cancelled", func(t *testing.T) {
+		in := newTestIngester(t, cfg, &fakeEmbedder{dim: 2}, store)
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		recorded := 0
+		err := in.runPool(cancelled, rows, batches, 2, func(batchResult) error {
+			recorded++
+			return nil
+		})
+		if !errors.Is(err, context.Canceled) || recorded != 0 {
+			t.Errorf("recorded %d batches, err %v", recorded, err)
+		}
+	})
+}
+
+func TestRunDeletesStaleChunks(t *testing.T) {
+	ctx := context.Background()
+	cfg := testConfig(t)
+	cfg.BatchSize = 1
+	cfg.Concurrency = 3
+	mapping := testMapping()
+	mapping.Chunking = &dataset.Chunking{Source: "body", Size: 8}
+	store := newCountingStore()
+	in, err := New(cfg, mapping, &fakeEmbedder{dim: 2}, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in.logf = t.Logf
+	rows := func(bodies ...string) []dataset.Record {
+		out := testRows(len(bodies))
+		for i := range out {
+			out[i].Body = bodies[i]
+		}
+		return out
+	}
+	ids := func() []int64 {
+		docs, err := store.Query(ctx, cfg.Collection, vectorstore.Filter{vectorstore.Gte(vectorstore.PrimaryField, 0)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out []int64
+		for _, d := range docs {
+			out = append(out, d.ID)
+		}
+		slices.Sort(out)
+		return out
+	}
+
+	if _, err := in.Run(ctx, rows("aaa bbb ccc ddd eee fff", "ggg hhh iii jjj"), false); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ids(), []int64{10000, 10001, 10002, 20000, 20001}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("first run ids = %v, want %v", got, want)
+	}
+
+	// record 1 shrinks to one chunk and record 2 keeps its two: only the
+	// chunks past record 1's new last one are deleted
+	if _, err := in.Run(ctx, rows("aaa", "ggg hhh iii kkk"), false); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ids(), []int64{10000, 20000, 20001}; !reflect.DeepEqual(got, want) {
+		t.Errorf("second run ids = %v, want %v", got, want)
+	}
+}
+
+func TestStaleChunks(t *testing.T) {
+	mapping := testMapping()
+	mapping.Chunking = &dataset.Chunking{Source: "body", Size: 4}
+	records := testRows(3)
+	for i, body := range []string{"aaa bbb ccc", "ddd", "eee fff"} {
+		records[i].Body = body
+	}
+	rows, err := mapping.Chunk(records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// rows: 1/0 1/1 1/2 | 2/0 3/0 | 3/1
+	tests := []struct {
+		start, end int
+		want       []vectorstore.Filter
+	}{
+		{0, 2, []vectorstore.Filter{}},
+		{2, 5, []vectorstore.Filter{
+			{vectorstore.In(dataset.FieldParentID, int64(1)), vectorstore.Gte(dataset.FieldChunkIndex, int32(3))},
+			{vectorstore.In(dataset.FieldParentID, int64(2)), vectorstore.Gte(dataset.FieldChunkIndex, int32(1))},
+		}},
+		{5, 6, []vectorstore.Filter{
+			{vectorstore.In(dataset.FieldParentID, int64(3)), vectorstore.Gte(dataset.FieldChunkIndex, int32(2))},
+		}},
+	}
+	for _, tt := range tests {
+		if got := staleChunks(rows, tt.start, tt.end); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("staleChunks(%d, %d) = %v, want %v", tt.start, tt.end, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package ingest
+
+import (
+	"fmt"
+	"time"
+)
+
+// Progress is a snapshot of a running ingestion.
+type Progress struct {
+	Batches      int
+	TotalBatches int
+	Rows         int
+	TotalRows    int
+	Retries      int
+	Elapsed      time.Duration
+	// RowsPerSecond is the throughput since the run started.
+	RowsPerSecond float64
+	// ETA is the remaining time at the current throughput, or 0 when unknown.
+	ETA time.Duration
+}
+
+func (p Progress) String() string {
+	eta := "unknown"
+	if p.ETA > 0 || p.Rows == p.TotalRows {
+		eta = p.ETA.Round(time.Second).String()
+	}
+	return fmt.Sprintf("batches %d/%d, rows %d/%d, %.1f rows/s, retries %d, elapsed %s, eta %s",
+		p.Batches, p.TotalBatches, p.Rows, p.TotalRows, p.RowsPerSecond, p.Retries,
+		p.Elapsed.Round(time.Second), eta)
+}
+
+// progressTracker counts completed batches and decides when to report.
+type progressTracker struct {
+	start    time.Time
+	interval time.Duration
+	lastLog  time.Time
+	current  Progress
+}
+
+func newProgressTracker(totalBatches, totalRows int, interval time.Duration) *progressTracker {
+	now := time.Now()
+	return &progressTracker{
+		start:    now,
+		interval: interval,
+		lastLog:  now,
+		current:  Progress{TotalBatches: totalBatches, TotalRows: totalRows},
+	}
+}
+
+// add records a completed batch. It returns the new snapshot and whether it
+// should be reported: at most once per interval, and always for the last batch.
+func (t *progressTracker) add(rows, retries int) (Progress, bool) {
+	now := time.Now()
+	p := &t.current
+	p.Batches++
+	p.Rows += rows
+	p.Retries += retries
+	p.Elapsed = now.Sub(t.start)
+	if secs := p.Elapsed.Seconds(); secs > 0 {
+		p.RowsPerSecond = float64(p.Rows) / secs
+	}
+	p.ETA = 0
+	if p.RowsPerSecond > 0 {
+		p.ETA = time.Duration(float64(p.TotalRows-p.Rows) / p.RowsPerSecond * float64(time.Second))
+	}
+
+	done := p.Batches == p.TotalBatches
+	if !done && now.Sub(t.lastLog) < t.interval {
+		return *p, false
+	}
+	t.lastLog = now
+	return *p, true
+}
@@ -0,0 +1,89 @@
+package ingest
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// tokenBucket refills at rate units per second up to capacity.
+type tokenBucket struct {
+	mu       sync.Mutex
+	capacity float64
+	rate     float64
+	tokens   float64
+	last     time.Time
+	now      func() time.Time
+}
+
+// newPerMinuteBucket allows perMinute units per minute with a burst of one
+// minute's worth, reading the time from now. A non-positive limit disables the bucket.
+func newPerMinuteBucket(perMinute int, now func() time.Time) *tokenBucket {
+	if perMinute <= 0 {
+		return nil
+	}
+	capacity := float64(perMinute)
+	return &tokenBucket{capacity: capacity, rate: capacity / 60, tokens: capacity, last: now(), now: now}
+}
+
+// reserve takes n units and returns how long to wait before they are
+// available. Requests larger than the capacity are clamped to it.
+func (b *tokenBucket) reserve(n float64) time.Duration {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	b.tokens = min(b.capacity, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens -= min(n, b.capacity)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// limiter enforces the requests-per-minute and tokens-per-minute quotas of the embedding API.
+type limiter struct {
+	requests *tokenBucket
+	tokens   *tokenBucket
+	sleep    func(context.Context, time.Duration) error
+}
+
+// newLimiter creates a limiter that reads the time from now and waits with sleep.
+func newLimiter(rpm, tpm int, now func() time.Time, sleep func(context.Context, time.Duration) error) *limiter {
+	return &limiter{requests: newPerMinuteBucket(rpm, now), tokens: newPerMinuteBucket(tpm, now), sleep: sleep}
+}
+
+// wait blocks until one request carrying tokens is allowed or ctx is done.
+func (l *limiter) wait(ctx context.Context, tokens int) error {
+	delay := max(l.requests.reserve(1), l.tokens.reserve(float64(tokens)))
+	if delay <= 0 {
+		return nil
+	}
+	return l.sleep(ctx, delay)
+}
+
+// sleepContext waits for d or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// estimateTokens approximates the token count of texts at four bytes per
+// token. The API does not report usage for embeddings, so this is what the
+// tokens-per-minute bucket is charged.
+func estimateTokens(texts []string) int {
+	total := 0
+	for _, t := range texts {
+		total += max(1, (len(t)+3)/4)
+	}
+	return total
+}
@@ -0,0 +1,111 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock that only moves when sleep is called.
+type fakeClock struct {
+	t     time.Time
+	slept []time.Duration
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func (c *fakeClock) sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.slept = append(c.slept, d)
+	c.t = c.t.Add(d)
+	return nil
+}
+
+func TestLimiterRequestsPerMinute(t *testing.T) {
+	ctx := context.Background()
+	clock := newFakeClock()
+	l := newLimiter(60, 0, clock.now, clock.sleep)
+
+	// a full minute's burst is allowed at once
+	for range 60 {
+		if err := l.wait(ctx, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(clock.slept) != 0 {
+		t.Fatalf("burst slept %v", clock.slept)
+	}
+	// then one request per second
+	for range 2 {
+		if err := l.wait(ctx, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := []time.Duration{time.Second, time.Second}; !reflect.DeepEqual(clock.slept, want) {
+		t.Errorf("slept %v, want %v", clock.slept, want)
+	}
+
+	// idle time refills the bucket
+	clock.t = clock.t.Add(time.Minute)
+	clock.slept = nil
+	if err := l.wait(ctx, 1); err != nil || len(clock.slept) != 0 {
+		t.Errorf("after a minute idle: slept %v, %v", clock.slept, err)
+	}
+}
+
+func TestLimiterTokensPerMinute(t *testing.T) {
+	ctx := context.Background()
+	clock := newFakeClock()
+	l := newLimiter(0, 100, clock.now, clock.sleep)
+
+	// a request above the capacity is clamped to it instead of waiting forever
+	if err := l.wait(ctx, 150); err != nil || len(clock.slept) != 0 {
+		t.Fatalf("first request slept %v, %v", clock.slept, err)
+	}
+	// 50 tokens at 100 per minute take 30s to refill
+	if err := l.wait(ctx, 50); err != nil {
+		t.Fatal(err)
+	}
+	if want := []time.Duration{30 * time.Second}; !reflect.DeepEqual(clock.slept, want) {
+		t.Errorf("slept %v, want %v", clock.slept, want)
+	}
+}
+
+func TestLimiterWait(t *testing.T) {
+	clock := newFakeClock()
+	unlimited := newLimiter(0, 0, clock.now, clock.sleep)
+	for range 1000 {
+		if err := unlimited.wait(context.Background(), 1000); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(clock.slept) != 0 {
+		t.Errorf("unlimited limiter slept %v", clock.slept)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	l := newLimiter(1, 0, clock.now, clock.sleep)
+	if err := l.wait(ctx, 1); err != nil {
+		t.Fatalf("first request: %v", err)
+	}
+	if err := l.wait(ctx, 1); !errors.Is(err, context.Canceled) {
+		t.Errorf("wait on a cancelled context = %v", err)
+	}
+}
+
+func TestEstimateTokens(t *testing.T) {
+	if got := estimateTokens([]string{"", "abcd", "abcde"}); got != 4 {
+		t.Errorf("estimateTokens = %d, want 4", got)
+	}
+}
@@ -0,0 +1,55 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+// retryPolicy retries rate-limited and server errors with exponential
+// backoff and full jitter.
+type retryPolicy struct {
+	maxRetries int
+	baseDelay  time.Duration
+	maxDelay   time.Duration
+	sleep      func(context.Context, time.Duration) error
+}
+
+// do runs fn until it succeeds, fails with a non-retryable error, or the
+// retries are used up. It returns the number of retries made.
+func (p retryPolicy) do(ctx context.Context, fn func() error) (int, error) {
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.maxRetries || !retryable(err) {
+			return attempt, err
+		}
+		delay := min(p.maxDelay, p.baseDelay<<attempt)
+		if delay > 0 {
+			delay = rand.N(delay) + 1
+		}
+		if sleepErr := p.sleep(ctx, delay); sleepErr != nil {
+			return attempt, errors.Join(err, sleepErr)
+		}
+	}
+}
+
+// retryable reports whether err is an HTTP 429 or 5xx from the Gemini API.
+func retryable(err error) bool {
+	var apiErr genai.APIError
+	if errors.As(err, &apiErr) {
+		return retryableStatus(apiErr.Code)
+	}
+	var apiErrPtr *genai.APIError
+	if errors.As(err, &apiErrPtr) && apiErrPtr != nil {
+		return retryableStatus(apiErrPtr.Code)
+	}
+	return false
+}
+
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
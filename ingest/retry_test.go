@@ -0,0 +1,84 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{genai.APIError{Code: 429}, true},
+		{&genai.APIError{Code: 503}, true},
+		{fmt.Errorf("embed: %w", genai.APIError{Code: 500}), true},
+		{genai.APIError{Code: 400}, false},
+		{&genai.APIError{Code: 404}, false},
+		{errors.New("connection reset"), false},
+		{context.DeadlineExceeded, false},
+	}
+	for _, tt := range tests {
+		if got := retryable(tt.err); got != tt.want {
+			t.Errorf("retryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	rateLimited := &genai.APIError{Code: 429}
+	permanent := &genai.APIError{Code: 400}
+	tests := []struct {
+		name        string
+		errs        []error
+		wantCalls   int
+		wantRetries int
+		wantErr     error
+	}{
+		{"success", []error{nil}, 1, 0, nil},
+		{"recovers", []error{rateLimited, &genai.APIError{Code: 502}, nil}, 3, 2, nil},
+		{"permanent", []error{permanent, nil}, 1, 0, permanent},
+		{"attempt cap", []error{rateLimited, rateLimited, rateLimited, rateLimited, nil}, 4, 3, rateLimited},
+	}
+	for _, tt := range tests {
+		clock := newFakeClock()
+		p := retryPolicy{maxRetries: 3, baseDelay: time.Second, maxDelay: 3 * time.Second, sleep: clock.sleep}
+		calls := 0
+		retries, err := p.do(context.Background(), func() error {
+			calls++
+			return tt.errs[calls-1]
+		})
+		if calls != tt.wantCalls || retries != tt.wantRetries || !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+			t.Errorf("%s: %d calls, %d retries, err %v; want %d, %d, %v", tt.name, calls, retries, err, tt.wantCalls, tt.wantRetries, tt.wantErr)
+		}
+		if len(clock.slept) != tt.wantRetries {
+			t.Errorf("%s: slept %v", tt.name, clock.slept)
+		}
+		// full jitter: each delay is in (0, min(maxDelay, baseDelay<<attempt)]
+		for attempt, d := range clock.slept {
+			if ceiling := min(p.maxDelay, p.baseDelay<<attempt); d <= 0 || d > ceiling {
+				t.Errorf("%s: retry %d slept %v, want (0, %v]", tt.name, attempt, d, ceiling)
+			}
+		}
+	}
+}
+
+func TestRetryPolicyCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p := retryPolicy{maxRetries: 3, baseDelay: time.Second, maxDelay: time.Second, sleep: newFakeClock().sleep}
+	calls := 0
+	rateLimited := &genai.APIError{Code: 429}
+	retries, err := p.do(ctx, func() error {
+		calls++
+		return rateLimited
+	})
+	if calls != 1 || retries != 0 || !errors.Is(err, context.Canceled) || !errors.Is(err, rateLimited) {
+		t.Errorf("%d calls, %d retries, err %v", calls, retries, err)
+	}
+}
@@ -0,0 +1,88 @@
+// Package llm provides chat models for running LLM-backed stages without a
+// live provider: a scripted fake and a record/replay wrapper.
+package llm
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+)
+
+// Fake is a chat model that answers with a reply function. It is safe for concurrent use.
+type Fake struct {
+	reply func(input []*schema.Message, tools []*schema.ToolInfo) (*schema.Message, error)
+	tools []*schema.ToolInfo
+	calls *counter
+}
+
+type counter struct {
+	mu sync.Mutex
+	n  int
+}
+
+var _ model.ToolCallingChatModel = (*Fake)(nil)
+
+// NewFake creates a fake that answers every call with respond.
+func NewFake(respond func(input []*schema.Message) (string, error)) *Fake {
+	return NewToolFake(func(input []*schema.Message, _ []*schema.ToolInfo) (*schema.Message, error) {
+		content, err := respond(input)
+		if err != nil {
+			return nil, err
+		}
+		return schema.AssistantMessage(content, nil), nil
+	})
+}
+
+// NewToolFake creates a fake that answers every call with reply, which also
+// sees the tools bound with WithTools, so it can return tool calls.
+func NewToolFake(reply func(input []*schema.Message, tools []*schema.ToolInfo) (*schema.Message, error)) *Fake {
+	return &Fake{reply: reply, calls: &counter{}}
+}
+
+// NewScripted creates a fake that returns replies in order and fails once they run out.
+func NewScripted(replies ...string) *Fake {
+	var mu sync.Mutex
+	next := 0
+	return NewFake(func([]*schema.Message) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if next >= len(replies) {
+			return "", fmt.Errorf("fake model: no reply left after %d calls", len(replies))
+		}
+		next++
+		return replies[next-1], nil
+	})
+}
+
+// Calls is the number of Generate and Stream calls so far, including calls
+// on the models returned by WithTools.
+func (f *Fake) Calls() int {
+	f.calls.mu.Lock()
+	defer f.calls.mu.Unlock()
+	return f.calls.n
+}
+
+// WithTools returns a copy of the fake bound to tools. The copy shares the call count.
+func (f *Fake) WithTools(tools []*schema.ToolInfo) (model.ToolCallingChatModel, error) {
+	bound := *f
+	bound.tools = append([]*schema.ToolInfo{}, tools...)
+	return &bound, nil
+}
+
+func (f *Fake) Generate(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	f.calls.mu.Lock()
+	f.calls.n++
+	f.calls.mu.Unlock()
+	return f.reply(input, f.tools)
+}
+
+func (f *Fake) Stream(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	msg, err := f.Generate(ctx, input, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return schema.StreamReaderFromArray([]*schema.Message{msg}), nil
+}
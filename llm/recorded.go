@@ -0,0 +1,137 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+)
+
+// ErrNotRecorded is returned in replay mode for a conversation that has no recording.
+var ErrNotRecorded = errors.New("no recorded response")
+
+// Recorded replays chat responses from a file keyed by the hash of the input
+// messages. With a live model, misses are sent to it and recorded, so a run
+// against the real provider produces a file later runs replay offline.
+type Recorded struct {
+	path string
+	live model.BaseChatModel
+
+	mu      sync.Mutex
+	entries map[string]recording
+	dirty   bool
+}
+
+type recording struct {
+	Response string `json:"response"`
+}
+
+// OpenRecorded loads the recordings at path; a missing file starts empty.
+// live may be nil to replay only.
+func OpenRecorded(path string, live model.BaseChatModel) (*Recorded, error) {
+	r := &Recorded{path: path, live: live, entries: map[string]recording{}}
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return r, nil
+	case err != nil:
+		return nil, fmt.Errorf("read recordings %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, &r.entries); err != nil {
+		return nil, fmt.Errorf("decode recordings %s: %w", path, err)
+	}
+	return r, nil
+}
+
+func (r *Recorded) Generate(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.Message, error) {
+	key := conversationKey(input)
+	r.mu.Lock()
+	rec, ok := r.entries[key]
+	r.mu.Unlock()
+	if ok {
+		return schema.AssistantMessage(rec.Response, nil), nil
+	}
+	if r.live == nil {
+		return nil, fmt.Errorf("%w for conversation %s in %s", ErrNotRecorded, key[:12], r.path)
+	}
+
+	out, err := r.live.Generate(ctx, input, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if out == nil {
+		return nil, fmt.Errorf("live model returned no message")
+	}
+	r.mu.Lock()
+	r.entries[key] = recording{Response: out.Content}
+	r.dirty = true
+	r.mu.Unlock()
+	return out, nil
+}
+
+func (r *Recorded) Stream(ctx context.Context, input []*schema.Message, opts ...model.Option) (*schema.StreamReader[*schema.Message], error) {
+	msg, err := r.Generate(ctx, input, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return schema.StreamReaderFromArray([]*schema.Message{msg}), nil
+}
+
+// Save writes new recordings to the file atomically. It does nothing when
+// nothing was recorded.
+func (r *Recorded) Save() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.dirty {
+		return nil
+	}
+	data, err := json.MarshalIndent(r.entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode recordings: %w", err)
+	}
+	dir := filepath.Dir(r.path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("create recordings dir %s: %w", dir, err)
+	}
+	tmp, err := os.CreateTemp(dir, ".recordings-*")
+	if err != nil {
+		return fmt.Errorf("write recordings: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write recordings: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close recordings: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), r.path); err != nil {
+		return fmt.Errorf("commit recordings %s: %w", r.path, err)
+	}
+	r.dirty = false
+	return nil
+}
+
+// conversationKey hashes the roles and contents of the input messages.
+func conversationKey(input []*schema.Message) string {
+	h := sha256.New()
+	for _, m := range input {
+		if m == nil {
+			continue
+		}
+		h.Write([]byte(m.Role))
+		h.Write([]byte{0})
+		h.Write([]byte(m.Content))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -1,25 +1,46 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/cloudwego/eino-ext/components/model/gemini"
 	"github.com/cloudwego/eino/compose"
 	"github.com/cloudwego/eino/schema"
 	"github.com/joho/godotenv"
+	"github.com/pawarison/eino-multi-modal-poc/agent"
+	"github.com/pawarison/eino-multi-modal-poc/config"
+	"github.com/pawarison/eino-multi-modal-poc/dialogue"
+	"github.com/pawarison/eino-multi-modal-poc/nlu"
+	"github.com/pawarison/eino-multi-modal-poc/privacy"
+	mbtiprompt "github.com/pawarison/eino-multi-modal-poc/prompt/mbti"
+	"github.com/pawarison/eino-multi-modal-poc/retrieval"
+	"github.com/pawarison/eino-multi-modal-poc/tools"
+	"github.com/pawarison/eino-multi-modal-poc/vectorstore"
 	"google.golang.org/genai"
 )
 
+// toolGuidance is appended to the persona prompt for the article tools.
+const toolGuidance = "<tools>Use search_articles or recommend_articles to find articles before recommending them, and cite their links.</tools>"
+
 func main() {
 	_ = godotenv.Load()
 
-	// systemPrompt, err := loadSystemPrompt()
-	// if err != nil {
-	// 	fmt.Println("failed to load system prompt:", err)
-	// 	return
-	// }
+	promptCfg, err := config.New[mbtiprompt.Config]("")
+	if err != nil {
+		fmt.Println("failed to load system prompt config:", err)
+		return
+	}
+	persona, err := mbtiprompt.RenderSystemPrompt(promptCfg)
+	if err != nil {
+		fmt.Println("failed to render system prompt:", err)
+		return
+	}
+	systemPrompt := persona + "\n" + toolGuidance
 
 	apiKey := os.Getenv("GEMINI_API_KEY")
 	if apiKey == "" {
@@ -62,17 +83,127 @@ func main() {
 		return
 	}
 
-	chatGraph := compose.NewGraph[[]*schema.Message, *schema.Message]()
-	if err := chatGraph.AddChatModelNode("llm", chatModel); err != nil {
-		fmt.Println("failed to add chat model node:", err)
+	clientsCfg, err := config.New[tools.ClientsConfig]("")
+	if err != nil {
+		fmt.Println("failed to load clients config:", err)
 		return
 	}
-	if err := chatGraph.AddEdge(compose.START, "llm"); err != nil {
-		fmt.Println("failed to link start to llm:", err)
+	clients, err := tools.NewClients(ctx, clientsCfg)
+	if err != nil {
+		fmt.Println("failed to create clients:", err)
 		return
 	}
-	if err := chatGraph.AddEdge("llm", compose.END); err != nil {
-		fmt.Println("failed to link llm to end:", err)
+	defer func() {
+		closeCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := clients.Close(closeCtx); err != nil {
+			fmt.Println("failed to close clients:", err)
+		}
+	}()
+
+	searchCfg, err := config.New[tools.SearchArticlesConfig]("")
+	if err != nil {
+		fmt.Println("failed to load search config:", err)
+		return
+	}
+	retrievalCfg, err := config.New[retrieval.Config]("")
+	if err != nil {
+		fmt.Println("failed to load retrieval config:", err)
+		return
+	}
+	searcher, err := retrieval.LoadSearcher(ctx, retrievalCfg, clients.QueryEmbedder, vectorstore.NewMilvus(clients.Milvus))
+	if err != nil {
+		fmt.Println("failed to create searcher:", err)
+		return
+	}
+	rerankCfg, err := config.New[retrieval.RerankConfig]("")
+	if err != nil {
+		fmt.Println("failed to load rerank config:", err)
+		return
+	}
+	reranker, err := retrieval.NewReranker(rerankCfg, chatModel)
+	if err != nil {
+		fmt.Println("failed to create reranker:", err)
+		return
+	}
+	searchTool, err := tools.NewSearchArticlesTool(searchCfg, searcher, reranker)
+	if err != nil {
+		fmt.Println("failed to create search tool:", err)
+		return
+	}
+	recommendTool, err := tools.NewRecommendArticlesTool(searchCfg, searcher, reranker)
+	if err != nil {
+		fmt.Println("failed to create recommend tool:", err)
+		return
+	}
+	registry := tools.NewRegistry()
+	if err := registry.Register(ctx, tools.Spec{Tool: searchTool, SideEffect: tools.SideEffectReadOnly}); err != nil {
+		fmt.Println("failed to register search tool:", err)
+		return
+	}
+	if err := registry.Register(ctx, tools.Spec{Tool: recommendTool, SideEffect: tools.SideEffectReadOnly}); err != nil {
+		fmt.Println("failed to register recommend tool:", err)
+		return
+	}
+
+	reactCfg, err := config.New[agent.ReactConfig]("")
+	if err != nil {
+		fmt.Println("failed to load agent config:", err)
+		return
+	}
+	reactAgent, err := agent.NewRegistryAgent(chatModel, registry, reactCfg)
+	if err != nil {
+		fmt.Println("failed to create agent:", err)
+		return
+	}
+
+	nluCfg, err := config.New[nlu.Config]("")
+	if err != nil {
+		fmt.Println("failed to load nlu config:", err)
+		return
+	}
+	understander, err := nlu.New(ctx, nluCfg, chatModel)
+	if err != nil {
+		fmt.Println("failed to create nlu pipeline:", err)
+		return
+	}
+	askCfg, err := config.New[dialogue.AskConfig]("")
+	if err != nil {
+		fmt.Println("failed to load ask config:", err)
+		return
+	}
+	asker, err := dialogue.NewAskGenerator(askCfg, chatModel)
+	if err != nil {
+		fmt.Println("failed to create ask generator:", err)
+		return
+	}
+	escalationCfg, err := config.New[dialogue.EscalationPolicy]("")
+	if err != nil {
+		fmt.Println("failed to load escalation config:", err)
+		return
+	}
+	confirmCfg, err := config.New[dialogue.ConfirmPolicy]("")
+	if err != nil {
+		fmt.Println("failed to load confirm config:", err)
+		return
+	}
+	confirmer, err := dialogue.NewConfirmer(confirmCfg)
+	if err != nil {
+		fmt.Println("failed to create confirmer:", err)
+		return
+	}
+
+	chatGraph := compose.NewGraph[*agent.Input, *agent.Result]()
+	if err := chatGraph.AddLambdaNode("agent", reactAgent.Lambda()); err != nil {
+		fmt.Println("failed to add agent node:", err)
+		return
+	}
+	if err := chatGraph.AddEdge(compose.START, "agent"); err != nil {
+		fmt.Println("failed to link start to agent:", err)
+		return
+	}
+	if err := chatGraph.AddEdge("agent", compose.END); err != nil {
+		fmt.Println("failed to link agent to end:", err)
 		return
 	}
 
@@ -82,4 +213,83 @@ func main() {
 		return
 	}
 
+	state := dialogue.NewDialogueState()
+	// history and every model call only see PII as placeholders in vault
+	vault := privacy.NewVault()
+	redactor := privacy.NewRedactor()
+	var history []*schema.Message
+	say := func(text string) {
+		history = append(history, schema.AssistantMessage(redactor.Redact(text, vault), nil))
+		fmt.Println("bot>", text)
+		fmt.Print("you> ")
+	}
+	scanner := bufio.NewScanner(os.Stdin)
+	fmt.Print("you> ")
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			fmt.Print("you> ")
+			continue
+		}
+		if state.Confirmation != nil {
+			// a reply to the confirmation question: only an explicit yes moves on
+			history = append(history, schema.UserMessage(redactor.Redact(line, vault)))
+			confirmed := confirmer.Handle(state, line)
+			if confirmed.Outcome != dialogue.ConfirmYes {
+				say(confirmed.Text)
+				continue
+			}
+		} else {
+			understood, err := understander.Understand(ctx, state, line, vault)
+			if err != nil {
+				fmt.Println("failed to understand message:", err)
+				fmt.Print("you> ")
+				continue
+			}
+			history = append(history, schema.UserMessage(redactor.Redact(line, vault)))
+
+			dialogue.Escalate(state, understood.Required, *escalationCfg)
+			if state.Handoff {
+				fmt.Println("bot>", asker.HandoffMessage(state.Language))
+				return
+			}
+			question, err := asker.AskFor(ctx, state, understood.Required, vault)
+			if err != nil {
+				fmt.Println("failed to ask for missing slots:", err)
+			}
+			if question != nil {
+				say(question.Text)
+				continue
+			}
+			if text, ok := confirmer.Begin(state, understood.Required); ok {
+				say(text)
+				continue
+			}
+		}
+
+		slots := state.Slots.Values()
+		for k, v := range slots {
+			slots[k] = redactor.Redact(v, vault)
+		}
+		res, err := chatRunnable.Invoke(ctx, &agent.Input{
+			SystemPrompt: systemPrompt,
+			Intent:       state.ActiveIntent,
+			Slots:        slots,
+			History:      history,
+		})
+		if err != nil {
+			fmt.Println("failed to run agent:", err)
+			history = history[:len(history)-1]
+			fmt.Print("you> ")
+			continue
+		}
+		history = append(history, schema.AssistantMessage(res.Message.Content, nil))
+		fmt.Println("bot>", vault.Restore(res.Message.Content))
+		// the agent served the active intent; go back to an interrupted task
+		if state.CompleteIntent() != nil {
+			say(asker.ResumePrompt(state))
+			continue
+		}
+		fmt.Print("you> ")
+	}
 }
@@ -0,0 +1,147 @@
+// Package nlu runs the understanding stage of a turn: intent detection merged
+// into the dialogue state, then entity extraction merged into its slot memory.
+package nlu
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+	"github.com/pawarison/eino-multi-modal-poc/dialogue"
+	"github.com/pawarison/eino-multi-modal-poc/privacy"
+	entity "github.com/pawarison/eino-multi-modal-poc/prompt/entity"
+	"github.com/pawarison/eino-multi-modal-poc/prompt/intent"
+)
+
+// Config holds the prompt settings and dialogue policies of the stage. Load it
+// with config.New; the embedded structs keep their own variable names.
+type Config struct {
+	intent.IntentModelConfig
+	entity.EntityModelConfig
+	dialogue.MergePolicy
+	dialogue.SlotPolicy
+}
+
+// Result is what one turn was understood as.
+type Result struct {
+	Decision dialogue.MergeDecision
+	Update   dialogue.SlotUpdate
+	// Required are the slots the active intent needs; Missing are those still
+	// neither filled nor skipped.
+	Required []string
+	Missing  []string
+}
+
+// Pipeline detects intents and extracts entities with a chat model.
+type Pipeline struct {
+	cfg          Config
+	model        model.BaseChatModel
+	intentSystem string
+	entities     []string
+	redactor     *privacy.Redactor
+}
+
+// New creates a pipeline. The intent prompt is rendered once here.
+func New(ctx context.Context, cfg *Config, chatModel model.BaseChatModel) (*Pipeline, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("nlu config is nil")
+	}
+	if chatModel == nil {
+		return nil, fmt.Errorf("chat model is nil")
+	}
+	system, err := intent.RenderintentSystem(ctx, &cfg.IntentModelConfig)
+	if err != nil {
+		return nil, err
+	}
+	var entities []string
+	for _, e := range strings.Split(cfg.Entities, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			entities = append(entities, e)
+		}
+	}
+	return &Pipeline{cfg: *cfg, model: chatModel, intentSystem: system, entities: entities, redactor: privacy.NewRedactor()}, nil
+}
+
+// Understand merges the intents detected in message into state and, while an
+// intent is active, the entities extracted from it into state.Slots. Anaphora
+// such as "that one" are resolved against the slots even when nothing new was
+// extracted. Pending questions answered by this turn are cleared.
+//
+// The models only see message and the filled slots with PII replaced by
+// placeholders in vault; extracted spans are restored onto message before they
+// are merged. A nil vault redacts with a vault of its own.
+func (p *Pipeline) Understand(ctx context.Context, state *dialogue.DialogueState, message string, vault *privacy.Vault) (*Result, error) {
+	if state == nil {
+		return nil, fmt.Errorf("dialogue state is nil")
+	}
+	if vault == nil {
+		vault = privacy.NewVault()
+	}
+	redacted := p.redactor.Redact(message, vault)
+	detected, err := p.detect(ctx, redacted)
+	if err != nil {
+		return nil, err
+	}
+	res := &Result{Decision: dialogue.MergeState(state, detected, p.cfg.MergePolicy)}
+
+	var extracted *entity.EntityOutput
+	if state.ActiveIntent != "" {
+		res.Required = entity.RequiredKeysForIntent(state.ActiveIntent)
+		extracted, err = p.extract(ctx, state, res.Required, redacted, vault)
+		if err != nil {
+			return nil, err
+		}
+		vault.RestoreEntities(redacted, extracted)
+	}
+	res.Update = state.Slots.Merge(state.Turn, message, extracted, p.cfg.SlotPolicy)
+	state.ClearPending()
+	res.Missing = state.Missing(res.Required)
+	return res, nil
+}
+
+func (p *Pipeline) detect(ctx context.Context, message string) (*intent.IntentOutput, error) {
+	raw, err := p.generate(ctx, p.intentSystem, message)
+	if err != nil {
+		return nil, fmt.Errorf("detect intent: %w", err)
+	}
+	return intent.ParseIntentOutput(raw)
+}
+
+func (p *Pipeline) extract(ctx context.Context, state *dialogue.DialogueState, required []string, message string, vault *privacy.Vault) (*entity.EntityOutput, error) {
+	filled := state.Slots.Values()
+	for k, v := range filled {
+		filled[k] = p.redactor.Redact(v, vault)
+	}
+	system, err := entity.RenderEntitySystem(ctx, &entity.EntityModelInput{
+		IntentName:      state.ActiveIntent,
+		RequiredKeys:    required,
+		AllowedEntities: p.entities,
+		FilledSlots:     filled,
+		UserMessage:     message,
+		Language:        state.Language,
+	})
+	if err != nil {
+		return nil, err
+	}
+	raw, err := p.generate(ctx, system, message)
+	if err != nil {
+		return nil, fmt.Errorf("extract entities: %w", err)
+	}
+	return entity.ParseEntityOutput(raw)
+}
+
+func (p *Pipeline) generate(ctx context.Context, system, message string) (string, error) {
+	out, err := p.model.Generate(ctx, []*schema.Message{
+		schema.SystemMessage(system),
+		schema.UserMessage(message),
+	})
+	if err != nil {
+		return "", err
+	}
+	if out == nil {
+		return "", fmt.Errorf("empty response")
+	}
+	return out.Content, nil
+}
@@ -0,0 +1,140 @@
+package nlu
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/pawarison/eino-multi-modal-poc/config"
+	"github.com/pawarison/eino-multi-modal-poc/dialogue"
+	"github.com/pawarison/eino-multi-modal-poc/llm"
+	"github.com/pawarison/eino-multi-modal-poc/privacy"
+)
+
+const purchaseIntent = "(intent<||>purchase_intent<||>0.90<||>0.80<||>{})##(language<||>eng<||>0.99<||>1<||>{})##<|COMPLETE|>"
+
+func TestUnderstandCarriesSlotsAcrossTurns(t *testing.T) {
+	t.Setenv("NLU_REQUIRED_PURCHASE_INTENT", "product,color")
+	cfg, err := config.New[Config]("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replies := []string{
+		purchaseIntent,
+		"(entity<||>product<||>iPhone<||>9<||>15<||>0.95)##<|COMPLETE|>",
+		purchaseIntent,
+		"(entity<||>color<||>blue<||>4<||>8<||>0.90)##<|COMPLETE|>",
+	}
+	var prompts []string
+	model := llm.NewFake(func(input []*schema.Message) (string, error) {
+		prompts = append(prompts, input[0].Content)
+		reply := replies[0]
+		replies = replies[1:]
+		return reply, nil
+	})
+	p, err := New(context.Background(), cfg, model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := dialogue.NewDialogueState()
+
+	first, err := p.Understand(context.Background(), state, "I want an iPhone", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Decision.Action != dialogue.ActionStart || state.ActiveIntent != "purchase_intent" {
+		t.Fatalf("decision = %+v, active %q", first.Decision, state.ActiveIntent)
+	}
+	if !reflect.DeepEqual(first.Missing, []string{"color"}) {
+		t.Fatalf("missing = %v, want [color]", first.Missing)
+	}
+
+	second, err := p.Understand(context.Background(), state, "the blue one", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(prompts[3], "filled_slots: product=iPhone") {
+		t.Errorf("entity prompt does not carry the filled slots:\n%s", prompts[3])
+	}
+	if len(second.Missing) != 0 || !reflect.DeepEqual(second.Update.Filled, []string{"color"}) {
+		t.Errorf("second turn = %+v", second)
+	}
+	if len(second.Update.Anaphora) != 1 || second.Update.Anaphora[0].Value != "iPhone" {
+		t.Errorf("anaphora = %+v, want the iPhone", second.Update.Anaphora)
+	}
+	want := map[string]string{"product": "iPhone", "color": "blue"}
+	if got := state.Slots.Values(); !reflect.DeepEqual(got, want) {
+		t.Errorf("slots = %v, want %v", got, want)
+	}
+	if model.Calls() != 4 {
+		t.Errorf("model calls = %d, want 4", model.Calls())
+	}
+}
+
+func TestUnderstandSkipsExtractionWithoutIntent(t *testing.T) {
+	cfg, err := config.New[Config]("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	model := llm.NewScripted("(intent<||>unknown<||>0.70<||>0.00<||>{})##<|COMPLETE|>")
+	p, err := New(context.Background(), cfg, model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := p.Understand(context.Background(), dialogue.NewDialogueState(), "hmm", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Decision.Intent != "" || model.Calls() != 1 {
+		t.Errorf("decision = %+v after %d calls, want no intent after 1", res.Decision, model.Calls())
+	}
+}
+
+func TestUnderstandRedactsBeforeModelCalls(t *testing.T) {
+	t.Setenv("NLU_REQUIRED_SUPPORT_INTENT", "phone,product")
+	cfg, err := config.New[Config]("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	replies := []string{
+		"(intent<||>support_intent<||>0.90<||>0.60<||>{})##(language<||>eng<||>0.99<||>1<||>{})##<|COMPLETE|>",
+		"(entity<||>phone<||>[PHONE_1]<||>11<||>20<||>0.95)##<|COMPLETE|>",
+	}
+	var sent []string
+	model := llm.NewFake(func(input []*schema.Message) (string, error) {
+		for _, m := range input {
+			sent = append(sent, m.Content)
+		}
+		reply := replies[0]
+		replies = replies[1:]
+		return reply, nil
+	})
+	p, err := New(context.Background(), cfg, model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := dialogue.NewDialogueState()
+	vault := privacy.NewVault()
+
+	res, err := p.Understand(context.Background(), state, "call me at 0812345678 please", vault)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, content := range sent {
+		if strings.Contains(content, "0812345678") {
+			t.Fatalf("a model call saw the raw phone number:\n%s", content)
+		}
+	}
+	if got := state.Slots.Slots["phone"]; got.Value != "0812345678" {
+		t.Errorf("phone slot = %+v, want the restored number", got)
+	}
+	if !reflect.DeepEqual(res.Missing, []string{"product"}) {
+		t.Errorf("missing = %v", res.Missing)
+	}
+	if vault.Restore("[PHONE_1]") != "0812345678" {
+		t.Error("the session vault does not hold the placeholder")
+	}
+}
@@ -0,0 +1,309 @@
+package privacy
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/cloudwego/eino/schema"
+	entity "github.com/pawarison/eino-multi-modal-poc/prompt/entity"
+)
+
+// Kind is the PII category encoded in a placeholder, e.g. [PHONE_1].
+type Kind string
+
+const (
+	KindEmail   Kind = "EMAIL"
+	KindThaiID  Kind = "THAI_ID"
+	KindPhone   Kind = "PHONE"
+	KindAddress Kind = "ADDRESS"
+)
+
+// detector finds candidate PII in text. validate, when set, rejects false positives.
+type detector struct {
+	kind     Kind
+	pattern  *regexp.Regexp
+	validate func(string) bool
+}
+
+// Detectors run in this order; earlier kinds win on overlapping matches.
+var defaultDetectors = []detector{
+	{
+		kind:    KindEmail,
+		pattern: regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),
+	},
+	{
+		kind:     KindThaiID,
+		pattern:  regexp.MustCompile(`\b\d[\s-]?\d{4}[\s-]?\d{5}[\s-]?\d{2}[\s-]?\d\b`),
+		validate: validThaiID,
+	},
+	{
+		kind:    KindPhone,
+		pattern: regexp.MustCompile(`(?:\+66[\s-]?|\b0)\d{1,2}[\s-]?\d{3}[\s-]?\d{3,4}\b|\+\d{1,3}[\s-]?\d{2,4}[\s-]?\d{3,4}[\s-]?\d{3,4}\b`),
+	},
+	{
+		kind: KindAddress,
+		pattern: regexp.MustCompile(`(?:บ้านเลขที่|เลขที่)?\s*\d+(?:/\d+)?\s*(?:หมู่(?:ที่)?\s*\d+\s*)?(?:(?:ซอย|ซ\.|ถนน|ถ\.|แขวง|เขต|ตำบล|ต\.|อำเภอ|อ\.|จังหวัด|จ\.)\s*[^\s,]+(?:\s+\d+)?\s*|กรุงเทพ(?:มหานคร|ฯ)?\s*)+(?:\d{5})?` +
+			`|\b\d{1,5}\s+(?:[A-Z][A-Za-z]*\s+){1,3}(?:Street|St|Road|Rd|Avenue|Ave|Lane|Ln|Soi|Boulevard|Blvd)\b\.?(?:,\s*[A-Z][A-Za-z]*(?:\s+[A-Z][A-Za-z]*)*)*(?:\s+\d{5})?`),
+	},
+}
+
+var placeholderPattern = regexp.MustCompile(`\[(EMAIL|THAI_ID|PHONE|ADDRESS)_(\d+)\]`)
+
+// Redactor swaps PII in text for typed placeholders recorded in a Vault.
+type Redactor struct {
+	detectors []detector
+}
+
+// NewRedactor returns a redactor for the given kinds, or for every kind when none are given.
+func NewRedactor(kinds ...Kind) *Redactor {
+	if len(kinds) == 0 {
+		return &Redactor{detectors: defaultDetectors}
+	}
+	enabled := map[Kind]bool{}
+	for _, k := range kinds {
+		enabled[k] = true
+	}
+	r := &Redactor{}
+	for _, d := range defaultDetectors {
+		if enabled[d.kind] {
+			r.detectors = append(r.detectors, d)
+		}
+	}
+	return r
+}
+
+// Vault maps placeholders back to their original values. Keep one vault per
+// session so the same value always gets the same placeholder.
+type Vault struct {
+	mu       sync.Mutex
+	Entries  map[string]Entry `json:"entries"`
+	Counters map[Kind]int     `json:"counters"`
+}
+
+// Entry is a single redacted value.
+type Entry struct {
+	Kind  Kind   `json:"kind"`
+	Value string `json:"value"`
+}
+
+// NewVault creates an empty vault.
+func NewVault() *Vault {
+	return &Vault{Entries: map[string]Entry{}, Counters: map[Kind]int{}}
+}
+
+type match struct {
+	start, end int
+	kind       Kind
+}
+
+// Redact replaces PII in text with placeholders and records them in v.
+func (r *Redactor) Redact(text string, v *Vault) string {
+	var matches []match
+	for _, d := range r.detectors {
+		for _, loc := range d.pattern.FindAllStringIndex(text, -1) {
+			start, end := trimSpaceBounds(text, loc[0], loc[1])
+			if start >= end {
+				continue
+			}
+			if d.validate != nil && !d.validate(text[start:end]) {
+				continue
+			}
+			if overlaps(matches, start, end) {
+				continue
+			}
+			matches = append(matches, match{start: start, end: end, kind: d.kind})
+		}
+	}
+	if len(matches) == 0 {
+		return text
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].start < matches[j].start })
+
+	var b strings.Builder
+	prev := 0
+	for _, m := range matches {
+		b.WriteString(text[prev:m.start])
+		b.WriteString(v.placeholder(m.kind, text[m.start:m.end]))
+		prev = m.end
+	}
+	b.WriteString(text[prev:])
+	return b.String()
+}
+
+// RedactMessages returns copies of msgs with PII redacted from every non-system message.
+func (r *Redactor) RedactMessages(msgs []*schema.Message, v *Vault) []*schema.Message {
+	out := make([]*schema.Message, len(msgs))
+	for i, msg := range msgs {
+		if msg == nil || msg.Role == schema.System {
+			out[i] = msg
+			continue
+		}
+		cp := *msg
+		cp.Content = r.Redact(msg.Content, v)
+		out[i] = &cp
+	}
+	return out
+}
+
+// Restore replaces known placeholders in text with their original values.
+func (v *Vault) Restore(text string) string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return placeholderPattern.ReplaceAllStringFunc(text, func(ph string) string {
+		if e, ok := v.Entries[ph]; ok {
+			return e.Value
+		}
+		return ph
+	})
+}
+
+// Reserve advances the counters past the placeholders in text, so a vault that
+// replaces a lost one never gives an old placeholder a different value.
+func (v *Vault) Reserve(text string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.Counters == nil {
+		v.Counters = map[Kind]int{}
+	}
+	for _, m := range placeholderPattern.FindAllStringSubmatch(text, -1) {
+		n, err := strconv.Atoi(m[2])
+		if err == nil && n > v.Counters[Kind(m[1])] {
+			v.Counters[Kind(m[1])] = n
+		}
+	}
+}
+
+// RestoreMessage returns a copy of msg with placeholders restored.
+func (v *Vault) RestoreMessage(msg *schema.Message) *schema.Message {
+	if msg == nil {
+		return nil
+	}
+	cp := *msg
+	cp.Content = v.Restore(msg.Content)
+	return &cp
+}
+
+// RestoreEntities restores placeholders in entity spans extracted from redacted
+// and remaps their rune offsets onto the original, unredacted message.
+// A span that ends inside a placeholder is widened to cover the whole value.
+func (v *Vault) RestoreEntities(redacted string, out *entity.EntityOutput) {
+	if out == nil {
+		return
+	}
+	segs := v.segments(redacted)
+	for i := range out.Entities {
+		e := &out.Entities[i]
+		e.Raw = v.Restore(e.Raw)
+		if e.Start >= 0 {
+			e.Start = mapOffset(segs, e.Start, false)
+		}
+		if e.End >= 0 {
+			e.End = mapOffset(segs, e.End, true)
+		}
+	}
+}
+
+// segment is one placeholder occurrence in rune offsets of the redacted (r*)
+// and original (o*) text.
+type segment struct {
+	rs, re, os, oe int
+}
+
+func (v *Vault) segments(redacted string) []segment {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	var segs []segment
+	delta := 0
+	for _, loc := range placeholderPattern.FindAllStringIndex(redacted, -1) {
+		e, ok := v.Entries[redacted[loc[0]:loc[1]]]
+		if !ok {
+			continue
+		}
+		rs := utf8.RuneCountInString(redacted[:loc[0]])
+		re := rs + utf8.RuneCountInString(redacted[loc[0]:loc[1]])
+		origLen := utf8.RuneCountInString(e.Value)
+		segs = append(segs, segment{rs: rs, re: re, os: rs + delta, oe: rs + delta + origLen})
+		delta += origLen - (re - rs)
+	}
+	return segs
+}
+
+func mapOffset(segs []segment, pos int, isEnd bool) int {
+	delta := 0
+	for _, s := range segs {
+		if pos <= s.rs {
+			break
+		}
+		if pos >= s.re {
+			delta = s.oe - s.re
+			continue
+		}
+		if isEnd {
+			return s.oe
+		}
+		return s.os
+	}
+	return pos + delta
+}
+
+func (v *Vault) placeholder(kind Kind, value string) string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.Entries == nil {
+		v.Entries = map[string]Entry{}
+	}
+	if v.Counters == nil {
+		v.Counters = map[Kind]int{}
+	}
+	for ph, e := range v.Entries {
+		if e.Kind == kind && e.Value == value {
+			return ph
+		}
+	}
+	v.Counters[kind]++
+	ph := fmt.Sprintf("[%s_%d]", kind, v.Counters[kind])
+	v.Entries[ph] = Entry{Kind: kind, Value: value}
+	return ph
+}
+
+func overlaps(matches []match, start, end int) bool {
+	for _, m := range matches {
+		if start < m.end && m.start < end {
+			return true
+		}
+	}
+	return false
+}
+
+func trimSpaceBounds(text string, start, end int) (int, int) {
+	for start < end && (text[start] == ' ' || text[start] == '\t' || text[start] == '\n') {
+		start++
+	}
+	for end > start && (text[end-1] == ' ' || text[end-1] == '\t' || text[end-1] == '\n') {
+		end--
+	}
+	return start, end
+}
+
+// validThaiID checks the mod-11 check digit of a 13-digit Thai national ID.
+func validThaiID(s string) bool {
+	digits := make([]int, 0, 13)
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			digits = append(digits, int(r-'0'))
+		}
+	}
+	if len(digits) != 13 {
+		return false
+	}
+	sum := 0
+	for i := 0; i < 12; i++ {
+		sum += digits[i] * (13 - i)
+	}
+	return (11-sum%11)%10 == digits[12]
+}
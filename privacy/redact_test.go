@@ -0,0 +1,81 @@
+package privacy
+
+import (
+	"testing"
+
+	entity "github.com/pawarison/eino-multi-modal-poc/prompt/entity"
+)
+
+func TestRedactAndRestore(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"phone and email", "call 081-234-5678 or mail a.b@example.com", "call [PHONE_1] or mail [EMAIL_1]"},
+		{"same value same placeholder", "0812345678, again 0812345678", "[PHONE_1], again [PHONE_1]"},
+		{"valid thai id", "บัตร 1101700230708", "บัตร [THAI_ID_1]"},
+		{"thai id with a bad check digit", "บัตร 1101700230709", "บัตร 1101700230709"},
+		{"nothing to redact", "the blue one please", "the blue one please"},
+	}
+	r := NewRedactor()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewVault()
+			got := r.Redact(tt.text, v)
+			if got != tt.want {
+				t.Fatalf("Redact(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+			if restored := v.Restore(got); restored != tt.text {
+				t.Errorf("Restore = %q, want %q", restored, tt.text)
+			}
+		})
+	}
+}
+
+func TestRedactKinds(t *testing.T) {
+	v := NewVault()
+	got := NewRedactor(KindEmail).Redact("0812345678 a@b.co", v)
+	if want := "0812345678 [EMAIL_1]"; got != want {
+		t.Errorf("Redact = %q, want %q", got, want)
+	}
+}
+
+func TestRestoreEntitiesRemapsOffsets(t *testing.T) {
+	original := "เบอร์ 0812345678 สีดำ"
+	v := NewVault()
+	redacted := NewRedactor().Redact(original, v)
+	if redacted != "เบอร์ [PHONE_1] สีดำ" {
+		t.Fatalf("redacted = %q", redacted)
+	}
+
+	out := &entity.EntityOutput{Entities: []entity.EntitySpan{
+		{Type: "phone", Raw: "[PHONE_1]", Start: 6, End: 15},
+		{Type: "color", Raw: "สีดำ", Start: 16, End: 20},
+		// ends inside the placeholder, so it is widened to the whole value
+		{Type: "phone", Raw: "[PHONE", Start: 6, End: 10},
+		{Type: "product", Raw: "", Start: -1, End: -1},
+		{Type: "prefix", Raw: "เบอร์", Start: 0, End: 5},
+	}}
+	v.RestoreEntities(redacted, out)
+
+	want := []entity.EntitySpan{
+		{Type: "phone", Raw: "0812345678", Start: 6, End: 16},
+		{Type: "color", Raw: "สีดำ", Start: 17, End: 21},
+		{Type: "phone", Raw: "[PHONE", Start: 6, End: 16},
+		{Type: "product", Raw: "", Start: -1, End: -1},
+		{Type: "prefix", Raw: "เบอร์", Start: 0, End: 5},
+	}
+	for i, e := range out.Entities {
+		if e != want[i] {
+			t.Errorf("entity %d = %+v, want %+v", i, e, want[i])
+		}
+	}
+	runes := []rune(original)
+	for _, i := range []int{0, 1, 4} {
+		e := out.Entities[i]
+		if got := string(runes[e.Start:e.End]); got != e.Raw {
+			t.Errorf("entity %d covers %q in the original, want %q", i, got, e.Raw)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package ask
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cloudwego/eino/components/prompt"
+	"github.com/cloudwego/eino/schema"
+)
+
+// AskModelInput carries the values rendered into the follow-up question prompt.
+type AskModelInput struct {
+	IntentName   string
+	MissingSlots []string
+	FilledSlots  map[string]string
+	Language     string
+}
+
+// LanguageTemplates holds the follow-up question templates of one language.
+// Slots is keyed by "<slot>" or "<intent>.<slot>" for per-intent wording.
+type LanguageTemplates struct {
+	Slots      map[string]string `json:"slots"`
+	Labels     map[string]string `json:"labels"`
+	Combined   string            `json:"combined"`
+	Generic    string            `json:"generic"`
+	Joiner     string            `json:"joiner"`
+	LastJoiner string            `json:"last_joiner"`
+	// Choices wraps a slot question with the options offered after repeated attempts.
+	Choices          string `json:"choices"`
+	ChoiceJoiner     string `json:"choice_joiner"`
+	ChoiceLastJoiner string `json:"choice_last_joiner"`
+	// Handoff is sent when the conversation is escalated to a human agent.
+	Handoff string `json:"handoff"`
+	// Confirm summarizes slots before an irreversible intent; ConfirmPair formats
+	// one slot with {{label}}, {{key}} and {{value}}.
+	Confirm       string `json:"confirm"`
+	ConfirmPair   string `json:"confirm_pair"`
+	ConfirmJoiner string `json:"confirm_joiner"`
+	AskChange     string `json:"ask_change"`
+	// Resume reintroduces an interrupted task with {{task}}, {{subject}} and {{question}}.
+	Resume      string            `json:"resume"`
+	Tasks       map[string]string `json:"tasks"`
+	TaskDefault string            `json:"task_default"`
+}
+
+//go:embed ask_template.txt
+var askSystemTemplate string
+
+// AskTemplatesJSON contains the per-language, per-slot question templates.
+//
+//go:embed ask_templates.json
+var AskTemplatesJSON string
+
+// LoadTemplates parses AskTemplatesJSON keyed by ISO 639-3 language code.
+func LoadTemplates() (map[string]LanguageTemplates, error) {
+	out := map[string]LanguageTemplates{}
+	if err := json.Unmarshal([]byte(AskTemplatesJSON), &out); err != nil {
+		return nil, fmt.Errorf("parse ask templates: %w", err)
+	}
+	return out, nil
+}
+
+// RenderAskSystem renders the follow-up question prompt via Eino prompt component.
+func RenderAskSystem(ctx context.Context, in *AskModelInput) (string, error) {
+	if in == nil {
+		return "", fmt.Errorf("ask input is nil")
+	}
+
+	filledKeys := make([]string, 0, len(in.FilledSlots))
+	for k := range in.FilledSlots {
+		filledKeys = append(filledKeys, k)
+	}
+	sort.Strings(filledKeys)
+	filled := make([]string, 0, len(filledKeys))
+	for _, k := range filledKeys {
+		filled = append(filled, k+"="+in.FilledSlots[k])
+	}
+
+	content := strings.NewReplacer(
+		"{{intent_name}}", in.IntentName,
+		"{{missing_slots_csv}}", strings.Join(in.MissingSlots, ","),
+		"{{filled_slots_csv}}", strings.Join(filled, ","),
+		"{{language}}", in.Language,
+	).Replace(askSystemTemplate)
+
+	tpl := prompt.FromMessages(
+		schema.FString,
+		schema.MessagesPlaceholder("system_messages", false),
+	)
+	msgs, err := tpl.Format(ctx, map[string]any{
+		"system_messages": []*schema.Message{schema.SystemMessage(content)},
+	})
+	if err != nil {
+		return "", fmt.Errorf("ask prompt callbacks: %w", err)
+	}
+	if len(msgs) == 0 || msgs[0] == nil {
+		return "", fmt.Errorf("ask prompt callbacks: empty result")
+	}
+	return msgs[0].Content, nil
+}
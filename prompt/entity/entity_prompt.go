@@ -5,6 +5,7 @@ import (
 	_ "embed"
 	"fmt"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -12,14 +13,19 @@ import (
 	"github.com/cloudwego/eino/schema"
 )
 
-type entityModelConfig struct {
+// EntityModelConfig lists the entity types the model may extract.
+type EntityModelConfig struct {
 	Entities string `envconfig:"NLU_ENTITY" default:"product,quantity,brand,price,color,model,spec,budget,warranty,delivery"`
 }
 
-type entityModelInput struct {
+// EntityModelInput carries the per-turn values rendered into the entity prompt.
+// FilledSlots holds values already collected in earlier turns of the session
+// so the model does not report them as missing again.
+type EntityModelInput struct {
 	IntentName      string
 	RequiredKeys    []string
 	AllowedEntities []string
+	FilledSlots     map[string]string
 	UserMessage     string
 	Language        string
 }
@@ -28,7 +34,7 @@ type entityModelInput struct {
 var entitySystemTemplate string
 
 // RenderEntitySystem renders the entity system prompt via Eino prompt component.
-func RenderEntitySystem(ctx context.Context, in *entityModelInput) (string, error) {
+func RenderEntitySystem(ctx context.Context, in *EntityModelInput) (string, error) {
 	if in == nil {
 		return "", fmt.Errorf("entity input is nil")
 	}
@@ -49,10 +55,26 @@ func RenderEntitySystem(ctx context.Context, in *entityModelInput) (string, erro
 	// Required เป็น CSV
 	reqCSV := strings.Join(in.RequiredKeys, ",")
 
+	// filled_slots_csv as key=value pairs in a stable order
+	filledKeys := make([]string, 0, len(in.FilledSlots))
+	for k := range in.FilledSlots {
+		filledKeys = append(filledKeys, k)
+	}
+	sort.Strings(filledKeys)
+	filled := make([]string, 0, len(filledKeys))
+	for _, k := range filledKeys {
+		filled = append(filled, k+"="+in.FilledSlots[k])
+	}
+	filledCSV := strings.Join(filled, ",")
+
 	content := strings.NewReplacer(
+		"{TD}", "<||>",
+		"{RD}", "##",
+		"{CD}", "<|COMPLETE|>",
 		"{{intent_name}}", in.IntentName,
 		"{{required_keys_csv}}", reqCSV,
 		"{{allowed_entities_csv}}", allowedCSV,
+		"{{filled_slots_csv}}", filledCSV,
 		"{{user_message}}", in.UserMessage,
 		"{{language}}", in.Language,
 	).Replace(entitySystemTemplate)
@@ -126,7 +148,8 @@ func ParseEntityOutput(raw string) (*EntityOutput, error) {
 			continue
 		}
 
-		fields := strings.Split(line, "<||>")
+		// tuples close with ")" after the last value, e.g. the confidence
+		fields := strings.Split(strings.TrimSuffix(line, ")"), "<||>")
 		if len(fields) == 0 {
 			continue
 		}
@@ -0,0 +1,54 @@
+package intent
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRenderEntitySystemDelimiters(t *testing.T) {
+	out, err := RenderEntitySystem(context.Background(), &EntityModelInput{
+		IntentName:      "purchase_intent",
+		RequiredKeys:    []string{"product", "color"},
+		AllowedEntities: []string{"product"},
+		FilledSlots:     map[string]string{"product": "iPhone"},
+		UserMessage:     "the blue one",
+		Language:        "en",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range []string{"{TD}", "{RD}", "{CD}", "{{intent_name}}", "{{filled_slots_csv}}", "{{user_message}}"} {
+		if strings.Contains(out, token) {
+			t.Errorf("rendered prompt still contains %s", token)
+		}
+	}
+	// the examples must use the delimiters ParseEntityOutput reads
+	if !strings.Contains(out, "(entity<||>color<||>blue<||>4<||>8<||>0.93)##") {
+		t.Errorf("examples are not in the parsed tuple format:\n%s", out)
+	}
+}
+
+func TestParseEntityOutput(t *testing.T) {
+	raw := "(entity<||>product<||>iPhone 15<||>12<||>21<||>0.95)##" +
+		"(missing<||>price)##" +
+		"(language<||>eng<||>0.99<||>{\"hint\":\"en\"})##" +
+		"(entity<||>short)##" +
+		"<|COMPLETE|>"
+	out, err := ParseEntityOutput(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &EntityOutput{
+		Entities: []EntitySpan{{Type: "product", Raw: "iPhone 15", Start: 12, End: 21, Confidence: 0.95}},
+		Missing:  []string{"price"},
+		Language: "eng",
+	}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("ParseEntityOutput = %+v, want %+v", out, want)
+	}
+	if got := out.MissingKeys([]string{"product", "color"}); !reflect.DeepEqual(got, []string{"color"}) {
+		t.Errorf("MissingKeys = %v", got)
+	}
+}
@@ -10,7 +10,8 @@ import (
 	"github.com/cloudwego/eino/schema"
 )
 
-type intentModelConfig struct {
+// IntentModelConfig lists the intents and their priority scores offered to the model.
+type IntentModelConfig struct {
 	IntentList string `envconfig:"NLU_INTENT" default:"greet:0.1, purchase_intent:0.8, inquiry_intent:0.7, support_intent:0.6, complain_intent:0.6, complaint:0.5, cancel_order:0.4, ask_price:0.6, compare_product:0.5, delivery_issue:0.7"`
 }
 
@@ -19,7 +20,7 @@ var intentSystemTemplate string
 
 // RenderintentSystem renders the intent system prompt via Eino prompt component.
 // This triggers Prompt callbacks and returns the final system prompt string.
-func RenderintentSystem(ctx context.Context, intentConfig *intentModelConfig) (string, error) {
+func RenderintentSystem(ctx context.Context, intentConfig *IntentModelConfig) (string, error) {
 	if intentConfig == nil {
 		return "", fmt.Errorf("intent config is nil")
 	}
@@ -0,0 +1,64 @@
+package mbti
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Config fills the placeholders of SystemPromptTemplate.
+type Config struct {
+	BrandName      string `envconfig:"PROMPT_BRAND_NAME" default:"Chative Brand"`
+	Channel        string `envconfig:"PROMPT_CHANNEL" default:"Online Storefront"`
+	TargetSegments string `envconfig:"PROMPT_TARGET_SEGMENTS" default:"Young Professionals seeking lifestyle upgrades"`
+	// MBTIType selects the personality in MBTIProfilesJSON.
+	MBTIType string `envconfig:"PROMPT_MBTI_TYPE" default:"EXPERT"`
+}
+
+// RenderSystemPrompt renders SystemPromptTemplate with cfg and the profile of
+// cfg.MBTIType.
+func RenderSystemPrompt(cfg *Config) (string, error) {
+	if cfg == nil {
+		return "", fmt.Errorf("system prompt config is nil")
+	}
+	brandName := strings.TrimSpace(cfg.BrandName)
+	channel := strings.TrimSpace(cfg.Channel)
+	targetSegments := strings.TrimSpace(cfg.TargetSegments)
+	mbtiType := strings.ToUpper(strings.TrimSpace(cfg.MBTIType))
+
+	if brandName == "" || channel == "" || targetSegments == "" || mbtiType == "" {
+		return "", fmt.Errorf("system prompt configuration is incomplete")
+	}
+
+	profiles, err := LoadProfiles()
+	if err != nil {
+		return "", err
+	}
+
+	mbtiDescription, ok := profiles[mbtiType]
+	if !ok {
+		return "", fmt.Errorf("mbti type %q not found in profiles", mbtiType)
+	}
+
+	result := strings.NewReplacer(
+		"{{BRAND_NAME}}", brandName,
+		"{{CHANNEL}}", channel,
+		"{{TARGET_SEGMENTS}}", targetSegments,
+		"{{MBTI_TYPE}}", mbtiType,
+		"{{MBTI}}", strings.TrimSpace(mbtiDescription),
+	).Replace(strings.TrimSpace(SystemPromptTemplate))
+
+	if strings.Contains(result, "{{") {
+		return "", fmt.Errorf("system prompt still contains unresolved placeholders")
+	}
+	return result, nil
+}
+
+// LoadProfiles parses MBTIProfilesJSON keyed by type.
+func LoadProfiles() (map[string]string, error) {
+	profiles := make(map[string]string)
+	if err := json.Unmarshal([]byte(MBTIProfilesJSON), &profiles); err != nil {
+		return nil, fmt.Errorf("parse mbti profiles: %w", err)
+	}
+	return profiles, nil
+}
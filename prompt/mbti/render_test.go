@@ -0,0 +1,28 @@
+package mbti
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pawarison/eino-multi-modal-poc/config"
+)
+
+func TestRenderSystemPrompt(t *testing.T) {
+	cfg, err := config.New[Config]("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.MBTIType = "intj"
+	got, err := RenderSystemPrompt(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(got, "{{") || !strings.Contains(got, "Chative Brand") || !strings.Contains(got, `type="INTJ"`) {
+		t.Errorf("rendered prompt:\n%s", got)
+	}
+
+	cfg.MBTIType = "XXXX"
+	if _, err := RenderSystemPrompt(cfg); err == nil {
+		t.Error("unknown mbti type rendered")
+	}
+}
@@ -0,0 +1,93 @@
+package rerank
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cloudwego/eino/components/prompt"
+	"github.com/cloudwego/eino/schema"
+)
+
+// Candidate is one article shown to the reranking model.
+type Candidate struct {
+	ID          int64
+	Title       string
+	Publication string
+}
+
+// RerankModelInput carries the values rendered into the reranking prompt.
+type RerankModelInput struct {
+	Query      string
+	Candidates []Candidate
+}
+
+//go:embed rerank_template.txt
+var rerankSystemTemplate string
+
+// MaxScore is the top of the model's relevance scale.
+const MaxScore = 10
+
+// RenderRerankSystem renders the reranking prompt via Eino prompt component.
+func RenderRerankSystem(ctx context.Context, in *RerankModelInput) (string, error) {
+	if in == nil {
+		return "", fmt.Errorf("rerank input is nil")
+	}
+
+	lines := make([]string, len(in.Candidates))
+	for i, c := range in.Candidates {
+		lines[i] = fmt.Sprintf("%d | %s | %s", c.ID, oneLine(c.Title), oneLine(c.Publication))
+	}
+	content := strings.NewReplacer(
+		"{{query}}", oneLine(in.Query),
+		"{{candidates}}", strings.Join(lines, "\n"),
+	).Replace(rerankSystemTemplate)
+
+	tpl := prompt.FromMessages(
+		schema.FString,
+		schema.MessagesPlaceholder("system_messages", false),
+	)
+	msgs, err := tpl.Format(ctx, map[string]any{
+		"system_messages": []*schema.Message{schema.SystemMessage(content)},
+	})
+	if err != nil {
+		return "", fmt.Errorf("rerank prompt callbacks: %w", err)
+	}
+	if len(msgs) == 0 || msgs[0] == nil {
+		return "", fmt.Errorf("rerank prompt callbacks: empty result")
+	}
+	return msgs[0].Content, nil
+}
+
+// ParseRerankOutput reads (score<||>id<||>score) records. Scores are clamped
+// to 0..MaxScore; malformed records are skipped.
+func ParseRerankOutput(raw string) map[int64]float64 {
+	out := map[int64]float64{}
+	for _, rec := range strings.Split(raw, "##") {
+		rec = strings.TrimSpace(rec)
+		if rec == "" || rec == "<|COMPLETE|>" {
+			continue
+		}
+		fields := strings.Split(strings.TrimSuffix(rec, ")"), "<||>")
+		if len(fields) < 3 || fields[0] != "(score" {
+			continue
+		}
+		id, err := strconv.ParseInt(strings.TrimSpace(fields[1]), 10, 64)
+		if err != nil {
+			continue
+		}
+		score, err := strconv.ParseFloat(strings.TrimSpace(fields[2]), 64)
+		if err != nil {
+			continue
+		}
+		out[id] = min(max(score, 0), MaxScore)
+	}
+	return out
+}
+
+// oneLine keeps user text from breaking the candidate list layout.
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,416 @@
+// Package reindex rebuilds a collection without taking search down.
+// Rows are ingested into a new versioned collection, the version is checked,
+// and only then is the alias that searches go through switched to it.
+// Previous versions are kept so the alias can be rolled back. A collection
+// created before aliases were used is moved behind one with Adopt.
+package reindex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cloudwego/eino/components/embedding"
+	"github.com/pawarison/eino-multi-modal-poc/dataset"
+	"github.com/pawarison/eino-multi-modal-poc/ingest"
+	"github.com/pawarison/eino-multi-modal-poc/retrieval"
+	"github.com/pawarison/eino-multi-modal-poc/vectorstore"
+)
+
+// ErrValidation is returned when a new version fails the checks before the switch.
+var ErrValidation = errors.New("validation failed")
+
+// versionLayout is the timestamp suffix of a version, which sorts in time order.
+const versionLayout = "20060102150405"
+
+// Config controls the validation gate.
+type Config struct {
+	// SampleQueries is the number of embedded texts of the dataset searched in a new version.
+	SampleQueries int `envconfig:"REINDEX_SAMPLE_QUERIES" default:"10"`
+	// SampleTopK is how deep a sample text must find its own record.
+	SampleTopK int `envconfig:"REINDEX_SAMPLE_TOP_K" default:"5"`
+	// MinSampleRecall is the share of sample texts that must find their own record.
+	MinSampleRecall float64 `envconfig:"REINDEX_MIN_SAMPLE_RECALL" default:"0.8"`
+}
+
+// Report describes a reindex run.
+type Report struct {
+	Alias   string
+	Version string
+	// Previous is the collection the alias pointed at before, or empty.
+	Previous string
+	// Validation lists the dataset violations and how they were fixed.
+	Validation *dataset.ValidationReport
+	Ingest     *ingest.Report
+	// Rows is the number of distinct ids in the dataset, or of its chunks
+	// when the mapping chunks; Count is the number of documents found in the
+	// version.
+	Rows  int
+	Count int
+	// SampleQueries texts were searched and SampleHits found their own record.
+	SampleQueries int
+	SampleHits    int
+	Switched      bool
+}
+
+// String renders the report for the command line.
+func (r *Report) String() string {
+	var b strings.Builder
+	if r.Validation != nil && len(r.Validation.Violations) > 0 {
+		fmt.Fprintf(&b, "%s\n", r.Validation)
+	}
+	if r.Ingest != nil {
+		fmt.Fprintf(&b, "%s\n", r.Ingest)
+	}
+	if r.Version != "" {
+		fmt.Fprintf(&b, "version %s: %d of %d rows, %d of %d sample texts found\n",
+			r.Version, r.Count, r.Rows, r.SampleHits, r.SampleQueries)
+	}
+	switch {
+	case r.Switched && r.Previous != "":
+		fmt.Fprintf(&b, "alias %s: switched from %s to %s", r.Alias, r.Previous, r.Version)
+	case r.Switched:
+		fmt.Fprintf(&b, "alias %s: created for %s", r.Alias, r.Version)
+	case r.Previous != "":
+		fmt.Fprintf(&b, "alias %s: unchanged, still %s", r.Alias, r.Previous)
+	default:
+		fmt.Fprintf(&b, "alias %s: not created", r.Alias)
+	}
+	return b.String()
+}
+
+// Reindexer rebuilds the collection behind the alias ingestCfg.Collection.
+type Reindexer struct {
+	cfg       Config
+	ingestCfg ingest.Config
+	mapping   dataset.Mapping
+	documents embedding.Embedder
+	queries   embedding.Embedder
+	store     vectorstore.Store
+	now       func() time.Time
+}
+
+// New creates a reindexer for records loaded with mapping. documents and
+// queries embed with the document and query task types of ingestCfg.Embedding.
+func New(cfg *Config, ingestCfg *ingest.Config, mapping dataset.Mapping, documents, queries embedding.Embedder, store vectorstore.Store) (*Reindexer, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("reindex config is nil")
+	}
+	if ingestCfg == nil {
+		return nil, fmt.Errorf("ingest config is nil")
+	}
+	if documents == nil || queries == nil {
+		return nil, fmt.Errorf("embedder is nil")
+	}
+	if store == nil {
+		return nil, fmt.Errorf("vector store is nil")
+	}
+	if cfg.SampleQueries < 0 || cfg.SampleTopK <= 0 {
+		return nil, fmt.Errorf("invalid sample queries %d or top k %d", cfg.SampleQueries, cfg.SampleTopK)
+	}
+	if cfg.MinSampleRecall < 0 || cfg.MinSampleRecall > 1 {
+		return nil, fmt.Errorf("invalid min sample recall %g: must be 0-1", cfg.MinSampleRecall)
+	}
+	return &Reindexer{
+		cfg:       *cfg,
+		ingestCfg: *ingestCfg,
+		mapping:   mapping,
+		documents: documents,
+		queries:   queries,
+		store:     store,
+		now:       time.Now,
+	}, nil
+}
+
+// Alias is the name searches go through.
+func (r *Reindexer) Alias() string {
+	return r.ingestCfg.Collection
+}
+
+// Versions returns the versions of the alias, oldest first, and the one it
+// points at, which is empty before the first switch.
+func (r *Reindexer) Versions(ctx context.Context) ([]string, string, error) {
+	names, err := r.store.ListCollections(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	var versions []string
+	for _, name := range names {
+		if r.isVersion(name) {
+			versions = append(versions, name)
+		}
+	}
+	slices.Sort(versions)
+	current, err := r.store.ResolveAlias(ctx, r.Alias())
+	if err != nil && !errors.Is(err, vectorstore.ErrAliasNotFound) {
+		return nil, "", err
+	}
+	return versions, current, nil
+}
+
+func (r *Reindexer) isVersion(name string) bool {
+	suffix, ok := strings.CutPrefix(name, r.Alias()+"_v")
+	if !ok || len(suffix) != len(versionLayout) {
+		return false
+	}
+	_, err := time.Parse(versionLayout, suffix)
+	return err == nil
+}
+
+// Run ingests rows into a new version, or resumes the interrupted version
+// when one is given, validates it and switches the alias to it. A version
+// that fails validation is left in place for inspection and the alias is
+// not touched; the error wraps ErrValidation.
+func (r *Reindexer) Run(ctx context.Context, rows []dataset.Record, version string) (*Report, error) {
+	report := &Report{Alias: r.Alias(), Version: version}
+	names, err := r.store.ListCollections(ctx)
+	if err != nil {
+		return report, err
+	}
+	if slices.Contains(names, r.Alias()) {
+		return report, fmt.Errorf("%s is a collection, not an alias; adopt it first to move it behind an alias", r.Alias())
+	}
+	if version == "" {
+		version = r.Alias() + "_v" + r.now().UTC().Format(versionLayout)
+		if slices.Contains(names, version) {
+			return report, fmt.Errorf("version %s already exists", version)
+		}
+		report.Version = version
+	} else if !r.isVersion(version) {
+		return report, fmt.Errorf("%s is not a version of %s", version, r.Alias())
+	}
+	previous, err := r.store.ResolveAlias(ctx, r.Alias())
+	if err != nil && !errors.Is(err, vectorstore.ErrAliasNotFound) {
+		return report, err
+	}
+	report.Previous = previous
+	if version == previous {
+		return report, fmt.Errorf("version %s is live; reindex into a new version", version)
+	}
+
+	ingestCfg := r.ingestCfg
+	ingestCfg.Collection = version
+	if ingestCfg.LexicalIndexPath != "" {
+		ingestCfg.LexicalIndexPath = retrieval.VersionIndexPath(ingestCfg.LexicalIndexPath, version)
+	}
+	ingester, err := ingest.New(&ingestCfg, r.mapping, r.documents, r.store)
+	if err != nil {
+		return report, err
+	}
+	// check first so validation below sees the rows as ingested
+	rows, report.Validation, err = ingester.Check(rows)
+	if err != nil {
+		return report, err
+	}
+	report.Ingest, err = ingester.Run(ctx, rows, false)
+	if report.Ingest != nil {
+		// the rows are already fixed; the violations are reported once, above
+		report.Ingest.Validation = nil
+	}
+	if err != nil {
+		return report, err
+	}
+
+	if err := r.validate(ctx, rows, report); err != nil {
+		return report, err
+	}
+	if err := r.store.SetAlias(ctx, r.Alias(), version); err != nil {
+		return report, err
+	}
+	report.Switched = true
+	return report, nil
+}
+
+// validate checks that the version holds one document per distinct id and
+// that enough sample texts find their own record, or a chunk of it, by vector
+// search.
+func (r *Reindexer) validate(ctx context.Context, rows []dataset.Record, report *Report) error {
+	chunks, err := r.mapping.Chunk(rows)
+	if err != nil {
+		return err
+	}
+	ids := make(map[int64]bool, len(chunks))
+	for _, row := range chunks {
+		ids[row.ID] = true
+	}
+	report.Rows = len(ids)
+	count, err := r.store.Count(ctx, report.Version)
+	if err != nil {
+		return err
+	}
+	report.Count = count
+	if count != report.Rows {
+		return fmt.Errorf("version %s: %w: %d documents, want %d", report.Version, ErrValidation, count, report.Rows)
+	}
+
+	samples := sample(rows, r.cfg.SampleQueries)
+	if len(samples) == 0 {
+		return nil
+	}
+	texts := make([]string, len(samples))
+	for i, row := range samples {
+		texts[i] = row.Text
+	}
+	embeddings, err := r.queries.EmbedStrings(ctx, texts)
+	if err != nil {
+		return fmt.Errorf("embed sample queries: %w", err)
+	}
+	if len(embeddings) != len(samples) {
+		return fmt.Errorf("embed sample queries: got %d embeddings for %d texts", len(embeddings), len(samples))
+	}
+	outputFields := []string{vectorstore.PrimaryField}
+	if r.mapping.Chunking != nil {
+		outputFields = append(outputFields, dataset.FieldParentID)
+	}
+	found := func(h vectorstore.Hit, id int64) bool {
+		if r.mapping.Chunking != nil {
+			return int64(h.Int(dataset.FieldParentID)) == id
+		}
+		return h.ID == id
+	}
+	var missed []int64
+	for i, row := range samples {
+		vec := make([]float32, len(embeddings[i]))
+		for j, v := range embeddings[i] {
+			vec[j] = float32(v)
+		}
+		hits, err := r.store.Search(ctx, report.Version, vectorstore.SearchRequest{
+			Vector:       vec,
+			TopK:         r.cfg.SampleTopK,
+			OutputFields: outputFields,
+		})
+		if err != nil {
+			return fmt.Errorf("sample query %d: %w", row.ID, err)
+		}
+		if slices.ContainsFunc(hits, func(h vectorstore.Hit) bool { return found(h, row.ID) }) {
+			report.SampleHits++
+		} else {
+			missed = append(missed, row.ID)
+		}
+	}
+	report.SampleQueries = len(samples)
+	if recall := float64(report.SampleHits) / float64(len(samples)); recall < r.cfg.MinSampleRecall {
+		return fmt.Errorf("version %s: %w: sample recall %.2f below %.2f, missed ids %v",
+			report.Version, ErrValidation, recall, r.cfg.MinSampleRecall, missed)
+	}
+	return nil
+}
+
+// sample picks up to n rows with text, spread evenly over the dataset.
+func sample(rows []dataset.Record, n int) []dataset.Record {
+	var texts []dataset.Record
+	for _, row := range rows {
+		if strings.TrimSpace(row.Text) != "" {
+			texts = append(texts, row)
+		}
+	}
+	if n >= len(texts) {
+		return texts
+	}
+	out := make([]dataset.Record, n)
+	for i := range out {
+		out[i] = texts[i*len(texts)/n]
+	}
+	return out
+}
+
+// Rollback points the alias at version, or at the newest version older than
+// the live one when version is empty. It returns the version switched from
+// and to. The target must still match the configured schema and embedding.
+func (r *Reindexer) Rollback(ctx context.Context, version string) (string, string, error) {
+	versions, current, err := r.Versions(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	if version == "" {
+		if current == "" {
+			return "", "", fmt.Errorf("alias %s does not exist", r.Alias())
+		}
+		for _, v := range versions {
+			if v < current {
+				version = v
+			}
+		}
+		if version == "" {
+			return current, "", fmt.Errorf("no version of %s older than %s", r.Alias(), current)
+		}
+	}
+	if !slices.Contains(versions, version) {
+		return current, "", fmt.Errorf("%s is not a version of %s", version, r.Alias())
+	}
+	if version == current {
+		return current, version, nil
+	}
+
+	if err := r.check(ctx, version); err != nil {
+		return current, "", err
+	}
+	if err := r.store.SetAlias(ctx, r.Alias(), version); err != nil {
+		return current, "", err
+	}
+	return current, version, nil
+}
+
+// Adopt moves the collection named like the alias behind it: the collection
+// is renamed to a new version and the alias is created for it, so Run and
+// Rollback work on a deployment that predates aliases. Nothing is
+// re-embedded, but searches by that name fail between the rename and the
+// alias. The lexical index at the configured path is copied to the version's
+// path. It returns the version.
+func (r *Reindexer) Adopt(ctx context.Context) (string, error) {
+	names, err := r.store.ListCollections(ctx)
+	if err != nil {
+		return "", err
+	}
+	if !slices.Contains(names, r.Alias()) {
+		if current, err := r.store.ResolveAlias(ctx, r.Alias()); err == nil {
+			return "", fmt.Errorf("%s is already an alias of %s", r.Alias(), current)
+		}
+		return "", fmt.Errorf("%s: %w", r.Alias(), vectorstore.ErrCollectionNotFound)
+	}
+	if err := r.check(ctx, r.Alias()); err != nil {
+		return "", err
+	}
+	version := r.Alias() + "_v" + r.now().UTC().Format(versionLayout)
+	if slices.Contains(names, version) {
+		return "", fmt.Errorf("version %s already exists", version)
+	}
+	if base := r.ingestCfg.LexicalIndexPath; base != "" {
+		if err := copyFile(base, retrieval.VersionIndexPath(base, version)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return "", fmt.Errorf("copy lexical index: %w", err)
+		}
+	}
+	if err := r.store.RenameCollection(ctx, r.Alias(), version); err != nil {
+		return "", err
+	}
+	if err := r.store.SetAlias(ctx, r.Alias(), version); err != nil {
+		return version, fmt.Errorf("%s was renamed to %s but the alias was not created; roll back to %s to create it: %w", r.Alias(), version, version, err)
+	}
+	return version, nil
+}
+
+// check refuses a collection that does not match the mapping and the
+// configured embedding.
+func (r *Reindexer) check(ctx context.Context, collection string) error {
+	existing, err := r.store.Describe(ctx, collection)
+	if err != nil {
+		return err
+	}
+	if err := r.mapping.CollectionSpec(collection, r.ingestCfg.VectorField, 0).Check(existing); err != nil {
+		return err
+	}
+	return r.ingestCfg.Embedding.Check(existing)
+}
+
+func copyFile(src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, 0o644)
+}
@@ -0,0 +1,347 @@
+package reindex
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/components/embedding"
+	"github.com/pawarison/eino-multi-modal-poc/dataset"
+	"github.com/pawarison/eino-multi-modal-poc/embedder"
+	"github.com/pawarison/eino-multi-modal-poc/ingest"
+	"github.com/pawarison/eino-multi-modal-poc/retrieval"
+	"github.com/pawarison/eino-multi-modal-poc/vectorstore"
+)
+
+const dim = 4
+
+// embedFunc adapts a function to embedding.Embedder.
+type embedFunc func(texts []string) ([][]float64, error)
+
+func (f embedFunc) EmbedStrings(_ context.Context, texts []string, _ ...embedding.Option) ([][]float64, error) {
+	return f(texts)
+}
+
+// oneHot embeds "t<i>" as the i-th unit vector, so each row is nearest to itself.
+var oneHot = embedFunc(func(texts []string) ([][]float64, error) {
+	out := make([][]float64, len(texts))
+	for i, text := range texts {
+		n, err := strconv.Atoi(strings.TrimPrefix(text, "t"))
+		if err != nil {
+			return nil, err
+		}
+		out[i] = make([]float64, dim)
+		out[i][(n-1)%dim] = 1
+	}
+	return out, nil
+})
+
+// aliasStore is a memory store that counts alias switches and can fail them.
+type aliasStore struct {
+	*vectorstore.Memory
+	switches     int
+	failSetAlias bool
+}
+
+func (s *aliasStore) SetAlias(ctx context.Context, alias, collection string) error {
+	if s.failSetAlias {
+		return errors.New("alias service unavailable")
+	}
+	s.switches++
+	return s.Memory.SetAlias(ctx, alias, collection)
+}
+
+func testMapping() dataset.Mapping {
+	return dataset.Mapping{
+		ID:     "id",
+		Embed:  []string{"title"},
+		Fields: []dataset.Field{{Name: "title", Type: vectorstore.FieldVarChar, MaxLength: 64}},
+	}
+}
+
+func testRows() []dataset.Record {
+	rows := make([]dataset.Record, dim)
+	for i := range rows {
+		text := "t" + strconv.Itoa(i+1)
+		rows[i] = dataset.Record{ID: int64(i + 1), Text: text, Fields: map[string]any{"title": text}}
+	}
+	return rows
+}
+
+func testIngestConfig(t *testing.T) *ingest.Config {
+	dir := t.TempDir()
+	return &ingest.Config{
+		Collection:       "docs",
+		VectorField:      "vector",
+		Embedding:        embedder.Config{Model: "fake", Dimension: dim},
+		BatchSize:        10,
+		Concurrency:      1,
+		CheckpointPath:   filepath.Join(dir, "checkpoint.json"),
+		ProgressInterval: time.Hour,
+		LexicalIndexPath: filepath.Join(dir, "bm25.json"),
+	}
+}
+
+// newTestReindexer creates a reindexer whose clock moves a second per version.
+func newTestReindexer(t *testing.T, ingestCfg *ingest.Config, queries embedding.Embedder, store vectorstore.Store) *Reindexer {
+	t.Helper()
+	r, err := New(&Config{SampleQueries: dim, SampleTopK: 1, MinSampleRecall: 1}, ingestCfg, testMapping(), oneHot, queries, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	r.now = func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	}
+	return r
+}
+
+func alias(t *testing.T, store vectorstore.Store) string {
+	t.Helper()
+	target, err := store.ResolveAlias(context.Background(), "docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return target
+}
+
+func TestRunSwitchesAlias(t *testing.T) {
+	ctx := context.Background()
+	store := &aliasStore{Memory: vectorstore.NewMemory()}
+	ingestCfg := testIngestConfig(t)
+	r := newTestReindexer(t, ingestCfg, oneHot, store)
+
+	first, err := r.Run(ctx, testRows(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !first.Switched || first.Previous != "" || first.Count != dim || first.Rows != dim || first.SampleHits != dim {
+		t.Fatalf("first run = %+v", first)
+	}
+	if got := alias(t, store); got != first.Version {
+		t.Errorf("alias = %s, want %s", got, first.Version)
+	}
+	if _, err := os.Stat(retrieval.VersionIndexPath(ingestCfg.LexicalIndexPath, first.Version)); err != nil {
+		t.Errorf("version lexical index: %v", err)
+	}
+
+	second, err := r.Run(ctx, testRows(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !second.Switched || second.Previous != first.Version || second.Version <= first.Version {
+		t.Fatalf("second run = %+v", second)
+	}
+	if got := alias(t, store); got != second.Version {
+		t.Errorf("alias = %s, want %s", got, second.Version)
+	}
+	versions, current, err := r.Versions(ctx)
+	if err != nil || !reflect.DeepEqual(versions, []string{first.Version, second.Version}) || current != second.Version {
+		t.Errorf("Versions = %v, %s, %v", versions, current, err)
+	}
+
+	if _, err := r.Run(ctx, testRows(), second.Version); err == nil {
+		t.Error("reindexed into the live version")
+	}
+	if _, err := r.Run(ctx, testRows(), "other_v20240101000000"); err == nil {
+		t.Error("reindexed into a collection that is not a version")
+	}
+	if store.switches != 2 {
+		t.Errorf("alias switched %d times, want 2", store.switches)
+	}
+}
+
+func TestRunFailedValidationKeepsAlias(t *testing.T) {
+	ctx := context.Background()
+	store := &aliasStore{Memory: vectorstore.NewMemory()}
+	ingestCfg := testIngestConfig(t)
+	live, err := newTestReindexer(t, ingestCfg, oneHot, store).Run(ctx, testRows(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every sample text searches for row 1, so three of four miss
+	misleading := embedFunc(func(texts []string) ([][]float64, error) {
+		return oneHot(slices.Repeat([]string{"t1"}, len(texts)))
+	})
+	r := newTestReindexer(t, ingestCfg, misleading, store)
+	r.now = func() time.Time { return time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC) }
+	report, err := r.Run(ctx, testRows(), "")
+	if !errors.Is(err, ErrValidation) {
+		t.Fatalf("err = %v, want ErrValidation", err)
+	}
+	if report.Switched || report.Previous != live.Version || report.SampleHits != 1 || report.SampleQueries != dim {
+		t.Errorf("report = %+v", report)
+	}
+	if got := alias(t, store); got != live.Version || store.switches != 1 {
+		t.Errorf("alias = %s after %d switches, want it left on %s", got, store.switches, live.Version)
+	}
+	names, err := store.ListCollections(ctx)
+	if err != nil || !reflect.DeepEqual(names, []string{live.Version, report.Version}) {
+		t.Errorf("collections = %v, %v; want the failed version kept", names, err)
+	}
+
+	// resuming the kept version with working queries switches to it
+	resumed, err := newTestReindexer(t, ingestCfg, oneHot, store).Run(ctx, testRows(), report.Version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resumed.Switched || resumed.Previous != live.Version || alias(t, store) != report.Version {
+		t.Errorf("resumed = %+v", resumed)
+	}
+}
+
+func TestRollback(t *testing.T) {
+	ctx := context.Background()
+	store := &aliasStore{Memory: vectorstore.NewMemory()}
+	r := newTestReindexer(t, testIngestConfig(t), oneHot, store)
+	if _, _, err := r.Rollback(ctx, ""); err == nil {
+		t.Error("rolled back an alias that does not exist")
+	}
+	var versions []string
+	for range 2 {
+		report, err := r.Run(ctx, testRows(), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		versions = append(versions, report.Version)
+	}
+	v1, v2 := versions[0], versions[1]
+
+	from, to, err := r.Rollback(ctx, "")
+	if err != nil || from != v2 || to != v1 || alias(t, store) != v1 {
+		t.Fatalf("Rollback = %s -> %s, %v", from, to, err)
+	}
+	if _, _, err := r.Rollback(ctx, ""); err == nil {
+		t.Error("rolled back past the oldest version")
+	}
+	if from, to, err := r.Rollback(ctx, v2); err != nil || from != v1 || to != v2 || alias(t, store) != v2 {
+		t.Errorf("Rollback(%s) = %s -> %s, %v", v2, from, to, err)
+	}
+	switches := store.switches
+	if from, to, err := r.Rollback(ctx, v2); err != nil || from != v2 || to != v2 || store.switches != switches {
+		t.Errorf("Rollback to the live version = %s -> %s, %v after %d switches", from, to, err, store.switches-switches)
+	}
+	if _, _, err := r.Rollback(ctx, "docs"); err == nil {
+		t.Error("rolled back to a collection that is not a version")
+	}
+
+	// a version with another schema is refused and the alias stays
+	stale := "docs_v20200101000000"
+	if err := store.EnsureCollection(ctx, vectorstore.CollectionSpec{
+		Name: stale, VectorField: "vector", Dim: dim,
+		Fields: []vectorstore.Field{{Name: "title", Type: vectorstore.FieldInt64}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := r.Rollback(ctx, stale); !errors.Is(err, vectorstore.ErrSchemaMismatch) || alias(t, store) != v2 {
+		t.Errorf("Rollback to a mismatched version = %v", err)
+	}
+}
+
+func TestAdopt(t *testing.T) {
+	ctx := context.Background()
+	ingestCfg := testIngestConfig(t)
+	physical := func(t *testing.T, spec vectorstore.CollectionSpec) *aliasStore {
+		t.Helper()
+		store := &aliasStore{Memory: vectorstore.NewMemory()}
+		if err := store.EnsureCollection(ctx, spec); err != nil {
+			t.Fatal(err)
+		}
+		return store
+	}
+	spec := testMapping().CollectionSpec("docs", "vector", dim)
+	spec.Properties = ingestCfg.Embedding.Properties()
+
+	store := physical(t, spec)
+	var docs []vectorstore.Document
+	for _, row := range testRows() {
+		docs = append(docs, row.Document([]float32{1, 0, 0, 0}))
+	}
+	if err := store.Upsert(ctx, "docs", docs); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(ingestCfg.LexicalIndexPath, []byte(`{"docs":[]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r := newTestReindexer(t, ingestCfg, oneHot, store)
+
+	if _, err := r.Run(ctx, testRows(), ""); err == nil || !strings.Contains(err.Error(), "adopt") {
+		t.Fatalf("Run over a physical collection = %v", err)
+	}
+
+	version, err := r.Adopt(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.isVersion(version) || alias(t, store) != version {
+		t.Fatalf("adopted %s, alias %s", version, alias(t, store))
+	}
+	if names, _ := store.ListCollections(ctx); !reflect.DeepEqual(names, []string{version}) {
+		t.Errorf("collections = %v", names)
+	}
+	if n, err := store.Count(ctx, "docs"); err != nil || n != dim {
+		t.Errorf("count through the alias = %d, %v", n, err)
+	}
+	if data, err := os.ReadFile(retrieval.VersionIndexPath(ingestCfg.LexicalIndexPath, version)); err != nil || string(data) != `{"docs":[]}` {
+		t.Errorf("version lexical index = %q, %v", data, err)
+	}
+	if _, err := r.Adopt(ctx); err == nil {
+		t.Error("adopted an alias")
+	}
+
+	report, err := r.Run(ctx, testRows(), "")
+	if err != nil || report.Previous != version || alias(t, store) != report.Version {
+		t.Errorf("Run after Adopt = %+v, %v", report, err)
+	}
+}
+
+func TestAdoptRefusals(t *testing.T) {
+	ctx := context.Background()
+	ingestCfg := testIngestConfig(t)
+
+	r := newTestReindexer(t, ingestCfg, oneHot, &aliasStore{Memory: vectorstore.NewMemory()})
+	if _, err := r.Adopt(ctx); !errors.Is(err, vectorstore.ErrCollectionNotFound) {
+		t.Errorf("Adopt without a collection = %v", err)
+	}
+
+	// a collection embedded with another dimension is not adopted
+	store := &aliasStore{Memory: vectorstore.NewMemory()}
+	spec := testMapping().CollectionSpec("docs", "vector", dim-1)
+	spec.Properties = embedder.Config{Model: "fake", Dimension: dim - 1}.Properties()
+	if err := store.EnsureCollection(ctx, spec); err != nil {
+		t.Fatal(err)
+	}
+	r = newTestReindexer(t, ingestCfg, oneHot, store)
+	if _, err := r.Adopt(ctx); !errors.Is(err, embedder.ErrMismatch) {
+		t.Errorf("Adopt of a mismatched collection = %v", err)
+	}
+	if names, _ := store.ListCollections(ctx); !reflect.DeepEqual(names, []string{"docs"}) {
+		t.Errorf("collections = %v, want docs left in place", names)
+	}
+
+	// a failed alias leaves the renamed version, and rolling back to it creates the alias
+	store = &aliasStore{Memory: vectorstore.NewMemory(), failSetAlias: true}
+	spec = testMapping().CollectionSpec("docs", "vector", dim)
+	spec.Properties = ingestCfg.Embedding.Properties()
+	if err := store.EnsureCollection(ctx, spec); err != nil {
+		t.Fatal(err)
+	}
+	r = newTestReindexer(t, ingestCfg, oneHot, store)
+	version, err := r.Adopt(ctx)
+	if err == nil || version == "" {
+		t.Fatalf("Adopt with a failing alias = %s, %v", version, err)
+	}
+	store.failSetAlias = false
+	if _, to, err := r.Rollback(ctx, version); err != nil || to != version || alias(t, store) != version {
+		t.Errorf("Rollback(%s) = %s, %v", version, to, err)
+	}
+}
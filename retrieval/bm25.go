@@ -0,0 +1,258 @@
+package retrieval
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/pawarison/eino-multi-modal-poc/articles"
+)
+
+// BM25 parameters.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// LexicalIndex is an in-memory BM25 index over article titles and
+// publications. It keeps the articles so lexical-only hits can be returned
+// without a vector store lookup.
+type LexicalIndex struct {
+	articles map[int64]articles.Article
+	terms    map[int64]map[string]int
+	lengths  map[int64]int
+	postings map[string]map[int64]int
+	totalLen int
+}
+
+// LexicalHit is one BM25 match.
+type LexicalHit struct {
+	Article articles.Article
+	Score   float64
+}
+
+// NewLexicalIndex creates an empty index.
+func NewLexicalIndex() *LexicalIndex {
+	return &LexicalIndex{
+		articles: map[int64]articles.Article{},
+		terms:    map[int64]map[string]int{},
+		lengths:  map[int64]int{},
+		postings: map[string]map[int64]int{},
+	}
+}
+
+// BuildLexicalIndex indexes rows. Later rows replace earlier ones with the same id.
+func BuildLexicalIndex(rows []articles.Article) *LexicalIndex {
+	idx := NewLexicalIndex()
+	for _, a := range rows {
+		idx.Add(a)
+	}
+	return idx
+}
+
+// Len is the number of indexed articles.
+func (x *LexicalIndex) Len() int {
+	return len(x.articles)
+}
+
+// Add indexes a, replacing any article with the same id.
+func (x *LexicalIndex) Add(a articles.Article) {
+	x.Remove(a.ID)
+	tf := map[string]int{}
+	n := 0
+	for _, t := range Tokenize(a.Title + " " + a.Publication) {
+		tf[t]++
+		n++
+	}
+	x.articles[a.ID] = a
+	x.terms[a.ID] = tf
+	x.lengths[a.ID] = n
+	x.totalLen += n
+	for t, c := range tf {
+		p, ok := x.postings[t]
+		if !ok {
+			p = map[int64]int{}
+			x.postings[t] = p
+		}
+		p[a.ID] = c
+	}
+}
+
+// Remove drops the article with id from the index.
+func (x *LexicalIndex) Remove(id int64) {
+	tf, ok := x.terms[id]
+	if !ok {
+		return
+	}
+	for t := range tf {
+		delete(x.postings[t], id)
+		if len(x.postings[t]) == 0 {
+			delete(x.postings, t)
+		}
+	}
+	x.totalLen -= x.lengths[id]
+	delete(x.articles, id)
+	delete(x.terms, id)
+	delete(x.lengths, id)
+}
+
+// Article returns the indexed article with id.
+func (x *LexicalIndex) Article(id int64) (articles.Article, bool) {
+	a, ok := x.articles[id]
+	return a, ok
+}
+
+// Search returns up to k articles ranked by BM25 score for query. keep, when
+// not nil, filters candidates before ranking.
+func (x *LexicalIndex) Search(query string, k int, keep func(articles.Article) bool) []LexicalHit {
+	n := len(x.articles)
+	if n == 0 || k <= 0 {
+		return nil
+	}
+	avgLen := float64(x.totalLen) / float64(n)
+	scores := map[int64]float64{}
+	seen := map[string]bool{}
+	for _, t := range Tokenize(query) {
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+		p := x.postings[t]
+		if len(p) == 0 {
+			continue
+		}
+		idf := math.Log(1 + (float64(n)-float64(len(p))+0.5)/(float64(len(p))+0.5))
+		for id, tf := range p {
+			f := float64(tf)
+			norm := 1 - bm25B + bm25B*float64(x.lengths[id])/avgLen
+			scores[id] += idf * f * (bm25K1 + 1) / (f + bm25K1*norm)
+		}
+	}
+
+	hits := make([]LexicalHit, 0, len(scores))
+	for id, s := range scores {
+		a := x.articles[id]
+		if keep != nil && !keep(a) {
+			continue
+		}
+		hits = append(hits, LexicalHit{Article: a, Score: s})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].Article.ID < hits[j].Article.ID
+	})
+	if len(hits) > k {
+		hits = hits[:k]
+	}
+	return hits
+}
+
+// Tokenize lowercases text and splits it into words. Thai has no spaces
+// between words, so Thai runs are split into overlapping character bigrams.
+func Tokenize(text string) []string {
+	var tokens []string
+	var word []rune
+	flush := func() {
+		if len(word) == 0 {
+			return
+		}
+		if unicode.Is(unicode.Thai, word[0]) {
+			tokens = append(tokens, thaiBigrams(word)...)
+		} else {
+			tokens = append(tokens, string(word))
+		}
+		word = word[:0]
+	}
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.Is(unicode.Thai, r):
+			if len(word) > 0 && !unicode.Is(unicode.Thai, word[0]) {
+				flush()
+			}
+			word = append(word, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if len(word) > 0 && unicode.Is(unicode.Thai, word[0]) {
+				flush()
+			}
+			word = append(word, r)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return tokens
+}
+
+func thaiBigrams(run []rune) []string {
+	if len(run) < 2 {
+		return []string{string(run)}
+	}
+	out := make([]string, 0, len(run)-1)
+	for i := 0; i+1 < len(run); i++ {
+		out = append(out, string(run[i:i+2]))
+	}
+	return out
+}
+
+// lexicalFile is the persisted form: the articles, from which the postings are rebuilt.
+type lexicalFile struct {
+	Articles []articles.Article `json:"articles"`
+}
+
+// Save writes the index to path atomically.
+func (x *LexicalIndex) Save(path string) error {
+	rows := make([]articles.Article, 0, len(x.articles))
+	for _, a := range x.articles {
+		rows = append(rows, a)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].ID < rows[j].ID })
+	data, err := json.Marshal(lexicalFile{Articles: rows})
+	if err != nil {
+		return fmt.Errorf("encode lexical index: %w", err)
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("create lexical index dir %s: %w", dir, err)
+	}
+	tmp, err := os.CreateTemp(dir, ".lexical-*")
+	if err != nil {
+		return fmt.Errorf("write lexical index: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write lexical index: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close lexical index: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("commit lexical index %s: %w", path, err)
+	}
+	return nil
+}
+
+// LoadLexicalIndex reads an index written by Save. A missing file returns fs.ErrNotExist.
+func LoadLexicalIndex(path string) (*LexicalIndex, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read lexical index %s: %w", path, err)
+	}
+	var f lexicalFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("decode lexical index %s: %w", path, err)
+	}
+	return BuildLexicalIndex(f.Articles), nil
+}
@@ -0,0 +1,137 @@
+package retrieval
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/pawarison/eino-multi-modal-poc/articles"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"Go Concurrency, Explained!", []string{"go", "concurrency", "explained"}},
+		{"iPhone15 ราคา", []string{"iphone15", "รา", "าค", "คา"}},
+		{"สอนGo", []string{"สอ", "อน", "go"}},
+		{"ก", []string{"ก"}},
+		{"  --  ", nil},
+	}
+	for _, tt := range tests {
+		if got := Tokenize(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Tokenize(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func lexicalIDs(hits []LexicalHit) []int64 {
+	out := make([]int64, len(hits))
+	for i, h := range hits {
+		out[i] = h.Article.ID
+	}
+	return out
+}
+
+func TestLexicalIndexSearch(t *testing.T) {
+	idx := BuildLexicalIndex([]articles.Article{
+		{ID: 1, Title: "Go generics in practice"},
+		{ID: 2, Title: "Rust ownership", Publication: "Go Weekly"},
+		{ID: 3, Title: "Go Go Go: a short guide to go routines and channels in go"},
+		{ID: 4, Title: "Python packaging"},
+	})
+
+	// rarer terms weigh more: "generics" only matches article 1
+	if got := lexicalIDs(idx.Search("go generics", 10, nil)); !reflect.DeepEqual(got, []int64{1, 3, 2}) {
+		t.Errorf("go generics = %v", got)
+	}
+	if got := lexicalIDs(idx.Search("go", 2, nil)); len(got) != 2 {
+		t.Errorf("k = 2 returned %v", got)
+	}
+	keep := func(a articles.Article) bool { return a.ID != 1 }
+	if got := lexicalIDs(idx.Search("generics", 10, keep)); len(got) != 0 {
+		t.Errorf("filtered search = %v", got)
+	}
+	if got := idx.Search("kotlin", 10, nil); len(got) != 0 {
+		t.Errorf("unknown term = %v", got)
+	}
+
+	idx.Add(articles.Article{ID: 1, Title: "Python typing"})
+	if got := lexicalIDs(idx.Search("generics", 10, nil)); len(got) != 0 {
+		t.Errorf("replaced article still matches: %v", got)
+	}
+	idx.Remove(4)
+	if got := lexicalIDs(idx.Search("python", 10, nil)); !reflect.DeepEqual(got, []int64{1}) {
+		t.Errorf("python after remove = %v", got)
+	}
+}
+
+func TestLexicalIndexSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bm25.json")
+	idx := BuildLexicalIndex([]articles.Article{{ID: 7, Title: "บทความภาษาไทย"}, {ID: 8, Title: "English article"}})
+	if err := idx.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadLexicalIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := loaded.Search("ภาษา", 5, nil), idx.Search("ภาษา", 5, nil); !reflect.DeepEqual(got, want) || len(got) != 1 {
+		t.Errorf("loaded search = %+v, want %+v", got, want)
+	}
+}
+
+func TestSearchFusesRanks(t *testing.T) {
+	ctx := context.Background()
+	cfg := searchConfig(t)
+	rows := map[articles.Article][]float32{
+		{ID: 1, Title: "Kubernetes operators"}: {1, 0},
+		{ID: 2, Title: "Writing a Go linter"}:  {0.8, 0.6},
+		{ID: 3, Title: "Gardening basics"}:     {0, 1},
+	}
+	store := articleStore(t, cfg, rows)
+	index := NewLexicalIndex()
+	for a := range rows {
+		index.Add(a)
+	}
+	s, err := NewSearcher(ctx, cfg, vectors{"go linter": {1, 0}}, store, index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hits, err := s.Search(ctx, Request{Query: "go linter", TopK: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 3 {
+		t.Fatalf("hits = %+v", hits)
+	}
+
+	// article 2 is second by vector and first by BM25, so it beats article 1,
+	// which only the vector retriever found
+	top := hits[0]
+	if top.Article.ID != 2 || top.VectorRank != 2 || top.LexicalRank != 1 {
+		t.Errorf("top hit = %+v", top)
+	}
+	want := cfg.VectorWeight/(cfg.RRFK+2) + cfg.LexicalWeight/(cfg.RRFK+1)
+	if top.FusionScore != want || top.Score != want {
+		t.Errorf("fusion score = %g, want %g", top.FusionScore, want)
+	}
+	if hits[1].Article.ID != 1 || hits[1].LexicalRank != 0 {
+		t.Errorf("second hit = %+v", hits[1])
+	}
+
+	cfg.LexicalWeight = 0
+	s, err = NewSearcher(ctx, cfg, vectors{"go linter": {1, 0}}, store, index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hits, err = s.Search(ctx, Request{Query: "go linter", TopK: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 1 || hits[0].Article.ID != 1 {
+		t.Errorf("vector only = %+v", hits)
+	}
+}
@@ -0,0 +1,76 @@
+package retrieval
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/pawarison/eino-multi-modal-poc/dataset"
+	"github.com/pawarison/eino-multi-modal-poc/vectorstore"
+)
+
+// How the chunk scores of a document combine into its vector score.
+const (
+	// ChunkScoreMax scores a document by its best chunk.
+	ChunkScoreMax = "max"
+	// ChunkScoreMean averages the scores of the document's retrieved chunks.
+	ChunkScoreMean = "mean"
+	// ChunkScoreSum adds them up, favouring documents that match in many places.
+	ChunkScoreSum = "sum"
+)
+
+func validChunkScore(aggregate string) error {
+	switch aggregate {
+	case ChunkScoreMax, ChunkScoreMean, ChunkScoreSum:
+		return nil
+	default:
+		return fmt.Errorf("invalid chunk score %q: want %s, %s or %s", aggregate, ChunkScoreMax, ChunkScoreMean, ChunkScoreSum)
+	}
+}
+
+// collapseChunks turns chunk hits into one hit per parent document, carrying
+// the parent id, the fields of its best chunk and the aggregated score, ranked
+// by that score. At most limit hits are returned.
+func collapseChunks(hits []vectorstore.Hit, aggregate string, limit int) []vectorstore.Hit {
+	type group struct {
+		best  vectorstore.Hit
+		sum   float64
+		count int
+	}
+	groups := map[int64]*group{}
+	var order []int64
+	for _, h := range hits {
+		parent, ok := h.Fields[dataset.FieldParentID].(int64)
+		if !ok {
+			parent = int64(h.Int(dataset.FieldParentID))
+		}
+		g, seen := groups[parent]
+		if !seen {
+			g = &group{best: h}
+			groups[parent] = g
+			order = append(order, parent)
+		} else if h.Score > g.best.Score {
+			g.best = h
+		}
+		g.sum += h.Score
+		g.count++
+	}
+
+	out := make([]vectorstore.Hit, 0, len(order))
+	for _, parent := range order {
+		g := groups[parent]
+		h := g.best
+		h.ID = parent
+		switch aggregate {
+		case ChunkScoreMean:
+			h.Score = g.sum / float64(g.count)
+		case ChunkScoreSum:
+			h.Score = g.sum
+		}
+		out = append(out, h)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Score > out[j].Score })
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
@@ -0,0 +1,56 @@
+package retrieval
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pawarison/eino-multi-modal-poc/dataset"
+	"github.com/pawarison/eino-multi-modal-poc/vectorstore"
+)
+
+func chunkHit(id int64, parent any, text string, score float64) vectorstore.Hit {
+	return vectorstore.Hit{ID: id, Score: score, Fields: map[string]any{dataset.FieldParentID: parent, dataset.FieldChunkText: text}}
+}
+
+func TestCollapseChunks(t *testing.T) {
+	hits := []vectorstore.Hit{
+		chunkHit(10000, int64(1), "one best", 0.9),
+		chunkHit(30000, int64(3), "three", 0.85),
+		chunkHit(20000, float64(2), "two best", 0.8),
+		chunkHit(20001, float64(2), "two", 0.7),
+		chunkHit(20002, float64(2), "two", 0.6),
+		chunkHit(10001, int64(1), "one", 0.4),
+	}
+	tests := []struct {
+		aggregate string
+		want      []int64
+		scores    []float64
+	}{
+		{ChunkScoreMax, []int64{1, 3, 2}, []float64{0.9, 0.85, 0.8}},
+		{ChunkScoreMean, []int64{3, 2, 1}, []float64{0.85, 0.7, 0.65}},
+		{ChunkScoreSum, []int64{2, 1, 3}, []float64{2.1, 1.3, 0.85}},
+	}
+	for _, tt := range tests {
+		out := collapseChunks(hits, tt.aggregate, 10)
+		var ids []int64
+		for i, h := range out {
+			ids = append(ids, h.ID)
+			if !near(h.Score, tt.scores[i]) {
+				t.Errorf("%s: parent %d score = %g, want %g", tt.aggregate, h.ID, h.Score, tt.scores[i])
+			}
+		}
+		if !reflect.DeepEqual(ids, tt.want) {
+			t.Errorf("%s: parents = %v, want %v", tt.aggregate, ids, tt.want)
+		}
+		passages := map[int64]string{}
+		for _, h := range out {
+			passages[h.ID] = h.String(dataset.FieldChunkText)
+		}
+		if want := map[int64]string{1: "one best", 2: "two best", 3: "three"}; !reflect.DeepEqual(passages, want) {
+			t.Errorf("%s: passages = %v, want each parent's best chunk", tt.aggregate, passages)
+		}
+	}
+	if out := collapseChunks(hits, ChunkScoreMax, 2); len(out) != 2 {
+		t.Errorf("limit 2 returned %d hits", len(out))
+	}
+}
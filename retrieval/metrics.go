@@ -0,0 +1,73 @@
+package retrieval
+
+import (
+	"math"
+	"sort"
+)
+
+// Ranking metrics score a ranked list of ids against graded relevance, where
+// a grade above 0 marks an id as relevant and higher grades are better.
+
+// RecallAt is the share of relevant ids in the first k results.
+func RecallAt(ids []int64, relevant map[int64]int, k int) float64 {
+	top := make(map[int64]bool, k)
+	for _, id := range ids[:min(max(k, 0), len(ids))] {
+		top[id] = true
+	}
+	total, found := 0, 0
+	for id, grade := range relevant {
+		if grade <= 0 {
+			continue
+		}
+		total++
+		if top[id] {
+			found++
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(found) / float64(total)
+}
+
+// ReciprocalRank is 1/rank of the first relevant result, or 0. Its mean over
+// queries is the MRR.
+func ReciprocalRank(ids []int64, relevant map[int64]int) float64 {
+	for i, id := range ids {
+		if relevant[id] > 0 {
+			return 1 / float64(i+1)
+		}
+	}
+	return 0
+}
+
+// NDCGAt is the discounted cumulative gain of the first k results over that
+// of the ideal ranking, with the exponential gain 2^grade-1.
+func NDCGAt(ids []int64, relevant map[int64]int, k int) float64 {
+	k = max(k, 0)
+	var dcg float64
+	for i, id := range ids[:min(k, len(ids))] {
+		dcg += gain(relevant[id], i)
+	}
+	grades := make([]int, 0, len(relevant))
+	for _, g := range relevant {
+		grades = append(grades, g)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(grades)))
+	var ideal float64
+	for i, g := range grades[:min(k, len(grades))] {
+		ideal += gain(g, i)
+	}
+	if ideal == 0 {
+		return 0
+	}
+	return dcg / ideal
+}
+
+// gain is the discounted gain of grade at the zero-based rank.
+func gain(grade, rank int) float64 {
+	if grade <= 0 {
+		return 0
+	}
+	return (math.Pow(2, float64(grade)) - 1) / math.Log2(float64(rank+2))
+}
@@ -0,0 +1,47 @@
+package retrieval
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRankingMetrics(t *testing.T) {
+	// ids 1, 3 and 2 are relevant with grades 3, 2 and 1; 4 is graded irrelevant
+	relevant := map[int64]int{1: 3, 2: 1, 3: 2, 4: 0}
+	log3 := math.Log2(3)
+	tests := []struct {
+		name   string
+		ids    []int64
+		k      int
+		recall float64
+		rr     float64
+		ndcg   float64
+	}{
+		{"ideal", []int64{1, 3, 2}, 3, 1, 1, 1},
+		{"first miss", []int64{5, 3, 1, 4, 2}, 1, 0, 0.5, 0},
+		// dcg 3/log2(3) + 7/2 over ideal 7 + 3/log2(3) + 1/2
+		{"partial", []int64{5, 3, 1, 4, 2}, 3, 2.0 / 3, 0.5, (3/log3 + 3.5) / (7 + 3/log3 + 0.5)},
+		{"all found", []int64{5, 3, 1, 4, 2}, 5, 1, 0.5, (3/log3 + 3.5 + 1/math.Log2(6)) / (7 + 3/log3 + 0.5)},
+		{"k above results", []int64{3}, 10, 1.0 / 3, 1, 3 / (7 + 3/log3 + 0.5)},
+		{"top one", []int64{3}, 1, 1.0 / 3, 1, 3.0 / 7},
+		{"irrelevant only", []int64{4, 5}, 2, 0, 0, 0},
+		{"no results", nil, 5, 0, 0, 0},
+		{"zero k", []int64{1}, 0, 0, 1, 0},
+	}
+	for _, tt := range tests {
+		if got := RecallAt(tt.ids, relevant, tt.k); !near(got, tt.recall) {
+			t.Errorf("%s: RecallAt = %g, want %g", tt.name, got, tt.recall)
+		}
+		if got := ReciprocalRank(tt.ids, relevant); !near(got, tt.rr) {
+			t.Errorf("%s: ReciprocalRank = %g, want %g", tt.name, got, tt.rr)
+		}
+		if got := NDCGAt(tt.ids, relevant, tt.k); !near(got, tt.ndcg) {
+			t.Errorf("%s: NDCGAt = %g, want %g", tt.name, got, tt.ndcg)
+		}
+	}
+
+	none := map[int64]int{1: 0}
+	if RecallAt([]int64{1}, none, 1) != 0 || NDCGAt([]int64{1}, none, 1) != 0 {
+		t.Error("a query without relevant ids scores above 0")
+	}
+}
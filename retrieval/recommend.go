@@ -0,0 +1,212 @@
+package retrieval
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/pawarison/eino-multi-modal-poc/articles"
+	"github.com/pawarison/eino-multi-modal-poc/dataset"
+	"github.com/pawarison/eino-multi-modal-poc/vectorstore"
+)
+
+// MaxRecommendSeeds bounds the articles one recommendation starts from.
+const MaxRecommendSeeds = 10
+
+// RecommendRequest asks for articles like the ones in IDs.
+type RecommendRequest struct {
+	IDs  []int64
+	TopK int
+	// Filter applies to the recommended articles, not to the seeds.
+	Filter articles.Filter
+}
+
+// Recommendation is the result of Recommend.
+type Recommendation struct {
+	// Seeds are the articles of the request, in request order.
+	Seeds []articles.Article
+	Hits  []Hit
+}
+
+// Query describes the seeds as text, for rerankers that need a query.
+func (r *Recommendation) Query() string {
+	titles := make([]string, len(r.Seeds))
+	for i, a := range r.Seeds {
+		titles[i] = a.Title
+	}
+	return "articles similar to: " + strings.Join(titles, "; ")
+}
+
+// Recommend returns up to req.TopK articles most similar to the stored
+// vectors of req.IDs, excluding those articles. Several seeds are searched by
+// the mean of their normalized vectors, as are the chunks of one article in a
+// chunked collection. Recommendations come from vector search alone, so
+// their fusion score is the reciprocal rank with weight 1 and the lexical
+// fields are zero.
+func (s *Searcher) Recommend(ctx context.Context, req RecommendRequest) (*Recommendation, error) {
+	if len(req.IDs) == 0 {
+		return nil, fmt.Errorf("at least one article id is required")
+	}
+	if len(req.IDs) > MaxRecommendSeeds {
+		return nil, fmt.Errorf("%d article ids, max %d", len(req.IDs), MaxRecommendSeeds)
+	}
+	if req.TopK <= 0 {
+		return nil, fmt.Errorf("invalid top k %d", req.TopK)
+	}
+	if err := req.Filter.Validate(); err != nil {
+		return nil, err
+	}
+	filter := req.Filter.Conditions()
+	if err := filter.Validate(s.spec); err != nil {
+		return nil, err
+	}
+	t, err := s.target(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	key := vectorstore.PrimaryField
+	if t.chunked {
+		key = dataset.FieldParentID
+	}
+	ids := make([]any, len(req.IDs))
+	for i, id := range req.IDs {
+		ids[i] = id
+	}
+	docs, err := s.store.Query(ctx, t.collection, vectorstore.Filter{vectorstore.In(key, ids...)})
+	if err != nil {
+		return nil, fmt.Errorf("look up articles: %w", err)
+	}
+	seedID := func(d vectorstore.Document) int64 {
+		if t.chunked {
+			id, _ := d.Fields[dataset.FieldParentID].(int64)
+			return id
+		}
+		return d.ID
+	}
+	seeds := map[int64]articles.Article{}
+	for _, d := range docs {
+		id := seedID(d)
+		seeds[id] = articles.FromHit(vectorstore.Hit{ID: id, Fields: d.Fields})
+	}
+	rec := &Recommendation{}
+	var missing []int64
+	for _, id := range req.IDs {
+		a, ok := seeds[id]
+		if !ok {
+			missing = append(missing, id)
+			continue
+		}
+		if !slices.ContainsFunc(rec.Seeds, func(s articles.Article) bool { return s.ID == id }) {
+			rec.Seeds = append(rec.Seeds, a)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("articles not found: %v", missing)
+	}
+	vec, err := meanVector(docs, seedID)
+	if err != nil {
+		return nil, err
+	}
+
+	// fetch extra rows so the seeds can be dropped without coming up short
+	candidates := max(s.cfg.CandidateK, req.TopK)
+	topK := candidates
+	if t.chunked {
+		topK *= s.cfg.ChunkFanout
+	}
+	hits, err := s.store.Search(ctx, t.collection, vectorstore.SearchRequest{Vector: vec, TopK: topK + len(docs), Filter: filter})
+	if err != nil {
+		return nil, fmt.Errorf("vector search: %w", err)
+	}
+	if t.chunked {
+		hits = collapseChunks(hits, s.cfg.ChunkScore, candidates+len(rec.Seeds))
+	}
+	for _, vh := range hits {
+		if _, seed := seeds[vh.ID]; seed {
+			continue
+		}
+		h := Hit{Article: articles.FromHit(vh), VectorScore: vh.Score, VectorRank: len(rec.Hits) + 1}
+		h.Passage = vh.String(dataset.FieldChunkText)
+		h.FusionScore = 1 / (s.cfg.RRFK + float64(h.VectorRank))
+		h.Score = h.FusionScore
+		h.Breakdown = Breakdown{Relevance: h.FusionScore}
+		rec.Hits = append(rec.Hits, h)
+		if len(rec.Hits) == req.TopK {
+			break
+		}
+	}
+	return rec, nil
+}
+
+// meanVector averages the unit vectors of each seed's rows, then averages
+// the seeds' unit directions, so every seed counts the same however many
+// chunks it has. seed returns the seed a row belongs to.
+func meanVector(docs []vectorstore.Document, seed func(vectorstore.Document) int64) ([]float32, error) {
+	var dim int
+	var order []int64
+	sums := map[int64][]float64{}
+	for _, d := range docs {
+		if dim == 0 {
+			dim = len(d.Vector)
+		}
+		if len(d.Vector) != dim {
+			return nil, fmt.Errorf("document %d: vector dimension %d, want %d", d.ID, len(d.Vector), dim)
+		}
+		vec := make([]float64, dim)
+		for i, v := range d.Vector {
+			vec[i] = float64(v)
+		}
+		if !normalize(vec) {
+			continue
+		}
+		id := seed(d)
+		sum, ok := sums[id]
+		if !ok {
+			sum = make([]float64, dim)
+			sums[id] = sum
+			order = append(order, id)
+		}
+		for i, v := range vec {
+			sum[i] += v
+		}
+	}
+	mean := make([]float64, dim)
+	seeds := 0
+	for _, id := range order {
+		sum := sums[id]
+		if !normalize(sum) {
+			continue
+		}
+		seeds++
+		for i, v := range sum {
+			mean[i] += v
+		}
+	}
+	if seeds == 0 {
+		return nil, fmt.Errorf("the articles have no usable vectors")
+	}
+	vec := make([]float32, dim)
+	for i, v := range mean {
+		vec[i] = float32(v / float64(seeds))
+	}
+	return vec, nil
+}
+
+// normalize scales v to unit length in place. It reports false for a zero vector.
+func normalize(v []float64) bool {
+	var norm float64
+	for _, x := range v {
+		norm += x * x
+	}
+	if norm == 0 {
+		return false
+	}
+	norm = math.Sqrt(norm)
+	for i := range v {
+		v[i] /= norm
+	}
+	return true
+}
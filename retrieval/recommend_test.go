@@ -0,0 +1,166 @@
+package retrieval
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pawarison/eino-multi-modal-poc/articles"
+	"github.com/pawarison/eino-multi-modal-poc/dataset"
+	"github.com/pawarison/eino-multi-modal-poc/vectorstore"
+)
+
+func TestRecommend(t *testing.T) {
+	ctx := context.Background()
+	cfg := searchConfig(t)
+	store := articleStore(t, cfg, map[articles.Article][]float32{
+		{ID: 1, Title: "Go channels"}:                  {1, 0},
+		{ID: 2, Title: "Sourdough starters"}:           {0, 1},
+		{ID: 3, Title: "Go select statements"}:         {0.9, 0.1},
+		{ID: 4, Title: "Baking rye bread"}:             {0.1, 0.9},
+		{ID: 5, Title: "Feeding a team", Claps: 100}:   {0.7, 0.7},
+		{ID: 6, Title: "Cooking with Go", Claps: 1000}: {0.6, 0.8},
+	})
+	s, err := NewSearcher(ctx, cfg, vectors{}, store, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec, err := s.Recommend(ctx, RecommendRequest{IDs: []int64{1}, TopK: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hitIDs(rec.Hits); !reflect.DeepEqual(got, []int64{3, 5}) {
+		t.Errorf("like 1 = %v", got)
+	}
+	if h := rec.Hits[0]; h.VectorRank != 1 || h.LexicalRank != 0 || !near(h.FusionScore, 1/(cfg.RRFK+1)) || h.Score != h.FusionScore {
+		t.Errorf("first hit = %+v", h)
+	}
+
+	// several seeds search by their mean direction and are never recommended
+	rec, err = s.Recommend(ctx, RecommendRequest{IDs: []int64{1, 2, 1}, TopK: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hitIDs(rec.Hits); len(got) != 4 || got[0] != 5 {
+		t.Errorf("like 1 and 2 = %v, want 5 first and the seeds left out", got)
+	}
+	if len(rec.Seeds) != 2 || rec.Seeds[0].ID != 1 || rec.Seeds[1].ID != 2 {
+		t.Errorf("seeds = %+v", rec.Seeds)
+	}
+	if q := rec.Query(); !strings.Contains(q, "Go channels; Sourdough starters") {
+		t.Errorf("query = %q", q)
+	}
+
+	minClaps := int32(500)
+	rec, err = s.Recommend(ctx, RecommendRequest{IDs: []int64{1}, TopK: 5, Filter: articles.Filter{MinClaps: &minClaps}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hitIDs(rec.Hits); !reflect.DeepEqual(got, []int64{6}) {
+		t.Errorf("filtered = %v", got)
+	}
+
+	bad := map[string]RecommendRequest{
+		"no ids":     {TopK: 5},
+		"unknown id": {IDs: []int64{1, 99}, TopK: 5},
+		"top k":      {IDs: []int64{1}},
+		"too many":   {IDs: make([]int64, MaxRecommendSeeds+1), TopK: 5},
+	}
+	for name, req := range bad {
+		if _, err := s.Recommend(ctx, req); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+func TestRecommendChunked(t *testing.T) {
+	ctx := context.Background()
+	cfg := searchConfig(t)
+	mapping := articles.Mapping()
+	mapping.Chunking = &dataset.Chunking{Source: "body", Size: 100}
+	spec := mapping.CollectionSpec(cfg.Collection, cfg.VectorField, cfg.Embedding.Dimension)
+	spec.Properties = cfg.Embedding.Properties()
+	store := vectorstore.NewMemory()
+	if err := store.EnsureCollection(ctx, spec); err != nil {
+		t.Fatal(err)
+	}
+	chunk := func(a articles.Article, index int, text string, vec []float32) vectorstore.Document {
+		d := a.Document(vec)
+		d.ID = a.ID*dataset.MaxChunks + int64(index)
+		d.Fields[dataset.FieldParentID] = a.ID
+		d.Fields[dataset.FieldChunkIndex] = int32(index)
+		d.Fields[dataset.FieldChunkText] = text
+		return d
+	}
+	seed := articles.Article{ID: 1, Title: "Seed"}
+	docs := []vectorstore.Document{
+		chunk(seed, 0, "seed intro", []float32{1, 0}),
+		chunk(seed, 1, "seed outro", []float32{0.8, 0.6}),
+		chunk(articles.Article{ID: 2, Title: "Close"}, 0, "close passage", []float32{0.9, 0.3}),
+		chunk(articles.Article{ID: 3, Title: "Far"}, 0, "far passage", []float32{0, 1}),
+	}
+	if err := store.Upsert(ctx, cfg.Collection, docs); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewSearcher(ctx, cfg, vectors{}, store, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec, err := s.Recommend(ctx, RecommendRequest{IDs: []int64{1}, TopK: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rec.Seeds) != 1 || rec.Seeds[0].Title != "Seed" {
+		t.Errorf("seeds = %+v", rec.Seeds)
+	}
+	if got := hitIDs(rec.Hits); !reflect.DeepEqual(got, []int64{2, 3}) {
+		t.Fatalf("hits = %v, want parent ids without the seed", got)
+	}
+	if rec.Hits[0].Passage != "close passage" || rec.Hits[0].Article.Title != "Close" {
+		t.Errorf("first hit = %+v", rec.Hits[0])
+	}
+}
+
+func TestMeanVector(t *testing.T) {
+	doc := func(seed int64, vec ...float32) vectorstore.Document {
+		return vectorstore.Document{ID: seed, Vector: vec, Fields: map[string]any{dataset.FieldParentID: seed}}
+	}
+	parent := func(d vectorstore.Document) int64 { return d.Fields[dataset.FieldParentID].(int64) }
+	r := float32(math.Sqrt(0.5))
+	tests := []struct {
+		name string
+		docs []vectorstore.Document
+		want []float32
+	}{
+		{"one row", []vectorstore.Document{doc(1, 3, 4)}, []float32{0.6, 0.8}},
+		{"scale", []vectorstore.Document{doc(1, 2, 0), doc(2, 0, 3)}, []float32{0.5, 0.5}},
+		// three chunks of seed 1 weigh as much as the one of seed 2
+		{"chunk count", []vectorstore.Document{doc(1, 1, 0), doc(1, 1, 0), doc(1, 1, 0), doc(2, 0, 1)}, []float32{0.5, 0.5}},
+		// seed 1's chunks average to the diagonal before meeting seed 2
+		{"chunk directions", []vectorstore.Document{doc(1, 1, 0), doc(1, 0, 1), doc(2, 1, 0)}, []float32{(r + 1) / 2, r / 2}},
+		{"zero vector", []vectorstore.Document{doc(1, 0, 0), doc(2, 0, 2)}, []float32{0, 1}},
+	}
+	for _, tt := range tests {
+		got, err := meanVector(tt.docs, parent)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		for i := range tt.want {
+			if !near(float64(got[i]), float64(tt.want[i])) {
+				t.Errorf("%s: meanVector = %v, want %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+
+	if _, err := meanVector([]vectorstore.Document{doc(1, 0, 0)}, parent); err == nil {
+		t.Error("zero vectors accepted")
+	}
+	if _, err := meanVector([]vectorstore.Document{doc(1, 1, 0), doc(2, 1, 0, 0)}, parent); err == nil {
+		t.Error("mixed dimensions accepted")
+	}
+}
@@ -0,0 +1,273 @@
+package retrieval
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+
+	"github.com/cloudwego/eino/components/model"
+	"github.com/cloudwego/eino/schema"
+	"github.com/pawarison/eino-multi-modal-poc/prompt/rerank"
+)
+
+// Rerank strategies.
+const (
+	// StrategyPopularity blends a claps and responses prior into the score.
+	StrategyPopularity = "popularity"
+	// StrategyMMR reorders by maximal marginal relevance to spread out near-duplicate titles.
+	StrategyMMR = "mmr"
+	// StrategyLLM blends a chat model's relevance grade into the score.
+	StrategyLLM = "llm"
+)
+
+// RerankConfig controls the reranking stage.
+type RerankConfig struct {
+	// Strategies is a comma-separated set of popularity, mmr and llm. Empty
+	// keeps the fused order.
+	Strategies []string `envconfig:"SEARCH_RERANK"`
+	// Depth is the number of fused candidates reranked before cutting to top k.
+	Depth int `envconfig:"SEARCH_RERANK_DEPTH" default:"30"`
+	// PopularityWeight and LLMWeight are the shares of the score taken by those
+	// signals; relevance gets the rest.
+	PopularityWeight float64 `envconfig:"SEARCH_POPULARITY_WEIGHT" default:"0.2"`
+	LLMWeight        float64 `envconfig:"SEARCH_LLM_WEIGHT" default:"0.5"`
+	// MMRLambda trades relevance (1) against diversity (0).
+	MMRLambda float64 `envconfig:"SEARCH_MMR_LAMBDA" default:"0.7"`
+}
+
+// Breakdown splits a hit's final score into additive parts.
+type Breakdown struct {
+	// Relevance comes from the fused retrieval score, normalized to the best candidate.
+	Relevance float64
+	// Popularity comes from claps and responses, normalized to the most popular candidate.
+	Popularity float64
+	// LLM comes from the chat model's relevance grade.
+	LLM float64
+	// Diversity is zero or negative: the penalty for resembling a higher-ranked title.
+	Diversity float64
+}
+
+// Reranker reorders fused hits with the configured strategies.
+type Reranker struct {
+	cfg        RerankConfig
+	popularity bool
+	mmr        bool
+	llm        bool
+	model      model.BaseChatModel
+}
+
+// NewReranker creates a reranker. chatModel is only used by the llm strategy
+// and may be nil otherwise.
+func NewReranker(cfg *RerankConfig, chatModel model.BaseChatModel) (*Reranker, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("rerank config is nil")
+	}
+	r := &Reranker{cfg: *cfg, model: chatModel}
+	for _, s := range cfg.Strategies {
+		switch s {
+		case StrategyPopularity:
+			r.popularity = true
+		case StrategyMMR:
+			r.mmr = true
+		case StrategyLLM:
+			r.llm = true
+		default:
+			return nil, fmt.Errorf("unknown rerank strategy %q", s)
+		}
+	}
+	if r.llm && chatModel == nil {
+		return nil, fmt.Errorf("rerank strategy llm needs a chat model")
+	}
+	if r.Enabled() && cfg.Depth <= 0 {
+		return nil, fmt.Errorf("invalid rerank depth %d", cfg.Depth)
+	}
+	if cfg.PopularityWeight < 0 || cfg.LLMWeight < 0 || r.popWeight()+r.llmWeight() > 1 {
+		return nil, fmt.Errorf("invalid rerank weights: popularity %g, llm %g", cfg.PopularityWeight, cfg.LLMWeight)
+	}
+	if cfg.MMRLambda < 0 || cfg.MMRLambda > 1 {
+		return nil, fmt.Errorf("invalid mmr lambda %g: must be 0-1", cfg.MMRLambda)
+	}
+	return r, nil
+}
+
+// Enabled reports whether any strategy is configured.
+func (r *Reranker) Enabled() bool {
+	return r.popularity || r.mmr || r.llm
+}
+
+// Depth is the number of candidates to retrieve for a final top k.
+func (r *Reranker) Depth(topK int) int {
+	if !r.Enabled() {
+		return topK
+	}
+	return max(r.cfg.Depth, topK)
+}
+
+func (r *Reranker) popWeight() float64 {
+	if !r.popularity {
+		return 0
+	}
+	return r.cfg.PopularityWeight
+}
+
+func (r *Reranker) llmWeight() float64 {
+	if !r.llm {
+		return 0
+	}
+	return r.cfg.LLMWeight
+}
+
+// Rerank scores hits for query and returns the best topK. Without strategies
+// the fused order is kept. If the chat model fails, its share goes back to
+// relevance and the failure is logged.
+func (r *Reranker) Rerank(ctx context.Context, query string, hits []Hit, topK int) ([]Hit, error) {
+	if topK <= 0 {
+		return nil, fmt.Errorf("invalid top k %d", topK)
+	}
+	if !r.Enabled() || len(hits) == 0 {
+		return hits[:min(topK, len(hits))], nil
+	}
+	out := append([]Hit(nil), hits...)
+
+	wp, wl := r.popWeight(), r.llmWeight()
+	var grades map[int64]float64
+	if r.llm {
+		var err error
+		grades, err = r.grade(ctx, query, out)
+		if err != nil {
+			log.Printf("llm rerank failed, using relevance only: %v", err)
+			wl = 0
+		}
+	}
+
+	var maxFusion, maxPop float64
+	for _, h := range out {
+		maxFusion = max(maxFusion, h.FusionScore)
+		maxPop = max(maxPop, popularity(h))
+	}
+	for i := range out {
+		h := &out[i]
+		h.Breakdown = Breakdown{}
+		if maxFusion > 0 {
+			h.Breakdown.Relevance = (1 - wp - wl) * h.FusionScore / maxFusion
+		}
+		if maxPop > 0 {
+			h.Breakdown.Popularity = wp * popularity(*h) / maxPop
+		}
+		h.Breakdown.LLM = wl * grades[h.Article.ID] / rerank.MaxScore
+		h.Score = h.Breakdown.Relevance + h.Breakdown.Popularity + h.Breakdown.LLM
+	}
+
+	if r.mmr {
+		out = r.diversify(out, topK)
+	} else {
+		sort.SliceStable(out, func(i, j int) bool {
+			if out[i].Score != out[j].Score {
+				return out[i].Score > out[j].Score
+			}
+			return out[i].FusionScore > out[j].FusionScore
+		})
+	}
+	return out[:min(topK, len(out))], nil
+}
+
+// popularity is log(1 + claps + responses), so a few viral articles do not
+// flatten the rest.
+func popularity(h Hit) float64 {
+	return math.Log1p(float64(max(h.Article.Claps, 0)) + float64(max(h.Article.Responses, 0)))
+}
+
+// diversify greedily picks the hit with the best lambda*score minus
+// (1-lambda)*similarity to the titles already picked. Penalties only grow,
+// so the final scores are non-increasing.
+func (r *Reranker) diversify(hits []Hit, topK int) []Hit {
+	lambda := r.cfg.MMRLambda
+	tokens := make([]map[string]bool, len(hits))
+	for i, h := range hits {
+		tokens[i] = tokenSet(h.Article.Title)
+	}
+	redundancy := make([]float64, len(hits))
+	picked := make([]bool, len(hits))
+	out := make([]Hit, 0, min(topK, len(hits)))
+	for len(out) < cap(out) {
+		best, bestScore := -1, math.Inf(-1)
+		for i, h := range hits {
+			if picked[i] {
+				continue
+			}
+			s := lambda*h.Score - (1-lambda)*redundancy[i]
+			if s > bestScore {
+				best, bestScore = i, s
+			}
+		}
+		picked[best] = true
+		h := hits[best]
+		h.Breakdown = Breakdown{
+			Relevance:  lambda * h.Breakdown.Relevance,
+			Popularity: lambda * h.Breakdown.Popularity,
+			LLM:        lambda * h.Breakdown.LLM,
+		}
+		if redundancy[best] > 0 {
+			h.Breakdown.Diversity = -(1 - lambda) * redundancy[best]
+		}
+		h.Score = bestScore
+		out = append(out, h)
+		for i := range hits {
+			if !picked[i] {
+				redundancy[i] = max(redundancy[i], jaccard(tokens[i], tokens[best]))
+			}
+		}
+	}
+	return out
+}
+
+func tokenSet(text string) map[string]bool {
+	set := map[string]bool{}
+	for _, t := range Tokenize(text) {
+		set[t] = true
+	}
+	return set
+}
+
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for t := range a {
+		if b[t] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+// grade asks the chat model for a 0-10 relevance grade per hit. Hits the
+// model skips get 0.
+func (r *Reranker) grade(ctx context.Context, query string, hits []Hit) (map[int64]float64, error) {
+	in := &rerank.RerankModelInput{Query: query, Candidates: make([]rerank.Candidate, len(hits))}
+	for i, h := range hits {
+		in.Candidates[i] = rerank.Candidate{ID: h.Article.ID, Title: h.Article.Title, Publication: h.Article.Publication}
+	}
+	system, err := rerank.RenderRerankSystem(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	out, err := r.model.Generate(ctx, []*schema.Message{
+		schema.SystemMessage(system),
+		schema.UserMessage(query),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("grade candidates: %w", err)
+	}
+	if out == nil {
+		return nil, fmt.Errorf("grade candidates: empty response")
+	}
+	grades := rerank.ParseRerankOutput(out.Content)
+	if len(grades) == 0 {
+		return nil, fmt.Errorf("grade candidates: no scores in response")
+	}
+	return grades, nil
+}
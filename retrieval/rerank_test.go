@@ -0,0 +1,153 @@
+package retrieval
+
+import (
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/pawarison/eino-multi-modal-poc/articles"
+	"github.com/pawarison/eino-multi-modal-poc/config"
+	"github.com/pawarison/eino-multi-modal-poc/llm"
+)
+
+func reranker(t *testing.T, chatModel *llm.Fake, strategies ...string) *Reranker {
+	t.Helper()
+	cfg, err := config.New[RerankConfig]("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Strategies = strategies
+	r, err := NewReranker(cfg, chatModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func fusedHit(id int64, title string, fusion float64) Hit {
+	return Hit{Article: articles.Article{ID: id, Title: title}, FusionScore: fusion, Score: fusion}
+}
+
+func hitIDs(hits []Hit) []int64 {
+	out := make([]int64, len(hits))
+	for i, h := range hits {
+		out[i] = h.Article.ID
+	}
+	return out
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestRerankPopularity(t *testing.T) {
+	r := reranker(t, nil, StrategyPopularity)
+	viral := fusedHit(2, "Viral", 0.9)
+	viral.Article.Claps = 5000
+	hits := []Hit{fusedHit(1, "Quiet", 1), viral}
+
+	out, err := r.Rerank(context.Background(), "q", hits, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hitIDs(out); !reflect.DeepEqual(got, []int64{2, 1}) {
+		t.Fatalf("order = %v, want the popular hit first", got)
+	}
+	// relevance gets 0.8 of the score, scaled to the best fused score
+	if b := out[0].Breakdown; !near(b.Relevance, 0.8*0.9) || !near(b.Popularity, 0.2) || !near(out[0].Score, b.Relevance+b.Popularity) {
+		t.Errorf("breakdown = %+v, score %g", b, out[0].Score)
+	}
+	if b := out[1].Breakdown; !near(b.Relevance, 0.8) || b.Popularity != 0 {
+		t.Errorf("quiet breakdown = %+v", b)
+	}
+}
+
+func TestRerankMMR(t *testing.T) {
+	hits := []Hit{
+		fusedHit(1, "Go concurrency patterns", 1),
+		fusedHit(2, "Go concurrency patterns explained", 0.95),
+		fusedHit(3, "Rust memory safety", 0.8),
+	}
+
+	plain, err := reranker(t, nil, StrategyPopularity).Rerank(context.Background(), "q", hits, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hitIDs(plain); !reflect.DeepEqual(got, []int64{1, 2, 3}) {
+		t.Errorf("without mmr = %v", got)
+	}
+
+	out, err := reranker(t, nil, StrategyMMR).Rerank(context.Background(), "q", hits, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hitIDs(out); !reflect.DeepEqual(got, []int64{1, 3, 2}) {
+		t.Fatalf("mmr order = %v, want the near-duplicate last", got)
+	}
+	if out[0].Breakdown.Diversity != 0 || out[2].Breakdown.Diversity >= 0 {
+		t.Errorf("diversity penalties = %g, %g", out[0].Breakdown.Diversity, out[2].Breakdown.Diversity)
+	}
+	for i := 1; i < len(out); i++ {
+		if out[i].Score > out[i-1].Score {
+			t.Errorf("scores increase at %d: %g > %g", i, out[i].Score, out[i-1].Score)
+		}
+	}
+	if short, _ := reranker(t, nil, StrategyMMR).Rerank(context.Background(), "q", hits, 1); len(short) != 1 {
+		t.Errorf("top 1 = %v", hitIDs(short))
+	}
+}
+
+func TestRerankLLM(t *testing.T) {
+	var prompt string
+	chatModel := llm.NewFake(func(input []*schema.Message) (string, error) {
+		prompt = input[0].Content
+		return "(score<||>2<||>10)##(score<||>1<||>2)##(score<||>3<||>15)##(score<||>x<||>4)##<|COMPLETE|>", nil
+	})
+	r := reranker(t, chatModel, StrategyLLM)
+	hits := []Hit{fusedHit(1, "First", 1), fusedHit(2, "Second", 0.5), fusedHit(3, "Third", 0.1)}
+
+	out, err := r.Rerank(context.Background(), "go tips", hits, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(prompt, "Second") || !strings.Contains(prompt, "go tips") {
+		t.Errorf("grading prompt lacks the candidates or query:\n%s", prompt)
+	}
+	// 0.5 relevance share plus 0.5 of the grade out of 10; 15 is clamped
+	want := map[int64]float64{2: 0.25 + 0.5, 1: 0.5 + 0.1, 3: 0.05 + 0.5}
+	if got := hitIDs(out); !reflect.DeepEqual(got, []int64{2, 1, 3}) {
+		t.Fatalf("order = %v", got)
+	}
+	for _, h := range out {
+		if !near(h.Score, want[h.Article.ID]) {
+			t.Errorf("hit %d score = %g, want %g", h.Article.ID, h.Score, want[h.Article.ID])
+		}
+	}
+}
+
+func TestRerankLLMFailureKeepsRelevance(t *testing.T) {
+	replies := map[string]*llm.Fake{
+		"error":     llm.NewFake(func([]*schema.Message) (string, error) { return "", errors.New("quota") }),
+		"no scores": llm.NewScripted("I cannot grade these."),
+	}
+	for name, chatModel := range replies {
+		t.Run(name, func(t *testing.T) {
+			r := reranker(t, chatModel, StrategyLLM)
+			hits := []Hit{fusedHit(1, "First", 1), fusedHit(2, "Second", 0.5)}
+			out, err := r.Rerank(context.Background(), "q", hits, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := hitIDs(out); !reflect.DeepEqual(got, []int64{1, 2}) || out[0].Score != 1 || out[0].Breakdown.LLM != 0 {
+				t.Errorf("out = %+v, want the fused order with full relevance", out)
+			}
+			if chatModel.Calls() != 1 {
+				t.Errorf("model calls = %d", chatModel.Calls())
+			}
+		})
+	}
+}
@@ -0,0 +1,358 @@
+// Package retrieval finds articles for a query by fusing vector search with
+// a BM25 lexical index, so short keyword queries still hit exact title matches.
+package retrieval
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/eino/components/embedding"
+	"github.com/pawarison/eino-multi-modal-poc/articles"
+	"github.com/pawarison/eino-multi-modal-poc/dataset"
+	"github.com/pawarison/eino-multi-modal-poc/embedder"
+	"github.com/pawarison/eino-multi-modal-poc/vectorstore"
+)
+
+// Config controls hybrid article search.
+type Config struct {
+	// Collection is the collection searched, or an alias pointing at one.
+	Collection  string `envconfig:"MILVUS_COLLECTION" default:"articles"`
+	VectorField string `envconfig:"MILVUS_VECTOR_FIELD" default:"title_vector"`
+	// Embedding must match the config recorded on the collection.
+	Embedding embedder.Config `envconfig:"EMBEDDING"`
+	// LexicalIndexPath is the BM25 index written by ingestion. Empty disables
+	// lexical search.
+	LexicalIndexPath string `envconfig:"SEARCH_LEXICAL_INDEX" default:".index/articles_bm25.json"`
+	// CandidateK is the number of candidates each retriever contributes to fusion.
+	CandidateK int `envconfig:"SEARCH_CANDIDATES" default:"50"`
+	// RRFK dampens the advantage of top ranks in reciprocal rank fusion.
+	RRFK float64 `envconfig:"SEARCH_RRF_K" default:"60"`
+	// VectorWeight and LexicalWeight scale each retriever's fused contribution.
+	VectorWeight  float64 `envconfig:"SEARCH_VECTOR_WEIGHT" default:"1"`
+	LexicalWeight float64 `envconfig:"SEARCH_LEXICAL_WEIGHT" default:"1"`
+	// AliasRefresh is how long a resolved alias is trusted before it is
+	// resolved again. 0 resolves it on every search.
+	AliasRefresh time.Duration `envconfig:"SEARCH_ALIAS_REFRESH" default:"10s"`
+	// ChunkScore combines the chunk scores of a document in a chunked
+	// collection: max, mean or sum.
+	ChunkScore string `envconfig:"SEARCH_CHUNK_SCORE" default:"max"`
+	// ChunkFanout multiplies the vector candidates fetched from a chunked
+	// collection, so enough documents remain after collapsing their chunks.
+	ChunkFanout int `envconfig:"SEARCH_CHUNK_FANOUT" default:"4"`
+}
+
+// Request is one search.
+type Request struct {
+	Query string
+	TopK  int
+	// Filter applies to both retrievers before fusion.
+	Filter articles.Filter
+}
+
+// Hit is one fused search result. Ranks are 1-based; 0 means the retriever
+// did not return the article.
+type Hit struct {
+	Article articles.Article
+	// Score is the final score: the fusion score until a Reranker rescores the hit.
+	Score     float64
+	Breakdown Breakdown
+	// FusionScore is the weighted reciprocal rank fusion score.
+	FusionScore  float64
+	VectorScore  float64
+	VectorRank   int
+	LexicalScore float64
+	LexicalRank  int
+	// Passage is the best matching chunk when the collection is chunked.
+	Passage string
+}
+
+// Searcher runs hybrid searches against one collection, or against whatever
+// collection an alias of that name points at.
+type Searcher struct {
+	cfg      Config
+	spec     vectorstore.CollectionSpec
+	embedder embedding.Embedder
+	store    vectorstore.Store
+	// index loads the lexical index of a resolved collection.
+	index func(collection string) (*LexicalIndex, error)
+
+	mu       sync.Mutex
+	active   *target
+	resolved time.Time
+}
+
+// target is a prepared collection and its lexical index.
+type target struct {
+	collection string
+	lexical    *LexicalIndex
+	// chunked is true when rows are chunks of articles.
+	chunked bool
+}
+
+// NewSearcher resolves cfg.Collection and checks the collection once,
+// refusing a missing one or one embedded with a different config than
+// cfg.Embedding. embedder
+// must embed queries with that config. index may be nil, in which case only
+// vector search is used; it is kept when the alias moves.
+func NewSearcher(ctx context.Context, cfg *Config, embedder embedding.Embedder, store vectorstore.Store, index *LexicalIndex) (*Searcher, error) {
+	return newSearcher(ctx, cfg, embedder, store, index != nil, func(string) (*LexicalIndex, error) { return index, nil })
+}
+
+// LoadSearcher is NewSearcher with the lexical index read from
+// cfg.LexicalIndexPath, or from the VersionIndexPath of the collection an
+// alias points at. A missing index file falls back to vector search.
+func LoadSearcher(ctx context.Context, cfg *Config, embedder embedding.Embedder, store vectorstore.Store) (*Searcher, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("retrieval config is nil")
+	}
+	load := func(collection string) (*LexicalIndex, error) {
+		if cfg.LexicalIndexPath == "" {
+			return nil, nil
+		}
+		path := cfg.LexicalIndexPath
+		if collection != cfg.Collection {
+			path = VersionIndexPath(path, collection)
+		}
+		index, err := LoadLexicalIndex(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			log.Printf("lexical index %s not found, using vector search only; run ingestion to build it", path)
+			return nil, nil
+		}
+		return index, err
+	}
+	return newSearcher(ctx, cfg, embedder, store, cfg.LexicalIndexPath != "", load)
+}
+
+// VersionIndexPath is where the lexical index of a versioned collection is
+// kept: base with the collection name before the extension.
+func VersionIndexPath(base, collection string) string {
+	ext := filepath.Ext(base)
+	return strings.TrimSuffix(base, ext) + "." + collection + ext
+}
+
+func newSearcher(ctx context.Context, cfg *Config, embedder embedding.Embedder, store vectorstore.Store, lexical bool, index func(string) (*LexicalIndex, error)) (*Searcher, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("retrieval config is nil")
+	}
+	if embedder == nil {
+		return nil, fmt.Errorf("embedder is nil")
+	}
+	if store == nil {
+		return nil, fmt.Errorf("vector store is nil")
+	}
+	if cfg.CandidateK <= 0 {
+		return nil, fmt.Errorf("invalid candidate count %d", cfg.CandidateK)
+	}
+	if cfg.RRFK < 0 || cfg.VectorWeight < 0 || cfg.LexicalWeight < 0 {
+		return nil, fmt.Errorf("invalid fusion parameters: k %g, vector weight %g, lexical weight %g",
+			cfg.RRFK, cfg.VectorWeight, cfg.LexicalWeight)
+	}
+	if cfg.VectorWeight == 0 && (!lexical || cfg.LexicalWeight == 0) {
+		return nil, fmt.Errorf("no retriever enabled")
+	}
+	if cfg.AliasRefresh < 0 {
+		return nil, fmt.Errorf("invalid alias refresh interval %s", cfg.AliasRefresh)
+	}
+	if err := validChunkScore(cfg.ChunkScore); err != nil {
+		return nil, err
+	}
+	if cfg.ChunkFanout < 1 {
+		return nil, fmt.Errorf("invalid chunk fanout %d", cfg.ChunkFanout)
+	}
+
+	s := &Searcher{
+		cfg:      *cfg,
+		spec:     articles.CollectionSpec(cfg.Collection, cfg.VectorField, 0),
+		embedder: embedder,
+		store:    store,
+		index:    index,
+	}
+	if _, err := s.target(ctx); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Collection returns the collection searches currently go to.
+func (s *Searcher) Collection(ctx context.Context) (string, error) {
+	t, err := s.target(ctx)
+	if err != nil {
+		return "", err
+	}
+	return t.collection, nil
+}
+
+// target resolves the alias at most once per cfg.AliasRefresh and checks the
+// collection it points at when that changed. Once a collection is active, a
+// failure to resolve or check the next one is logged and the active
+// collection keeps serving.
+func (s *Searcher) target(ctx context.Context) (*target, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active != nil && time.Since(s.resolved) < s.cfg.AliasRefresh {
+		return s.active, nil
+	}
+	t, err := s.resolve(ctx)
+	if err != nil {
+		if s.active == nil {
+			return nil, err
+		}
+		log.Printf("keeping collection %s: %v", s.active.collection, err)
+		t = s.active
+	}
+	if s.active != nil && t.collection != s.active.collection {
+		log.Printf("%s now points at collection %s (was %s)", s.cfg.Collection, t.collection, s.active.collection)
+	}
+	s.active, s.resolved = t, time.Now()
+	return t, nil
+}
+
+func (s *Searcher) resolve(ctx context.Context) (*target, error) {
+	name, err := s.store.ResolveAlias(ctx, s.cfg.Collection)
+	switch {
+	case errors.Is(err, vectorstore.ErrAliasNotFound):
+		name = s.cfg.Collection
+	case err != nil:
+		return nil, err
+	}
+	if s.active != nil && s.active.collection == name {
+		return s.active, nil
+	}
+
+	// searching never creates a collection; ingestion and reindexing do
+	existing, err := s.store.Describe(ctx, name)
+	if errors.Is(err, vectorstore.ErrCollectionNotFound) {
+		return nil, fmt.Errorf("collection %s does not exist, run ingestion first: %w", name, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	spec := s.spec
+	spec.Name = name
+	if err := spec.Check(existing); err != nil {
+		return nil, err
+	}
+	if err := s.cfg.Embedding.Check(existing); err != nil {
+		return nil, err
+	}
+	index, err := s.index(name)
+	if err != nil {
+		return nil, err
+	}
+	_, chunked := existing.Field(dataset.FieldParentID)
+	return &target{collection: name, lexical: index, chunked: chunked}, nil
+}
+
+// Search returns up to req.TopK articles matching req.Filter, ranked by fused score.
+func (s *Searcher) Search(ctx context.Context, req Request) ([]Hit, error) {
+	if req.Query == "" {
+		return nil, fmt.Errorf("query is required")
+	}
+	if req.TopK <= 0 {
+		return nil, fmt.Errorf("invalid top k %d", req.TopK)
+	}
+	if err := req.Filter.Validate(); err != nil {
+		return nil, err
+	}
+	filter := req.Filter.Conditions()
+	if err := filter.Validate(s.spec); err != nil {
+		return nil, err
+	}
+	t, err := s.target(ctx)
+	if err != nil {
+		return nil, err
+	}
+	candidates := max(s.cfg.CandidateK, req.TopK)
+
+	fused := map[int64]*Hit{}
+	hit := func(a articles.Article) *Hit {
+		h, ok := fused[a.ID]
+		if !ok {
+			h = &Hit{Article: a}
+			fused[a.ID] = h
+		}
+		return h
+	}
+
+	if s.cfg.VectorWeight > 0 {
+		vec, err := s.embedQuery(ctx, req.Query)
+		if err != nil {
+			return nil, err
+		}
+		topK := candidates
+		if t.chunked {
+			topK *= s.cfg.ChunkFanout
+		}
+		hits, err := s.store.Search(ctx, t.collection, vectorstore.SearchRequest{Vector: vec, TopK: topK, Filter: filter})
+		if err != nil {
+			return nil, fmt.Errorf("vector search: %w", err)
+		}
+		if t.chunked {
+			hits = collapseChunks(hits, s.cfg.ChunkScore, candidates)
+		}
+		for i, vh := range hits {
+			h := hit(articles.FromHit(vh))
+			h.Passage = vh.String(dataset.FieldChunkText)
+			h.VectorScore = vh.Score
+			h.VectorRank = i + 1
+			h.FusionScore += s.cfg.VectorWeight / (s.cfg.RRFK + float64(h.VectorRank))
+		}
+	}
+
+	if t.lexical != nil && s.cfg.LexicalWeight > 0 {
+		var keep func(articles.Article) bool
+		if len(filter) > 0 {
+			keep = req.Filter.Match
+		}
+		for i, lh := range t.lexical.Search(req.Query, candidates, keep) {
+			h := hit(lh.Article)
+			h.LexicalScore = lh.Score
+			h.LexicalRank = i + 1
+			h.FusionScore += s.cfg.LexicalWeight / (s.cfg.RRFK + float64(h.LexicalRank))
+		}
+	}
+
+	out := make([]Hit, 0, len(fused))
+	for _, h := range fused {
+		h.Score = h.FusionScore
+		h.Breakdown = Breakdown{Relevance: h.FusionScore}
+		out = append(out, *h)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.FusionScore != b.FusionScore {
+			return a.FusionScore > b.FusionScore
+		}
+		if a.VectorScore != b.VectorScore {
+			return a.VectorScore > b.VectorScore
+		}
+		return a.Article.ID < b.Article.ID
+	})
+	if len(out) > req.TopK {
+		out = out[:req.TopK]
+	}
+	return out, nil
+}
+
+func (s *Searcher) embedQuery(ctx context.Context, query string) ([]float32, error) {
+	embeddings, err := s.embedder.EmbedStrings(ctx, []string{query})
+	if err != nil {
+		return nil, fmt.Errorf("embed query: %w", err)
+	}
+	if len(embeddings) == 0 || len(embeddings[0]) == 0 {
+		return nil, fmt.Errorf("embed query: empty embedding returned")
+	}
+	vec := make([]float32, len(embeddings[0]))
+	for i, v := range embeddings[0] {
+		vec[i] = float32(v)
+	}
+	return vec, nil
+}
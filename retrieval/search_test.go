@@ -0,0 +1,102 @@
+package retrieval
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cloudwego/eino/components/embedding"
+	"github.com/pawarison/eino-multi-modal-poc/articles"
+	"github.com/pawarison/eino-multi-modal-poc/config"
+	"github.com/pawarison/eino-multi-modal-poc/vectorstore"
+)
+
+// vectors embeds each known text as its fixed vector and anything else as {1, 0}.
+type vectors map[string][]float64
+
+func (v vectors) EmbedStrings(_ context.Context, texts []string, _ ...embedding.Option) ([][]float64, error) {
+	out := make([][]float64, len(texts))
+	for i, t := range texts {
+		vec, ok := v[t]
+		if !ok {
+			vec = []float64{1, 0}
+		}
+		out[i] = vec
+	}
+	return out, nil
+}
+
+func searchConfig(t *testing.T) *Config {
+	t.Helper()
+	cfg, err := config.New[Config]("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Embedding.Dimension = 2
+	cfg.LexicalIndexPath = ""
+	return cfg
+}
+
+// articleStore creates cfg.Collection the way ingestion does and stores each
+// article with its 2-dimensional vector.
+func articleStore(t *testing.T, cfg *Config, rows map[articles.Article][]float32) *vectorstore.Memory {
+	t.Helper()
+	ctx := context.Background()
+	store := vectorstore.NewMemory()
+	spec := articles.CollectionSpec(cfg.Collection, cfg.VectorField, cfg.Embedding.Dimension)
+	spec.Properties = cfg.Embedding.Properties()
+	if err := store.EnsureCollection(ctx, spec); err != nil {
+		t.Fatal(err)
+	}
+	var docs []vectorstore.Document
+	for a, vec := range rows {
+		docs = append(docs, a.Document(vec))
+	}
+	if err := store.Upsert(ctx, cfg.Collection, docs); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestSearcherDoesNotCreateCollections(t *testing.T) {
+	ctx := context.Background()
+	cfg := searchConfig(t)
+	store := vectorstore.NewMemory()
+	if _, err := NewSearcher(ctx, cfg, vectors{}, store, nil); !errors.Is(err, vectorstore.ErrCollectionNotFound) {
+		t.Fatalf("NewSearcher on a missing collection = %v, want ErrCollectionNotFound", err)
+	}
+	names, err := store.ListCollections(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 0 {
+		t.Errorf("searching created collections %v", names)
+	}
+}
+
+func TestSearcherFollowsAlias(t *testing.T) {
+	ctx := context.Background()
+	cfg := searchConfig(t)
+	cfg.AliasRefresh = 0
+	versioned := *cfg
+	versioned.Collection = "articles_v2"
+	store := articleStore(t, &versioned, map[articles.Article][]float32{{ID: 1, Title: "Go"}: {1, 0}})
+	if err := store.SetAlias(ctx, cfg.Collection, versioned.Collection); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewSearcher(ctx, cfg, vectors{}, store, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hits, err := s.Search(ctx, Request{Query: "go", TopK: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 1 || hits[0].Article.Title != "Go" || hits[0].VectorRank != 1 {
+		t.Errorf("hits = %+v", hits)
+	}
+	if name, err := s.Collection(ctx); err != nil || name != versioned.Collection {
+		t.Errorf("collection = %q, %v", name, err)
+	}
+}
@@ -0,0 +1,216 @@
+package session
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// lockName is the lock file that serializes processes sharing a directory.
+const lockName = ".lock"
+
+// FileStore keeps one JSON file per session in a local directory, so sessions
+// survive restarts without an external service. Writes go through a temp file
+// and rename. Compare-and-swap is serialized within the process and, on Unix,
+// across processes sharing the directory through a lock file.
+type FileStore struct {
+	mu  sync.Mutex
+	dir string
+	ttl time.Duration
+	now func() time.Time
+}
+
+// NewFileStore creates the directory if needed. A ttl of 0 disables expiry.
+func NewFileStore(dir string, ttl time.Duration) (*FileStore, error) {
+	if strings.TrimSpace(dir) == "" {
+		return nil, fmt.Errorf("session dir is empty")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create session dir %s: %w", dir, err)
+	}
+	return &FileStore{dir: dir, ttl: ttl, now: time.Now}, nil
+}
+
+func (f *FileStore) Get(ctx context.Context, id string) (*Session, error) {
+	unlock, err := f.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	return f.read(id)
+}
+
+func (f *FileStore) Put(ctx context.Context, s *Session) error {
+	unlock, err := f.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	current, err := f.version(s.ID)
+	if err != nil {
+		return err
+	}
+	return f.write(s, current+1)
+}
+
+func (f *FileStore) CompareAndSwap(ctx context.Context, s *Session, expected int64) error {
+	unlock, err := f.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	current, err := f.version(s.ID)
+	if err != nil {
+		return err
+	}
+	if current != expected {
+		return ErrVersionConflict
+	}
+	return f.write(s, expected+1)
+}
+
+func (f *FileStore) ListByUser(ctx context.Context, userID string) ([]*Session, error) {
+	unlock, err := f.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	entries, err := os.ReadDir(f.dir)
+	if err != nil {
+		return nil, fmt.Errorf("list session dir: %w", err)
+	}
+	var out []*Session
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(f.dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("read session file %s: %w", entry.Name(), err)
+		}
+		s, err := decode(data)
+		if err != nil {
+			return nil, err
+		}
+		if s.UserID != userID {
+			continue
+		}
+		if expired(s, f.now()) {
+			_ = os.Remove(f.path(s.ID))
+			continue
+		}
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].UpdatedAt.After(out[j].UpdatedAt) })
+	return out, nil
+}
+
+func (f *FileStore) Delete(ctx context.Context, id string) error {
+	unlock, err := f.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := os.Remove(f.path(id)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("delete session %s: %w", id, err)
+	}
+	return nil
+}
+
+// lock takes f.mu and the directory's lock file; unlock releases both.
+func (f *FileStore) lock() (unlock func(), err error) {
+	f.mu.Lock()
+	file, err := os.OpenFile(filepath.Join(f.dir, lockName), os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		f.mu.Unlock()
+		return nil, fmt.Errorf("open session lock: %w", err)
+	}
+	if err := lockFile(file); err != nil {
+		file.Close()
+		f.mu.Unlock()
+		return nil, fmt.Errorf("lock session dir: %w", err)
+	}
+	return func() {
+		unlockFile(file)
+		file.Close()
+		f.mu.Unlock()
+	}, nil
+}
+
+// read loads a live session, removing it when expired. Callers hold the lock.
+func (f *FileStore) read(id string) (*Session, error) {
+	data, err := os.ReadFile(f.path(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read session %s: %w", id, err)
+	}
+	s, err := decode(data)
+	if err != nil {
+		return nil, err
+	}
+	if expired(s, f.now()) {
+		_ = os.Remove(f.path(id))
+		return nil, ErrNotFound
+	}
+	return s, nil
+}
+
+// version returns the stored version of a live session, or 0. Callers hold the lock.
+func (f *FileStore) version(id string) (int64, error) {
+	s, err := f.read(id)
+	if errors.Is(err, ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return s.Version, nil
+}
+
+// write atomically replaces the session file at version. Callers hold the lock.
+func (f *FileStore) write(s *Session, version int64) error {
+	cp := *s
+	stamp(&cp, version, f.ttl, f.now())
+	data, err := encode(&cp)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(f.dir, ".session-*")
+	if err != nil {
+		return fmt.Errorf("write session %s: %w", s.ID, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write session %s: %w", s.ID, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("sync session %s: %w", s.ID, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close session %s: %w", s.ID, err)
+	}
+	if err := os.Rename(tmp.Name(), f.path(s.ID)); err != nil {
+		return fmt.Errorf("commit session %s: %w", s.ID, err)
+	}
+
+	s.Version, s.UpdatedAt, s.ExpiresAt = cp.Version, cp.UpdatedAt, cp.ExpiresAt
+	return nil
+}
+
+// path hex-encodes the id so any session id maps to a safe file name.
+func (f *FileStore) path(id string) string {
+	return filepath.Join(f.dir, hex.EncodeToString([]byte(id))+".json")
+}
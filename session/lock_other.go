@@ -0,0 +1,11 @@
+//go:build !unix
+
+package session
+
+import "os"
+
+// lockFile is a no-op where flock is unavailable: a FileStore directory must
+// then be used by one process only.
+func lockFile(*os.File) error { return nil }
+
+func unlockFile(*os.File) error { return nil }
@@ -0,0 +1,125 @@
+package session
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	data      []byte
+	userID    string
+	version   int64
+	expiresAt time.Time
+}
+
+// MemoryStore keeps sessions in process memory. Sessions are stored encoded so
+// callers never share state with the store.
+type MemoryStore struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	now     func() time.Time
+	entries map[string]*memoryEntry
+}
+
+// NewMemoryStore creates an in-memory store. A ttl of 0 disables expiry.
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	return &MemoryStore{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: map[string]*memoryEntry{},
+	}
+}
+
+func (m *MemoryStore) Get(ctx context.Context, id string) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.live(id)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return decode(e.data)
+}
+
+func (m *MemoryStore) Put(ctx context.Context, s *Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var current int64
+	if e, ok := m.live(s.ID); ok {
+		current = e.version
+	}
+	return m.write(s, current+1)
+}
+
+func (m *MemoryStore) CompareAndSwap(ctx context.Context, s *Session, expected int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var current int64
+	if e, ok := m.live(s.ID); ok {
+		current = e.version
+	}
+	if current != expected {
+		return ErrVersionConflict
+	}
+	return m.write(s, expected+1)
+}
+
+func (m *MemoryStore) ListByUser(ctx context.Context, userID string) ([]*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []*Session
+	for id, e := range m.entries {
+		if e.userID != userID {
+			continue
+		}
+		if _, ok := m.live(id); !ok {
+			continue
+		}
+		s, err := decode(e.data)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].UpdatedAt.After(out[j].UpdatedAt) })
+	return out, nil
+}
+
+func (m *MemoryStore) Delete(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, id)
+	return nil
+}
+
+// live returns the entry for id, dropping it when expired. Callers hold m.mu.
+func (m *MemoryStore) live(id string) (*memoryEntry, bool) {
+	e, ok := m.entries[id]
+	if !ok {
+		return nil, false
+	}
+	if !e.expiresAt.IsZero() && m.now().After(e.expiresAt) {
+		delete(m.entries, id)
+		return nil, false
+	}
+	return e, true
+}
+
+// write stores s at version and reflects the new metadata back on s. Callers hold m.mu.
+func (m *MemoryStore) write(s *Session, version int64) error {
+	cp := *s
+	stamp(&cp, version, m.ttl, m.now())
+	data, err := encode(&cp)
+	if err != nil {
+		return err
+	}
+	m.entries[s.ID] = &memoryEntry{
+		data:      data,
+		userID:    cp.UserID,
+		version:   cp.Version,
+		expiresAt: cp.ExpiresAt,
+	}
+	s.Version, s.UpdatedAt, s.ExpiresAt = cp.Version, cp.UpdatedAt, cp.ExpiresAt
+	return nil
+}
@@ -0,0 +1,142 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/pawarison/eino-multi-modal-poc/dialogue"
+	"github.com/pawarison/eino-multi-modal-poc/privacy"
+)
+
+var (
+	// ErrNotFound is returned for missing or expired sessions.
+	ErrNotFound = errors.New("session not found")
+	// ErrVersionConflict is returned by CompareAndSwap when the stored version moved on.
+	ErrVersionConflict = errors.New("session version conflict")
+)
+
+// Session is everything persisted for one conversation.
+type Session struct {
+	ID      string                  `json:"id"`
+	UserID  string                  `json:"user_id"`
+	Version int64                   `json:"version"`
+	State   *dialogue.DialogueState `json:"state"`
+	History []*schema.Message       `json:"history"`
+	// Vault holds the PII behind the placeholders in History. It is never
+	// persisted; see Vaults for how long it is kept.
+	Vault     *privacy.Vault `json:"-"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	ExpiresAt time.Time      `json:"expires_at"`
+}
+
+// New creates an empty session. Its vault is attached by Vaults.
+func New(id, userID string) *Session {
+	return &Session{
+		ID:     id,
+		UserID: userID,
+		State:  dialogue.NewDialogueState(),
+	}
+}
+
+// Store persists sessions. Implementations return copies, so callers may
+// mutate what Get returns and write it back with CompareAndSwap.
+type Store interface {
+	// Get returns the session or ErrNotFound when it is missing or expired.
+	Get(ctx context.Context, id string) (*Session, error)
+	// Put writes the session unconditionally and bumps its version.
+	Put(ctx context.Context, s *Session) error
+	// CompareAndSwap writes the session only if the stored version equals
+	// expected (0 means the session must not exist yet). On success s.Version
+	// is set to the new version.
+	CompareAndSwap(ctx context.Context, s *Session, expected int64) error
+	// ListByUser returns the live sessions of a user, most recently updated first.
+	ListByUser(ctx context.Context, userID string) ([]*Session, error)
+	// Delete removes the session. Deleting a missing session is not an error.
+	Delete(ctx context.Context, id string) error
+}
+
+// Config selects and configures a Store backend.
+type Config struct {
+	Backend string        `envconfig:"SESSION_BACKEND" default:"file"` // file | memory
+	Dir     string        `envconfig:"SESSION_DIR" default:".sessions"`
+	TTL     time.Duration `envconfig:"SESSION_TTL" default:"24h"`
+}
+
+// NewStore builds the Store selected by cfg.
+func NewStore(cfg *Config) (Store, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("session config is nil")
+	}
+	switch cfg.Backend {
+	case "", "memory":
+		return NewMemoryStore(cfg.TTL), nil
+	case "file":
+		return NewFileStore(cfg.Dir, cfg.TTL)
+	default:
+		return nil, fmt.Errorf("unknown session backend %q", cfg.Backend)
+	}
+}
+
+// Update loads a session (or creates it with create when missing), applies fn
+// and saves it with CompareAndSwap, retrying on version conflicts.
+func Update(ctx context.Context, store Store, id string, create func() *Session, fn func(*Session) error) (*Session, error) {
+	const maxAttempts = 5
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		s, err := store.Get(ctx, id)
+		if errors.Is(err, ErrNotFound) && create != nil {
+			s, err = create(), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		expected := s.Version
+		if err := fn(s); err != nil {
+			return nil, err
+		}
+		err = store.CompareAndSwap(ctx, s, expected)
+		if errors.Is(err, ErrVersionConflict) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+	return nil, fmt.Errorf("update session %s: %w after %d attempts", id, ErrVersionConflict, maxAttempts)
+}
+
+func encode(s *Session) ([]byte, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, fmt.Errorf("encode session %s: %w", s.ID, err)
+	}
+	return data, nil
+}
+
+func decode(data []byte) (*Session, error) {
+	var s Session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("decode session: %w", err)
+	}
+	if s.State == nil {
+		s.State = dialogue.NewDialogueState()
+	}
+	return &s, nil
+}
+
+func expired(s *Session, now time.Time) bool {
+	return !s.ExpiresAt.IsZero() && now.After(s.ExpiresAt)
+}
+
+// stamp prepares s for a write at version.
+func stamp(s *Session, version int64, ttl time.Duration, now time.Time) {
+	s.Version = version
+	s.UpdatedAt = now
+	if ttl > 0 {
+		s.ExpiresAt = now.Add(ttl)
+	}
+}
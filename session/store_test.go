@@ -0,0 +1,233 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/pawarison/eino-multi-modal-poc/privacy"
+)
+
+// clock is a settable time source for expiry tests.
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time { return c.t }
+
+// backend is a store under test with the clock it reads.
+type backend struct {
+	store Store
+	clock *clock
+}
+
+func stores(t *testing.T, ttl time.Duration) map[string]backend {
+	t.Helper()
+	start := time.Unix(1_700_000_000, 0)
+
+	mc := &clock{t: start}
+	mem := NewMemoryStore(ttl)
+	mem.now = mc.now
+
+	fc := &clock{t: start}
+	file, err := NewFileStore(t.TempDir(), ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.now = fc.now
+	return map[string]backend{"memory": {mem, mc}, "file": {file, fc}}
+}
+
+func TestStoreCompareAndSwap(t *testing.T) {
+	ctx := context.Background()
+	for name, b := range stores(t, 0) {
+		t.Run(name, func(t *testing.T) {
+			if _, err := b.store.Get(ctx, "s1"); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("Get missing = %v, want ErrNotFound", err)
+			}
+			s := New("s1", "u1")
+			if err := b.store.CompareAndSwap(ctx, s, 0); err != nil {
+				t.Fatal(err)
+			}
+			if s.Version != 1 {
+				t.Fatalf("version = %d, want 1", s.Version)
+			}
+			if err := b.store.CompareAndSwap(ctx, New("s1", "u1"), 0); !errors.Is(err, ErrVersionConflict) {
+				t.Fatalf("create over an existing session = %v, want ErrVersionConflict", err)
+			}
+
+			got, err := b.store.Get(ctx, "s1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got.History = append(got.History, schema.UserMessage("hello"))
+			if err := b.store.CompareAndSwap(ctx, got, 1); err != nil {
+				t.Fatal(err)
+			}
+			if err := b.store.CompareAndSwap(ctx, s, 1); !errors.Is(err, ErrVersionConflict) {
+				t.Fatalf("stale write = %v, want ErrVersionConflict", err)
+			}
+			got, err = b.store.Get(ctx, "s1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Version != 2 || len(got.History) != 1 || got.State == nil {
+				t.Errorf("stored session = %+v", got)
+			}
+		})
+	}
+}
+
+func TestStoreExpiryAndList(t *testing.T) {
+	ctx := context.Background()
+	for name, b := range stores(t, time.Hour) {
+		t.Run(name, func(t *testing.T) {
+			for _, id := range []string{"old", "new"} {
+				if err := b.store.Put(ctx, New(id, "u1")); err != nil {
+					t.Fatal(err)
+				}
+				b.clock.t = b.clock.t.Add(40 * time.Minute)
+			}
+			if err := b.store.Put(ctx, New("other", "u2")); err != nil {
+				t.Fatal(err)
+			}
+
+			list, err := b.store.ListByUser(ctx, "u1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(list) != 1 || list[0].ID != "new" {
+				t.Errorf("ListByUser = %v, want only the live session", ids(list))
+			}
+			if _, err := b.store.Get(ctx, "old"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Get expired = %v, want ErrNotFound", err)
+			}
+			if err := b.store.Delete(ctx, "new"); err != nil {
+				t.Fatal(err)
+			}
+			if err := b.store.Delete(ctx, "new"); err != nil {
+				t.Errorf("deleting a missing session = %v", err)
+			}
+		})
+	}
+}
+
+func TestUpdateRetriesConflicts(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(0)
+	if err := store.Put(ctx, New("s1", "u1")); err != nil {
+		t.Fatal(err)
+	}
+	calls := 0
+	s, err := Update(ctx, store, "s1", nil, func(s *Session) error {
+		calls++
+		if calls == 1 {
+			// another writer moves the version on between Get and CompareAndSwap
+			if err := store.Put(ctx, New("s1", "u1")); err != nil {
+				return err
+			}
+		}
+		s.History = append(s.History, schema.UserMessage("hi"))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 || s.Version != 3 {
+		t.Errorf("calls = %d, version = %d, want a retry landing on version 3", calls, s.Version)
+	}
+}
+
+func TestFileStoresShareADirectory(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	const writers, turns = 2, 20
+	var wg sync.WaitGroup
+	var saved atomic.Int64
+	errs := make(chan error, writers)
+	for range writers {
+		// separate stores stand in for separate processes: they share no mutex
+		store, err := NewFileStore(dir, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range turns {
+				_, err := Update(ctx, store, "s1", func() *Session { return New("s1", "u1") }, func(s *Session) error {
+					s.History = append(s.History, schema.UserMessage("hi"))
+					return nil
+				})
+				switch {
+				case err == nil:
+					saved.Add(1)
+				case !errors.Is(err, ErrVersionConflict):
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	store, err := NewFileStore(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := store.Get(ctx, "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(s.History)) != saved.Load() {
+		t.Errorf("%d messages after %d saved updates: a write was lost", len(s.History), saved.Load())
+	}
+}
+
+func TestFileStoreDoesNotPersistVault(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := NewFileStore(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New("s1", "u1")
+	vault := NewVaults(0).Attach(s)
+	redacted := privacy.NewRedactor().Redact("call 0812345678", vault)
+	s.History = append(s.History, schema.UserMessage(redacted))
+	if err := store.Put(ctx, s); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "7331.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "0812345678") || !strings.Contains(string(data), "[PHONE_1]") {
+		t.Errorf("session file holds the raw value or lost the placeholder:\n%s", data)
+	}
+	got, err := store.Get(ctx, "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Vault != nil {
+		t.Errorf("Get returned a vault")
+	}
+}
+
+func ids(sessions []*Session) []string {
+	out := make([]string, len(sessions))
+	for i, s := range sessions {
+		out[i] = s.ID
+	}
+	return out
+}
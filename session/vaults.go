@@ -0,0 +1,72 @@
+package session
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pawarison/eino-multi-modal-poc/privacy"
+)
+
+type vaultEntry struct {
+	vault    *privacy.Vault
+	lastUsed time.Time
+}
+
+// Vaults keeps the PII vault of each session in process memory. Stores never
+// write a vault, so redacted values do not reach disk or a shared backend: a
+// vault is kept until it goes unused for ttl, Forget is called or the process
+// exits. Placeholders in a session resumed after that stay redacted.
+type Vaults struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	now     func() time.Time
+	entries map[string]*vaultEntry
+}
+
+// NewVaults creates an empty set of vaults. A ttl of 0 keeps vaults until
+// Forget or exit; pass the session TTL to drop them with their sessions.
+func NewVaults(ttl time.Duration) *Vaults {
+	return &Vaults{ttl: ttl, now: time.Now, entries: map[string]*vaultEntry{}}
+}
+
+// Attach sets s.Vault to the vault of the session and returns it, creating
+// the vault when this process has none. A new vault skips the placeholder
+// numbers already used in s.History.
+func (v *Vaults) Attach(s *Session) *privacy.Vault {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	now := v.now()
+	v.expire(now)
+	e, ok := v.entries[s.ID]
+	if !ok {
+		e = &vaultEntry{vault: privacy.NewVault()}
+		for _, msg := range s.History {
+			if msg != nil {
+				e.vault.Reserve(msg.Content)
+			}
+		}
+		v.entries[s.ID] = e
+	}
+	e.lastUsed = now
+	s.Vault = e.vault
+	return e.vault
+}
+
+// Forget drops the vault of a session, e.g. when the session is deleted.
+func (v *Vaults) Forget(id string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.entries, id)
+}
+
+// expire drops vaults unused for longer than the ttl. Callers hold v.mu.
+func (v *Vaults) expire(now time.Time) {
+	if v.ttl <= 0 {
+		return
+	}
+	for id, e := range v.entries {
+		if now.Sub(e.lastUsed) > v.ttl {
+			delete(v.entries, id)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package session
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/schema"
+	"github.com/pawarison/eino-multi-modal-poc/privacy"
+)
+
+func TestVaultsAttach(t *testing.T) {
+	c := &clock{t: time.Unix(1_700_000_000, 0)}
+	vaults := NewVaults(time.Hour)
+	vaults.now = c.now
+
+	s := New("s1", "u1")
+	first := vaults.Attach(s)
+	if s.Vault != first {
+		t.Fatal("Attach did not set the session vault")
+	}
+	redactor := privacy.NewRedactor()
+	redactor.Redact("0812345678", first)
+
+	c.t = c.t.Add(30 * time.Minute)
+	if again := vaults.Attach(New("s1", "u1")); again != first {
+		t.Error("a second Attach created a new vault")
+	}
+
+	c.t = c.t.Add(2 * time.Hour)
+	if expired := vaults.Attach(New("s1", "u1")); expired == first {
+		t.Error("the vault outlived its ttl")
+	}
+
+	vaults.Forget("s1")
+	if forgotten := vaults.Attach(New("s1", "u1")); forgotten == first {
+		t.Error("Forget kept the vault")
+	}
+}
+
+func TestVaultsAttachSkipsPlaceholdersInHistory(t *testing.T) {
+	// a resumed session whose vault was lost with the previous process
+	s := New("s1", "u1")
+	s.History = []*schema.Message{
+		schema.UserMessage("call [PHONE_1] or [PHONE_2]"),
+		schema.AssistantMessage("I will email [EMAIL_1]", nil),
+	}
+	vault := NewVaults(0).Attach(s)
+
+	got := privacy.NewRedactor().Redact("0899999999 x@y.co", vault)
+	if want := "[PHONE_3] [EMAIL_2]"; got != want {
+		t.Errorf("Redact = %q, want %q", got, want)
+	}
+	if restored := vault.Restore("[PHONE_1]"); restored != "[PHONE_1]" {
+		t.Errorf("an unknown placeholder restored to %q", restored)
+	}
+}
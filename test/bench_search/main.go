@@ -0,0 +1,157 @@
+// Command bench_search compares the per-call latency of search_articles when
+// every call builds its own clients (the old behaviour) against the tool built
+// once on long-lived clients. It calls the real Gemini and Milvus services.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/milvus-io/milvus/client/v2/entity"
+	"github.com/milvus-io/milvus/client/v2/milvusclient"
+	"github.com/pawarison/eino-multi-modal-poc/config"
+	"github.com/pawarison/eino-multi-modal-poc/embedder"
+	"github.com/pawarison/eino-multi-modal-poc/retrieval"
+	"github.com/pawarison/eino-multi-modal-poc/tools"
+	"github.com/pawarison/eino-multi-modal-poc/vectorstore"
+	"google.golang.org/genai"
+)
+
+func main() {
+	_ = godotenv.Load()
+	query := flag.String("query", "How do I use NLP with Python?", "search query")
+	flag.Parse()
+
+	ctx := context.Background()
+	clientsCfg, err := config.New[tools.ClientsConfig]("")
+	if err != nil {
+		log.Fatalf("load clients config: %v", err)
+	}
+	searchCfg, err := config.New[tools.SearchArticlesConfig]("")
+	if err != nil {
+		log.Fatalf("load search config: %v", err)
+	}
+	retrievalCfg, err := config.New[retrieval.Config]("")
+	if err != nil {
+		log.Fatalf("load retrieval config: %v", err)
+	}
+
+	perCall := testing.Benchmark(func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if err := searchPerCall(ctx, clientsCfg, retrievalCfg, searchCfg.DefaultTopK, *query); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	// measure client reuse alone; cached query embeddings would hide the embedding call
+	clientsCfg.EmbeddingCachePath = ""
+	clients, err := tools.NewClients(ctx, clientsCfg)
+	if err != nil {
+		log.Fatalf("create clients: %v", err)
+	}
+	defer func() {
+		closeCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := clients.Close(closeCtx); err != nil {
+			log.Printf("close clients: %v", err)
+		}
+	}()
+	// vector search only, to compare the same work as the old path
+	vectorCfg := *retrievalCfg
+	vectorCfg.LexicalWeight = 0
+	vectorCfg.CandidateK = searchCfg.DefaultTopK
+	searcher, err := retrieval.NewSearcher(ctx, &vectorCfg, clients.QueryEmbedder, vectorstore.NewMilvus(clients.Milvus), nil)
+	if err != nil {
+		log.Fatalf("create searcher: %v", err)
+	}
+	searchTool, err := tools.NewSearchArticlesTool(searchCfg, searcher, nil)
+	if err != nil {
+		log.Fatalf("create search tool: %v", err)
+	}
+	args, err := json.Marshal(tools.SearchArticlesInput{Query: *query})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	longLived := testing.Benchmark(func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := searchTool.InvokableRun(ctx, string(args)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	report("per-call clients", perCall)
+	report("long-lived clients", longLived)
+	if longLived.NsPerOp() > 0 {
+		fmt.Printf("speedup: %.1fx\n", float64(perCall.NsPerOp())/float64(longLived.NsPerOp()))
+	}
+}
+
+func report(name string, r testing.BenchmarkResult) {
+	fmt.Printf("%-20s %6d calls  %10.1f ms/call\n", name, r.N, float64(r.NsPerOp())/float64(time.Millisecond))
+}
+
+// searchPerCall reproduces the old tool body: new clients and a collection
+// load on every call.
+func searchPerCall(ctx context.Context, clientsCfg *tools.ClientsConfig, cfg *retrieval.Config, topK int, query string) error {
+	genaiClient, err := genai.NewClient(ctx, &genai.ClientConfig{
+		APIKey:  clientsCfg.GeminiAPIKey,
+		Backend: genai.BackendGeminiAPI,
+	})
+	if err != nil {
+		return fmt.Errorf("create genai client: %w", err)
+	}
+
+	queryEmbedder, err := embedder.NewQuery(ctx, genaiClient, clientsCfg.Embedding)
+	if err != nil {
+		return err
+	}
+
+	embeddings, err := queryEmbedder.EmbedStrings(ctx, []string{query})
+	if err != nil {
+		return fmt.Errorf("embed query: %w", err)
+	}
+	if len(embeddings) == 0 || len(embeddings[0]) == 0 {
+		return fmt.Errorf("embed query: empty embedding returned")
+	}
+	queryVector := make([]float32, len(embeddings[0]))
+	for i, v := range embeddings[0] {
+		queryVector[i] = float32(v)
+	}
+
+	milvusClient, err := milvusclient.New(ctx, &milvusclient.ClientConfig{
+		Address:  clientsCfg.MilvusAddr,
+		Username: clientsCfg.MilvusUsername,
+		Password: clientsCfg.MilvusPassword,
+	})
+	if err != nil {
+		return fmt.Errorf("create milvus client: %w", err)
+	}
+	defer milvusClient.Close(ctx)
+
+	loadTask, err := milvusClient.LoadCollection(ctx, milvusclient.NewLoadCollectionOption(cfg.Collection))
+	if err != nil {
+		return fmt.Errorf("load collection %s: %w", cfg.Collection, err)
+	}
+	if err := loadTask.Await(ctx); err != nil {
+		return fmt.Errorf("await collection load: %w", err)
+	}
+
+	searchOpt := milvusclient.NewSearchOption(cfg.Collection, topK, []entity.Vector{entity.FloatVector(queryVector)}).
+		WithANNSField(cfg.VectorField).
+		WithOutputFields("title", "link", "publication", "reading_time", "claps", "responses").
+		WithSearchParam("metric_type", string(entity.COSINE)).
+		WithSearchParam("params", "{\"nprobe\": 10}")
+	if _, err := milvusClient.Search(ctx, searchOpt); err != nil {
+		return fmt.Errorf("search collection: %w", err)
+	}
+	return nil
+}
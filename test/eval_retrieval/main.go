@@ -0,0 +1,455 @@
+// Command eval_retrieval scores search configurations against a file of
+// queries with graded relevant article ids. It reports recall@k, MRR and
+// nDCG@k per query and on average, and with -b diffs two configurations.
+//
+// A configuration is a comma-separated list of:
+//
+//	vector            vector search only
+//	hybrid            vector and BM25 fused by reciprocal rank fusion (default)
+//	filters           apply each query's metadata filter
+//	rerank=a+b        rerank with popularity, mmr and/or llm
+//
+// The llm reranker replays the file given with -llm-recordings; with -record,
+// misses go to the live Gemini chat model and are added to the file, which is
+// created when missing.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cloudwego/eino-ext/components/model/gemini"
+	"github.com/cloudwego/eino/components/embedding"
+	"github.com/cloudwego/eino/components/model"
+	"github.com/joho/godotenv"
+	"github.com/pawarison/eino-multi-modal-poc/articles"
+	"github.com/pawarison/eino-multi-modal-poc/config"
+	"github.com/pawarison/eino-multi-modal-poc/dataset"
+	"github.com/pawarison/eino-multi-modal-poc/embedder"
+	"github.com/pawarison/eino-multi-modal-poc/ingest"
+	"github.com/pawarison/eino-multi-modal-poc/llm"
+	"github.com/pawarison/eino-multi-modal-poc/retrieval"
+	"github.com/pawarison/eino-multi-modal-poc/tools"
+	"github.com/pawarison/eino-multi-modal-poc/vectorstore"
+	"google.golang.org/genai"
+)
+
+const chatModelName = "gemini-2.5-flash"
+
+// evalFile is the query set.
+type evalFile struct {
+	Queries []evalQuery `json:"queries"`
+}
+
+// evalQuery grades relevant article ids from 1 (partial) to 3 (exact).
+type evalQuery struct {
+	ID       string        `json:"id"`
+	Query    string        `json:"query"`
+	Filter   *queryFilter  `json:"filter,omitempty"`
+	Relevant map[int64]int `json:"relevant"`
+}
+
+type queryFilter struct {
+	Publications   []string `json:"publications,omitempty"`
+	MinReadingTime *int32   `json:"min_reading_time,omitempty"`
+	MaxReadingTime *int32   `json:"max_reading_time,omitempty"`
+	MinClaps       *int32   `json:"min_claps,omitempty"`
+	MinResponses   *int32   `json:"min_responses,omitempty"`
+}
+
+func (f *queryFilter) filter() articles.Filter {
+	if f == nil {
+		return articles.Filter{}
+	}
+	return articles.Filter{
+		Publications:   f.Publications,
+		MinReadingTime: f.MinReadingTime,
+		MaxReadingTime: f.MaxReadingTime,
+		MinClaps:       f.MinClaps,
+		MinResponses:   f.MinResponses,
+	}
+}
+
+// setup is one search configuration.
+type setup struct {
+	name    string
+	lexical bool
+	filters bool
+	rerank  []string
+}
+
+func parseSetup(spec string) (setup, error) {
+	s := setup{name: spec, lexical: true}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		switch {
+		case part == "vector":
+			s.lexical = false
+		case part == "hybrid":
+			s.lexical = true
+		case part == "filters":
+			s.filters = true
+		case strings.HasPrefix(part, "rerank="):
+			s.rerank = strings.Split(strings.TrimPrefix(part, "rerank="), "+")
+		default:
+			return s, fmt.Errorf("unknown configuration option %q in %q", part, spec)
+		}
+	}
+	return s, nil
+}
+
+func (s setup) usesLLM() bool {
+	for _, r := range s.rerank {
+		if r == retrieval.StrategyLLM {
+			return true
+		}
+	}
+	return false
+}
+
+// scores are the metrics of one query.
+type scores struct {
+	Recall float64
+	RR     float64
+	NDCG   float64
+}
+
+// options are the command line flags.
+type options struct {
+	evalPath    string
+	specA       string
+	specB       string
+	k           int
+	inMemory    bool
+	datasetPath string
+	recordings  string
+	record      bool
+}
+
+func main() {
+	_ = godotenv.Load()
+	var opts options
+	flag.StringVar(&opts.evalPath, "eval", "data/retrieval_eval.json", "query set with graded relevant ids")
+	flag.StringVar(&opts.specA, "a", "hybrid", "configuration to evaluate")
+	flag.StringVar(&opts.specB, "b", "", "second configuration to diff against -a")
+	flag.IntVar(&opts.k, "k", 5, "cutoff for recall and nDCG")
+	flag.BoolVar(&opts.inMemory, "memory", false, "embed -dataset into an in-memory store instead of searching Milvus")
+	flag.StringVar(&opts.datasetPath, "dataset", "data/medium_articles_2020_dpr_a13e0377ae.json", "dataset embedded with -memory")
+	flag.StringVar(&opts.recordings, "llm-recordings", "", "recorded llm rerank responses, required by rerank=llm")
+	flag.BoolVar(&opts.record, "record", false, "send llm rerank misses to the live chat model and record them")
+	flag.Parse()
+
+	if err := run(opts); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(opts options) error {
+	ctx := context.Background()
+	k := opts.k
+	if k <= 0 {
+		return fmt.Errorf("invalid k %d", k)
+	}
+	queries, err := loadQueries(opts.evalPath)
+	if err != nil {
+		return err
+	}
+	setups := []setup{}
+	for _, spec := range []string{opts.specA, opts.specB} {
+		if spec == "" {
+			continue
+		}
+		s, err := parseSetup(spec)
+		if err != nil {
+			return err
+		}
+		setups = append(setups, s)
+	}
+
+	retrievalCfg, err := config.New[retrieval.Config]("")
+	if err != nil {
+		return fmt.Errorf("load retrieval config: %w", err)
+	}
+	rerankCfg, err := config.New[retrieval.RerankConfig]("")
+	if err != nil {
+		return fmt.Errorf("load rerank config: %w", err)
+	}
+
+	var (
+		genaiClient   *genai.Client
+		queryEmbedder embedding.Embedder
+		store         vectorstore.Store
+		index         *retrieval.LexicalIndex
+	)
+	if opts.inMemory {
+		genaiClient, err = genai.NewClient(ctx, &genai.ClientConfig{
+			APIKey:  os.Getenv("GEMINI_API_KEY"),
+			Backend: genai.BackendGeminiAPI,
+		})
+		if err != nil {
+			return fmt.Errorf("create genai client: %w", err)
+		}
+		documents, err := embedder.NewDocument(ctx, genaiClient, retrievalCfg.Embedding)
+		if err != nil {
+			return err
+		}
+		queryEmbedder, err = embedder.NewQuery(ctx, genaiClient, retrievalCfg.Embedding)
+		if err != nil {
+			return err
+		}
+		rows, err := loadRows(opts.datasetPath)
+		if err != nil {
+			return err
+		}
+		mem := vectorstore.NewMemory()
+		if err := ingestMemory(ctx, retrievalCfg, documents, mem, rows); err != nil {
+			return err
+		}
+		store, index = mem, retrieval.BuildLexicalIndex(rows)
+	} else {
+		clientsCfg, err := config.New[tools.ClientsConfig]("")
+		if err != nil {
+			return fmt.Errorf("load clients config: %w", err)
+		}
+		clients, err := tools.NewClients(ctx, clientsCfg)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			closeCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := clients.Close(closeCtx); err != nil {
+				log.Printf("close clients: %v", err)
+			}
+		}()
+		genaiClient, queryEmbedder, store = clients.GenAI, clients.QueryEmbedder, vectorstore.NewMilvus(clients.Milvus)
+		index, err = retrieval.LoadLexicalIndex(retrievalCfg.LexicalIndexPath)
+		if errors.Is(err, fs.ErrNotExist) {
+			log.Printf("lexical index %s not found; hybrid configurations will use vector search only", retrievalCfg.LexicalIndexPath)
+		} else if err != nil {
+			return err
+		}
+	}
+
+	var chatModel model.BaseChatModel
+	var recorded *llm.Recorded
+	for _, s := range setups {
+		if !s.usesLLM() || recorded != nil {
+			continue
+		}
+		if opts.recordings == "" {
+			return fmt.Errorf("%s reranks with the llm: set -llm-recordings to a recordings file, and add -record to create it from the live model", s.name)
+		}
+		if !opts.record {
+			if _, err := os.Stat(opts.recordings); err != nil {
+				return fmt.Errorf("llm recordings: %w; add -record to create them from the live model", err)
+			}
+		}
+		var live model.BaseChatModel
+		if opts.record {
+			live, err = gemini.NewChatModel(ctx, &gemini.Config{Client: genaiClient, Model: chatModelName})
+			if err != nil {
+				return fmt.Errorf("create chat model: %w", err)
+			}
+		}
+		recorded, err = llm.OpenRecorded(opts.recordings, live)
+		if err != nil {
+			return err
+		}
+		chatModel = recorded
+	}
+
+	results := make([][]scores, len(setups))
+	for i, s := range setups {
+		results[i], err = evaluate(ctx, s, retrievalCfg, rerankCfg, queryEmbedder, store, index, chatModel, queries, k)
+		if err != nil {
+			return fmt.Errorf("evaluate %s: %w", s.name, err)
+		}
+	}
+	if recorded != nil {
+		if err := recorded.Save(); err != nil {
+			return err
+		}
+	}
+
+	report(os.Stdout, setups, queries, results, k)
+	return nil
+}
+
+func loadQueries(path string) ([]evalQuery, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("read query set: %w", err)
+	}
+	var f evalFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("decode query set %s: %w", path, err)
+	}
+	if len(f.Queries) == 0 {
+		return nil, fmt.Errorf("query set %s has no queries", path)
+	}
+	for _, q := range f.Queries {
+		if q.Query == "" || len(q.Relevant) == 0 {
+			return nil, fmt.Errorf("query %q needs a query and relevant ids", q.ID)
+		}
+	}
+	return f.Queries, nil
+}
+
+func loadRows(path string) ([]articles.Article, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("read dataset: %w", err)
+	}
+	var payload struct {
+		Rows []articles.Article `json:"rows"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, fmt.Errorf("decode dataset: %w", err)
+	}
+	return payload.Rows, nil
+}
+
+// ingestMemory embeds rows into store with the regular ingestion pipeline,
+// without a checkpoint or lexical index file.
+func ingestMemory(ctx context.Context, cfg *retrieval.Config, documents embedding.Embedder, store vectorstore.Store, rows []articles.Article) error {
+	ingestCfg, err := config.New[ingest.Config]("")
+	if err != nil {
+		return fmt.Errorf("load ingest config: %w", err)
+	}
+	ingestCfg.Collection, ingestCfg.VectorField, ingestCfg.Embedding = cfg.Collection, cfg.VectorField, cfg.Embedding
+	ingestCfg.CheckpointPath, ingestCfg.LexicalIndexPath = "", ""
+	in, err := ingest.New(ingestCfg, articles.Mapping(), documents, store)
+	if err != nil {
+		return err
+	}
+	records := make([]dataset.Record, len(rows))
+	for i, a := range rows {
+		records[i] = a.Record()
+	}
+	if _, err := in.Run(ctx, records, false); err != nil {
+		return fmt.Errorf("load dataset into memory: %w", err)
+	}
+	return nil
+}
+
+func evaluate(ctx context.Context, s setup, retrievalCfg *retrieval.Config, rerankCfg *retrieval.RerankConfig,
+	queryEmbedder embedding.Embedder, store vectorstore.Store, index *retrieval.LexicalIndex, chatModel model.BaseChatModel,
+	queries []evalQuery, k int) ([]scores, error) {
+	cfg := *retrievalCfg
+	if !s.lexical {
+		index = nil
+	}
+	searcher, err := retrieval.NewSearcher(ctx, &cfg, queryEmbedder, store, index)
+	if err != nil {
+		return nil, err
+	}
+	rcfg := *rerankCfg
+	rcfg.Strategies = s.rerank
+	reranker, err := retrieval.NewReranker(&rcfg, chatModel)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]scores, len(queries))
+	for i, q := range queries {
+		req := retrieval.Request{Query: q.Query, TopK: reranker.Depth(k)}
+		if s.filters {
+			req.Filter = q.Filter.filter()
+		}
+		hits, err := searcher.Search(ctx, req)
+		if err != nil {
+			return nil, fmt.Errorf("query %s: %w", q.ID, err)
+		}
+		hits, err = reranker.Rerank(ctx, q.Query, hits, k)
+		if err != nil {
+			return nil, fmt.Errorf("query %s: %w", q.ID, err)
+		}
+		ids := make([]int64, len(hits))
+		for j, h := range hits {
+			ids[j] = h.Article.ID
+		}
+		out[i] = scores{
+			Recall: retrieval.RecallAt(ids, q.Relevant, k),
+			RR:     retrieval.ReciprocalRank(ids, q.Relevant),
+			NDCG:   retrieval.NDCGAt(ids, q.Relevant, k),
+		}
+	}
+	return out, nil
+}
+
+func mean(s []scores) scores {
+	var m scores
+	for _, x := range s {
+		m.Recall += x.Recall
+		m.RR += x.RR
+		m.NDCG += x.NDCG
+	}
+	n := float64(len(s))
+	return scores{Recall: m.Recall / n, RR: m.RR / n, NDCG: m.NDCG / n}
+}
+
+func report(w io.Writer, setups []setup, queries []evalQuery, results [][]scores, k int) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	defer tw.Flush()
+
+	header := []string{"query"}
+	for i, s := range setups {
+		label := string(rune('A' + i))
+		fmt.Fprintf(w, "%s: %s\n", label, s.name)
+		header = append(header,
+			fmt.Sprintf("%s R@%d", label, k),
+			fmt.Sprintf("%s RR", label),
+			fmt.Sprintf("%s nDCG@%d", label, k))
+	}
+	fmt.Fprintln(w)
+	if len(setups) == 2 {
+		header = append(header, "ΔR", "ΔRR", "ΔnDCG")
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+
+	row := func(name string, per []scores) {
+		cols := []string{name}
+		for _, s := range per {
+			cols = append(cols, fmt.Sprintf("%.3f", s.Recall), fmt.Sprintf("%.3f", s.RR), fmt.Sprintf("%.3f", s.NDCG))
+		}
+		if len(per) == 2 {
+			cols = append(cols,
+				signed(per[1].Recall-per[0].Recall),
+				signed(per[1].RR-per[0].RR),
+				signed(per[1].NDCG-per[0].NDCG))
+		}
+		fmt.Fprintln(tw, strings.Join(cols, "\t"))
+	}
+	for i, q := range queries {
+		per := make([]scores, len(setups))
+		for j := range setups {
+			per[j] = results[j][i]
+		}
+		row(q.ID, per)
+	}
+	means := make([]scores, len(setups))
+	for j := range setups {
+		means[j] = mean(results[j])
+	}
+	row("MEAN", means)
+}
+
+func signed(d float64) string {
+	if math.Abs(d) < 5e-4 {
+		return "="
+	}
+	return fmt.Sprintf("%+.3f", d)
+}
@@ -3,7 +3,7 @@ package main
 import (
 	"bufio"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -12,69 +12,27 @@ import (
 	"github.com/cloudwego/eino/compose"
 	"github.com/cloudwego/eino/schema"
 	"github.com/joho/godotenv"
+	"github.com/pawarison/eino-multi-modal-poc/config"
+	"github.com/pawarison/eino-multi-modal-poc/privacy"
 	mbtiprompt "github.com/pawarison/eino-multi-modal-poc/prompt/mbti"
+	"github.com/pawarison/eino-multi-modal-poc/session"
 	"google.golang.org/genai"
 )
 
 const (
-	brandNameDefault      = "Chative Brand"
-	channelDefault        = "Online Storefront"
-	targetSegmentsDefault = "Young Professionals seeking lifestyle upgrades"
-	mbtiTypeDefault       = "EXPERT"
+	sessionIDDefault = "local"
+	userIDDefault    = "local-user"
 )
 
-func renderSystemPrompt(template string) (string, error) {
-	brandName := strings.TrimSpace(brandNameDefault)
-	channel := strings.TrimSpace(channelDefault)
-	targetSegments := strings.TrimSpace(targetSegmentsDefault)
-	mbtiType := strings.ToUpper(strings.TrimSpace(mbtiTypeDefault))
-
-	if brandName == "" || channel == "" || targetSegments == "" || mbtiType == "" {
-		return "", fmt.Errorf("system prompt configuration is incomplete")
-	}
-
-	profiles, err := loadMBTIProfiles()
-	if err != nil {
-		return "", err
-	}
-
-	mbtiDescription, ok := profiles[mbtiType]
-	if !ok {
-		return "", fmt.Errorf("mbti type %q not found in profiles", mbtiType)
-	}
-
-	replacements := map[string]string{
-		"{{BRAND_NAME}}":      brandName,
-		"{{CHANNEL}}":         channel,
-		"{{TARGET_SEGMENTS}}": targetSegments,
-		"{{MBTI_TYPE}}":       mbtiType,
-		"{{MBTI}}":            strings.TrimSpace(mbtiDescription),
-	}
-
-	result := template
-	for placeholder, value := range replacements {
-		result = strings.ReplaceAll(result, placeholder, value)
-	}
-
-	if strings.Contains(result, "{{") {
-		return "", fmt.Errorf("system prompt still contains unresolved placeholders")
-	}
-	return result, nil
-}
-
-func loadMBTIProfiles() (map[string]string, error) {
-	profiles := make(map[string]string)
-	if err := json.Unmarshal([]byte(mbtiprompt.MBTIProfilesJSON), &profiles); err != nil {
-		return nil, fmt.Errorf("parse mbti profiles: %w", err)
-	}
-	return profiles, nil
-}
-
 func main() {
 	_ = godotenv.Load()
 
-	template := strings.TrimSpace(mbtiprompt.SystemPromptTemplate)
-	systemPrompt, err := renderSystemPrompt(template)
+	promptCfg, err := config.New[mbtiprompt.Config]("")
+	if err != nil {
+		fmt.Println("failed to load system prompt config:", err)
+		return
+	}
+	systemPrompt, err := mbtiprompt.RenderSystemPrompt(promptCfg)
 	if err != nil {
 		fmt.Println("failed to load system prompt:", err)
 		return
@@ -141,7 +99,48 @@ func main() {
 		return
 	}
 
+	sessionCfg, err := config.New[session.Config]("")
+	if err != nil {
+		fmt.Println("failed to load session config:", err)
+		return
+	}
+	store, err := session.NewStore(sessionCfg)
+	if err != nil {
+		fmt.Println("failed to open session store:", err)
+		return
+	}
+	sessionID := strings.TrimSpace(os.Getenv("CHAT_SESSION_ID"))
+	if sessionID == "" {
+		sessionID = sessionIDDefault
+	}
+	newSession := func() *session.Session {
+		return session.New(sessionID, userIDDefault)
+	}
+
+	sess, err := store.Get(ctx, sessionID)
+	if errors.Is(err, session.ErrNotFound) {
+		sess, err = newSession(), nil
+	}
+	if err != nil {
+		fmt.Println("failed to load session:", err)
+		return
+	}
+
+	// Always start from the current system prompt, then replay the stored turns
 	history := []*schema.Message{schema.SystemMessage(systemPrompt)}
+	for _, msg := range sess.History {
+		if msg != nil && msg.Role != schema.System {
+			history = append(history, msg)
+		}
+	}
+	if len(history) > 1 {
+		fmt.Printf("Resumed session %s with %d messages\n", sessionID, len(history)-1)
+	}
+
+	// PII is swapped for placeholders before it reaches the model and restored for display
+	// The vault stays in this process only; it is not saved with the session
+	redactor := privacy.NewRedactor()
+	vault := session.NewVaults(sessionCfg.TTL).Attach(sess)
 
 	reader := bufio.NewReader(os.Stdin)
 	fmt.Println("Eino PoC Chatbot (พิมพ์ 'exit' เพื่อออก)")
@@ -160,7 +159,7 @@ func main() {
 			break
 		}
 
-		userMsg := schema.UserMessage(line)
+		userMsg := schema.UserMessage(redactor.Redact(line, vault))
 		history = append(history, userMsg)
 
 		input := make([]*schema.Message, len(history))
@@ -174,7 +173,17 @@ func main() {
 		}
 
 		history = append(history, out)
-		fmt.Println("Bot:", strings.TrimSpace(out.Content))
+		fmt.Println("Bot:", strings.TrimSpace(vault.Restore(out.Content)))
+
+		saved, saveErr := session.Update(ctx, store, sessionID, newSession, func(s *session.Session) error {
+			s.History = append(s.History, userMsg, out)
+			return nil
+		})
+		if saveErr != nil {
+			fmt.Println("failed to save session:", saveErr)
+		} else {
+			history = append([]*schema.Message{history[0]}, saved.History...)
+		}
 
 		if meta := out.ResponseMeta; meta != nil && meta.Usage != nil {
 			usage := meta.Usage
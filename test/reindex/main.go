@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/pawarison/eino-multi-modal-poc/articles"
+	"github.com/pawarison/eino-multi-modal-poc/config"
+	"github.com/pawarison/eino-multi-modal-poc/dataset"
+	"github.com/pawarison/eino-multi-modal-poc/ingest"
+	"github.com/pawarison/eino-multi-modal-poc/reindex"
+	"github.com/pawarison/eino-multi-modal-poc/tools"
+	"github.com/pawarison/eino-multi-modal-poc/vectorstore"
+)
+
+const defaultDatasetPath = "data/medium_articles_2020_dpr_a13e0377ae.json"
+
+// Reindexes behind the MILVUS_COLLECTION alias:
+//
+//	go run ./test/reindex                        # new version, validate, switch
+//	go run ./test/reindex -version articles_v... # resume an interrupted version
+//	go run ./test/reindex -list
+//	go run ./test/reindex -rollback [-version articles_v...]
+//	go run ./test/reindex -adopt                 # move an existing collection behind the alias
+func main() {
+	_ = godotenv.Load()
+	datasetPath := flag.String("dataset", defaultDatasetPath, "JSON, JSONL or CSV dataset")
+	mappingPath := flag.String("mapping", "", "JSON field mapping of the dataset; empty uses the Medium articles mapping")
+	version := flag.String("version", "", "version to resume, or to roll back to")
+	list := flag.Bool("list", false, "list versions and exit")
+	rollback := flag.Bool("rollback", false, "point the alias at -version, or at the previous version")
+	adopt := flag.Bool("adopt", false, "rename the collection named MILVUS_COLLECTION to a version and alias it, then exit")
+	flag.Parse()
+
+	if err := run(*datasetPath, *mappingPath, *version, *list, *rollback, *adopt); err != nil {
+		log.Printf("reindex stopped: %v", err)
+		os.Exit(1)
+	}
+}
+
+func run(datasetPath, mappingPath, version string, list, rollback, adopt bool) error {
+	ctx := context.Background()
+	mapping, err := loadMapping(mappingPath)
+	if err != nil {
+		return err
+	}
+	clientsCfg, err := config.New[tools.ClientsConfig]("")
+	if err != nil {
+		return fmt.Errorf("load clients config: %w", err)
+	}
+	ingestCfg, err := config.New[ingest.Config]("")
+	if err != nil {
+		return fmt.Errorf("load ingest config: %w", err)
+	}
+	reindexCfg, err := config.New[reindex.Config]("")
+	if err != nil {
+		return fmt.Errorf("load reindex config: %w", err)
+	}
+
+	clients, err := tools.NewClients(ctx, clientsCfg)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		closeCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := clients.Close(closeCtx); err != nil {
+			log.Printf("failed to close clients: %v", err)
+		}
+	}()
+
+	reindexer, err := reindex.New(reindexCfg, ingestCfg, mapping, clients.DocumentEmbedder, clients.QueryEmbedder, vectorstore.NewMilvus(clients.Milvus))
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case list:
+		versions, current, err := reindexer.Versions(ctx)
+		if err != nil {
+			return err
+		}
+		for _, v := range versions {
+			marker := " "
+			if v == current {
+				marker = "*"
+			}
+			fmt.Printf("%s %s\n", marker, v)
+		}
+		return nil
+	case rollback:
+		from, to, err := reindexer.Rollback(ctx, version)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("alias %s: %s -> %s\n", reindexer.Alias(), from, to)
+		return nil
+	case adopt:
+		adopted, err := reindexer.Adopt(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("alias %s: created for %s\n", reindexer.Alias(), adopted)
+		return nil
+	}
+
+	rows, err := dataset.Load(datasetPath, mapping)
+	if err != nil {
+		return err
+	}
+	log.Printf("dataset rows: %d", len(rows))
+	report, err := reindexer.Run(ctx, rows, version)
+	fmt.Println(report)
+	if err != nil && report.Version != "" && !report.Switched {
+		log.Printf("version %s was kept; rerun with -version %s to resume", report.Version, report.Version)
+	}
+	return err
+}
+
+// loadMapping reads the mapping at path, or returns the Medium articles mapping.
+func loadMapping(path string) (dataset.Mapping, error) {
+	if path == "" {
+		return articles.Mapping(), nil
+	}
+	m, err := dataset.LoadMapping(path)
+	if err != nil {
+		return dataset.Mapping{}, err
+	}
+	return *m, nil
+}
@@ -2,40 +2,41 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 
-	geminiembed "github.com/cloudwego/eino-ext/components/embedding/gemini"
+	"github.com/cloudwego/eino/components/embedding"
 	"github.com/joho/godotenv"
-	"github.com/milvus-io/milvus/client/v2/column"
-	"github.com/milvus-io/milvus/client/v2/entity"
 	"github.com/milvus-io/milvus/client/v2/milvusclient"
+	"github.com/pawarison/eino-multi-modal-poc/articles"
+	"github.com/pawarison/eino-multi-modal-poc/config"
+	"github.com/pawarison/eino-multi-modal-poc/embedder"
+	"github.com/pawarison/eino-multi-modal-poc/vectorstore"
 	"google.golang.org/genai"
 )
 
 const (
-	collectionName        = "articles"
-	vectorField           = "title_vector"
-	defaultEmbeddingModel = "gemini-embedding-001"
-	defaultTopK           = 5
-	defaultQueryText      = "How do I use NLP with Python?" // Example query
+	collectionName   = "articles"
+	vectorField      = "title_vector"
+	defaultTopK      = 5
+	defaultQueryText = "How do I use NLP with Python?" // Example query
+	datasetPath      = "data/medium_articles_2020_dpr_a13e0377ae.json"
 )
 
 func main() {
 	_ = godotenv.Load()
+	inMemory := flag.Bool("memory", false, "embed the dataset into an in-memory store instead of searching Milvus")
+	flag.Parse()
+
 	apiKey := os.Getenv("GEMINI_API_KEY")
 	if apiKey == "" {
 		log.Fatal("missing GEMINI_API_KEY")
 	}
 
-	addr := os.Getenv("MILVUS_ADDR")
-	if addr == "" {
-		log.Fatal("missing MILVUS_ADDR")
-	}
-	username := os.Getenv("MILVUS_USERNAME")
-	password := os.Getenv("MILVUS_PASSWORD")
-
 	ctx := context.Background()
 
 	genaiClient, err := genai.NewClient(ctx, &genai.ClientConfig{
@@ -46,161 +47,146 @@ func main() {
 		log.Fatal(err)
 	}
 
-	embedder, err := geminiembed.NewEmbedder(ctx, &geminiembed.EmbeddingConfig{
-		Client: genaiClient,
-		Model:  defaultEmbeddingModel,
-	})
+	embeddingCfg, err := config.New[embedder.Config]("EMBEDDING")
 	if err != nil {
-		log.Fatal(err)
+		log.Fatalf("load embedding config: %v", err)
 	}
-
-	cli, err := milvusclient.New(ctx, &milvusclient.ClientConfig{
-		Address:  addr,
-		Username: username,
-		Password: password,
-	})
+	queryEmbedder, err := embedder.NewQuery(ctx, genaiClient, *embeddingCfg)
 	if err != nil {
-		log.Fatalf("create milvus client: %v", err)
+		log.Fatal(err)
 	}
-	defer func() {
-		if closeErr := cli.Close(ctx); closeErr != nil {
-			log.Printf("failed to close milvus client: %v", closeErr)
+
+	var store vectorstore.Store
+	if *inMemory {
+		documents, err := embedder.NewDocument(ctx, genaiClient, *embeddingCfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		mem := vectorstore.NewMemory()
+		if err := loadDataset(ctx, mem, documents); err != nil {
+			log.Fatalf("load dataset into memory: %v", err)
+		}
+		store = mem
+	} else {
+		addr := os.Getenv("MILVUS_ADDR")
+		if addr == "" {
+			log.Fatal("missing MILVUS_ADDR")
 		}
-	}()
+		cli, err := milvusclient.New(ctx, &milvusclient.ClientConfig{
+			Address:  addr,
+			Username: os.Getenv("MILVUS_USERNAME"),
+			Password: os.Getenv("MILVUS_PASSWORD"),
+		})
+		if err != nil {
+			log.Fatalf("create milvus client: %v", err)
+		}
+		defer func() {
+			if closeErr := cli.Close(ctx); closeErr != nil {
+				log.Printf("failed to close milvus client: %v", closeErr)
+			}
+		}()
+		store = vectorstore.NewMilvus(cli)
 
-	// Ensure the collection is loaded for search
-	loadTask, err := cli.LoadCollection(ctx, milvusclient.NewLoadCollectionOption(collectionName))
-	if err != nil {
-		log.Fatalf("load collection %s: %v", collectionName, err)
-	}
-	if err := loadTask.Await(ctx); err != nil {
-		log.Fatalf("await collection load: %v", err)
+		// Ensure the collection is loaded for search
+		if err := store.EnsureCollection(ctx, articles.CollectionSpec(collectionName, vectorField, 0)); err != nil {
+			log.Fatal(err)
+		}
+		existing, err := store.Describe(ctx, collectionName)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := embeddingCfg.Check(existing); err != nil {
+			log.Fatal(err)
+		}
 	}
 
 	queryText := defaultQueryText
 	log.Printf("using query: %q", queryText)
 
-	embeddings, err := embedder.EmbedStrings(ctx, []string{queryText})
+	queryVector, err := embedOne(ctx, queryEmbedder, queryText)
 	if err != nil {
 		log.Fatalf("embed query: %v", err)
 	}
-	if len(embeddings) == 0 || len(embeddings[0]) == 0 {
-		log.Fatal("embed query: empty embedding returned")
-	}
 
-	queryVector := make([]float32, len(embeddings[0]))
-	for i, v := range embeddings[0] {
-		queryVector[i] = float32(v)
-	}
-
-	searchOpt := milvusclient.NewSearchOption(collectionName, defaultTopK, []entity.Vector{entity.FloatVector(queryVector)}).
-		WithANNSField(vectorField).
-		WithOutputFields("title", "link", "publication", "reading_time", "claps", "responses").
-		WithSearchParam("metric_type", string(entity.COSINE)).
-		WithSearchParam("params", "{\"nprobe\": 10}")
-
-	resultSets, err := cli.Search(ctx, searchOpt)
+	hits, err := store.Search(ctx, collectionName, vectorstore.SearchRequest{Vector: queryVector, TopK: defaultTopK})
 	if err != nil {
 		log.Fatalf("search collection: %v", err)
 	}
-
-	if len(resultSets) == 0 {
+	if len(hits) == 0 {
 		log.Println("no results returned from search")
 		return
 	}
 
-	for queryIdx, rs := range resultSets {
-		if rs.ResultCount == 0 {
-			log.Printf("query %d: no hits", queryIdx)
-			continue
-		}
-
-		titleCol := rs.GetColumn("title")
-		linkCol := rs.GetColumn("link")
-		publicationCol := rs.GetColumn("publication")
-		readingTimeCol := rs.GetColumn("reading_time")
-		clapsCol := rs.GetColumn("claps")
-		responsesCol := rs.GetColumn("responses")
-
-		for idx := 0; idx < rs.ResultCount; idx++ {
-			idVal, err := rs.IDs.Get(idx)
-			if err != nil {
-				log.Printf("query %d result %d: get id: %v", queryIdx, idx, err)
-				continue
-			}
-
-			title, err := valueAsString(titleCol, idx)
-			if err != nil {
-				log.Printf("query %d result %d: title decode: %v", queryIdx, idx, err)
-			}
-
-			link, err := valueAsString(linkCol, idx)
-			if err != nil {
-				log.Printf("query %d result %d: link decode: %v", queryIdx, idx, err)
-			}
-
-			publication, err := valueAsString(publicationCol, idx)
-			if err != nil {
-				log.Printf("query %d result %d: publication decode: %v", queryIdx, idx, err)
-			}
-
-			readingTime, err := valueAsInt(readingTimeCol, idx)
-			if err != nil {
-				log.Printf("query %d result %d: reading_time decode: %v", queryIdx, idx, err)
-			}
+	for idx, h := range hits {
+		a := articles.FromHit(h)
+		fmt.Printf("#%d id=%v score=%.4f\n", idx+1, a.ID, h.Score)
+		fmt.Printf("  title: %s\n", a.Title)
+		fmt.Printf("  publication: %s | reading_time=%dmin | claps=%d | responses=%d\n", a.Publication, a.ReadingTime, a.Claps, a.Responses)
+		fmt.Printf("  link: %s\n\n", a.Link)
+	}
+}
 
-			claps, err := valueAsInt(clapsCol, idx)
-			if err != nil {
-				log.Printf("query %d result %d: claps decode: %v", queryIdx, idx, err)
-			}
+// loadDataset embeds every title of the dataset into an in-memory collection.
+func loadDataset(ctx context.Context, store vectorstore.Store, documents embedding.Embedder) error {
+	f, err := os.Open(filepath.Clean(datasetPath))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var payload struct {
+		Rows []articles.Article `json:"rows"`
+	}
+	if err := json.NewDecoder(f).Decode(&payload); err != nil {
+		return fmt.Errorf("decode dataset: %w", err)
+	}
 
-			responses, err := valueAsInt(responsesCol, idx)
-			if err != nil {
-				log.Printf("query %d result %d: responses decode: %v", queryIdx, idx, err)
+	// Gemini Embed API limits batch size to <=100 items per request.
+	const batchSize = 100
+	for start := 0; start < len(payload.Rows); start += batchSize {
+		end := min(start+batchSize, len(payload.Rows))
+		batch := payload.Rows[start:end]
+		titles := make([]string, len(batch))
+		for i, r := range batch {
+			titles[i] = r.Title
+		}
+		embeddings, err := documents.EmbedStrings(ctx, titles)
+		if err != nil {
+			return fmt.Errorf("embed batch %d-%d: %w", start, end, err)
+		}
+		if len(embeddings) != len(batch) || len(embeddings[0]) == 0 {
+			return fmt.Errorf("embed batch %d-%d: got %d embeddings for %d titles", start, end, len(embeddings), len(batch))
+		}
+		if start == 0 {
+			if err := store.EnsureCollection(ctx, articles.CollectionSpec(collectionName, vectorField, len(embeddings[0]))); err != nil {
+				return err
 			}
-
-			score := float64(rs.Scores[idx])
-
-			fmt.Printf("#%d id=%v score=%.4f\n", idx+1, idVal, score)
-			fmt.Printf("  title: %s\n", title)
-			fmt.Printf("  publication: %s | reading_time=%dmin | claps=%d | responses=%d\n", publication, readingTime, claps, responses)
-			fmt.Printf("  link: %s\n\n", link)
+		}
+		docs := make([]vectorstore.Document, len(batch))
+		for i, r := range batch {
+			docs[i] = r.Document(toFloat32(embeddings[i]))
+		}
+		if err := store.Upsert(ctx, collectionName, docs); err != nil {
+			return fmt.Errorf("upsert batch %d-%d: %w", start, end, err)
 		}
 	}
-
+	return nil
 }
 
-func valueAsString(col column.Column, idx int) (string, error) {
-	if col == nil {
-		return "", nil
-	}
-	val, err := col.Get(idx)
+func embedOne(ctx context.Context, queryEmbedder embedding.Embedder, text string) ([]float32, error) {
+	embeddings, err := queryEmbedder.EmbedStrings(ctx, []string{text})
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	s, ok := val.(string)
-	if !ok {
-		return fmt.Sprintf("%v", val), nil
+	if len(embeddings) == 0 || len(embeddings[0]) == 0 {
+		return nil, fmt.Errorf("empty embedding returned")
 	}
-	return s, nil
+	return toFloat32(embeddings[0]), nil
 }
 
-func valueAsInt(col column.Column, idx int) (int, error) {
-	if col == nil {
-		return 0, nil
-	}
-	val, err := col.Get(idx)
-	if err != nil {
-		return 0, err
-	}
-	switch v := val.(type) {
-	case int32:
-		return int(v), nil
-	case int64:
-		return int(v), nil
-	case int:
-		return v, nil
-	default:
-		return 0, fmt.Errorf("unexpected type %T", val)
+func toFloat32(v []float64) []float32 {
+	out := make([]float32, len(v))
+	for i, x := range v {
+		out[i] = float32(x)
 	}
+	return out
 }
@@ -0,0 +1,142 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/cloudwego/eino/components/embedding"
+	"github.com/milvus-io/milvus/client/v2/milvusclient"
+	"github.com/pawarison/eino-multi-modal-poc/embedcache"
+	"github.com/pawarison/eino-multi-modal-poc/embedder"
+	"google.golang.org/genai"
+)
+
+// ClientsConfig holds the connection settings of the retrieval backends.
+type ClientsConfig struct {
+	GeminiAPIKey   string          `envconfig:"GEMINI_API_KEY" required:"true"`
+	GeminiBaseURL  string          `envconfig:"GEMINI_BASE_URL"`
+	Embedding      embedder.Config `envconfig:"EMBEDDING"`
+	MilvusAddr     string          `envconfig:"MILVUS_ADDR" required:"true"`
+	MilvusUsername string          `envconfig:"MILVUS_USERNAME"`
+	MilvusPassword string          `envconfig:"MILVUS_PASSWORD"`
+	// EmbeddingCachePath is the on-disk embedding cache. Empty disables it.
+	// Only one process can use a cache file at a time, so {program} is
+	// replaced by the executable name to give each binary its own file.
+	EmbeddingCachePath string `envconfig:"EMBED_CACHE_PATH" default:".cache/embeddings-{program}.db"`
+}
+
+// Clients are the long-lived embedding and Milvus clients shared by the tools.
+// Create them once at startup and Close them on shutdown.
+type Clients struct {
+	GenAI *genai.Client
+	// DocumentEmbedder and QueryEmbedder use the document and query task
+	// types. They go through DocumentCache and QueryCache when the cache is enabled.
+	DocumentEmbedder embedding.Embedder
+	QueryEmbedder    embedding.Embedder
+	DocumentCache    *embedcache.Embedder
+	QueryCache       *embedcache.Embedder
+	Milvus           *milvusclient.Client
+
+	cacheStore *embedcache.Store
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// NewClients connects to Gemini and Milvus.
+func NewClients(ctx context.Context, cfg *ClientsConfig) (*Clients, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("clients config is nil")
+	}
+	genaiCfg := &genai.ClientConfig{
+		APIKey:  cfg.GeminiAPIKey,
+		Backend: genai.BackendGeminiAPI,
+	}
+	if cfg.GeminiBaseURL != "" {
+		genaiCfg.HTTPOptions.BaseURL = cfg.GeminiBaseURL
+	}
+	genaiClient, err := genai.NewClient(ctx, genaiCfg)
+	if err != nil {
+		return nil, fmt.Errorf("create genai client: %w", err)
+	}
+
+	documents, err := embedder.NewDocument(ctx, genaiClient, cfg.Embedding)
+	if err != nil {
+		return nil, err
+	}
+	queries, err := embedder.NewQuery(ctx, genaiClient, cfg.Embedding)
+	if err != nil {
+		return nil, err
+	}
+	c := &Clients{GenAI: genaiClient, DocumentEmbedder: documents, QueryEmbedder: queries}
+	if cfg.EmbeddingCachePath != "" {
+		c.cacheStore, err = embedcache.Open(cachePath(cfg.EmbeddingCachePath))
+		if err != nil {
+			return nil, err
+		}
+		c.DocumentCache = c.cacheStore.Wrap(documents, embedcache.Options{
+			Model:     cfg.Embedding.Model,
+			TaskType:  cfg.Embedding.DocumentTaskType,
+			Dimension: cfg.Embedding.Dimension,
+		})
+		c.QueryCache = c.cacheStore.Wrap(queries, embedcache.Options{
+			Model:     cfg.Embedding.Model,
+			TaskType:  cfg.Embedding.QueryTaskType,
+			Dimension: cfg.Embedding.Dimension,
+			// queries are embedded on the request path
+			WriteBehind: true,
+		})
+		c.DocumentEmbedder, c.QueryEmbedder = c.DocumentCache, c.QueryCache
+	}
+
+	milvusClient, err := milvusclient.New(ctx, &milvusclient.ClientConfig{
+		Address:  cfg.MilvusAddr,
+		Username: cfg.MilvusUsername,
+		Password: cfg.MilvusPassword,
+	})
+	if err != nil {
+		if c.cacheStore != nil {
+			c.cacheStore.Close()
+		}
+		return nil, fmt.Errorf("create milvus client: %w", err)
+	}
+	c.Milvus = milvusClient
+	return c, nil
+}
+
+// Close releases the Milvus connection and the embedding cache. It returns
+// ctx.Err() if ctx is done before the connection is closed. Later calls
+// return the first result.
+func (c *Clients) Close(ctx context.Context) error {
+	c.closeOnce.Do(func() {
+		var errs []error
+		if c.cacheStore != nil {
+			if err := c.cacheStore.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("close embedding cache: %w", err))
+			}
+		}
+		done := make(chan error, 1)
+		go func() { done <- c.Milvus.Close(ctx) }()
+		select {
+		case err := <-done:
+			if err != nil {
+				errs = append(errs, fmt.Errorf("close milvus client: %w", err))
+			}
+		case <-ctx.Done():
+			errs = append(errs, fmt.Errorf("close milvus client: %w", ctx.Err()))
+		}
+		c.closeErr = errors.Join(errs...)
+	})
+	return c.closeErr
+}
+
+// cachePath expands {program} in an embedding cache path.
+func cachePath(path string) string {
+	program := strings.TrimSuffix(filepath.Base(os.Args[0]), filepath.Ext(os.Args[0]))
+	return strings.ReplaceAll(path, "{program}", program)
+}
@@ -1,6 +1,17 @@
 package tools
 
-// // Tool constants - these should match the actual tool names defined in the tool files
-// const (
-// 	ToolSearchArticles = "search_articles"
-// )
+// Tool constants - these should match the actual tool names defined in the tool files
+const (
+	ToolSearchArticles    = "search_articles"
+	ToolRecommendArticles = "recommend_articles"
+)
+
+// defaultIntentTools is the tool exposure of an intent that has neither
+// Registry.SetIntentTools nor NLU_TOOLS_<INTENT>. Intents not listed here get
+// every registered tool.
+var defaultIntentTools = map[string][]string{
+	"inquiry_intent":  {ToolSearchArticles, ToolRecommendArticles},
+	"purchase_intent": {ToolSearchArticles, ToolRecommendArticles},
+	"compare_product": {ToolSearchArticles},
+	"greet":           {},
+}
@@ -0,0 +1,108 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/components/tool/utils"
+	"github.com/cloudwego/eino/schema"
+	"github.com/pawarison/eino-multi-modal-poc/retrieval"
+)
+
+// RecommendArticlesInput names the articles to find similar ones for.
+// Unset filters do not restrict the results.
+type RecommendArticlesInput struct {
+	// IDs are article ids as returned by search_articles.
+	IDs  []string `json:"ids"`
+	TopK int      `json:"top_k,omitempty"`
+	ArticleFilterInput
+}
+
+// RecommendArticlesOutput lists the recommended articles; the given articles
+// are never among them.
+type RecommendArticlesOutput struct {
+	Articles []ArticleSearchResult `json:"articles"`
+	Total    int                   `json:"total"`
+}
+
+// articleRecommender runs recommendations with clients that outlive the tool calls.
+type articleRecommender struct {
+	cfg      SearchArticlesConfig
+	searcher *retrieval.Searcher
+	reranker *retrieval.Reranker
+}
+
+// NewRecommendArticlesTool builds the recommend_articles tool on the searcher
+// and optional reranker of search_articles, sharing its top k limits.
+func NewRecommendArticlesTool(cfg *SearchArticlesConfig, searcher *retrieval.Searcher, reranker *retrieval.Reranker) (tool.InvokableTool, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("search articles config is nil")
+	}
+	if searcher == nil {
+		return nil, fmt.Errorf("searcher is nil")
+	}
+	if cfg.DefaultTopK <= 0 || cfg.MaxTopK < cfg.DefaultTopK {
+		return nil, fmt.Errorf("invalid top k: default %d, max %d", cfg.DefaultTopK, cfg.MaxTopK)
+	}
+
+	r := &articleRecommender{cfg: *cfg, searcher: searcher, reranker: reranker}
+	return utils.NewTool(
+		&schema.ToolInfo{
+			Name: ToolRecommendArticles,
+			Desc: "Find articles similar to ones the user liked (\"more like this\"). Provide the ids of one or more articles, for example from search_articles; those articles are left out of the results.",
+			ParamsOneOf: schema.NewParamsOneOfByParams(withFilterParams(map[string]*schema.ParameterInfo{
+				"ids": {
+					Type:     "array",
+					Desc:     fmt.Sprintf("Ids of the articles to find similar ones for (at most %d).", retrieval.MaxRecommendSeeds),
+					ElemInfo: &schema.ParameterInfo{Type: "string"},
+					Required: true,
+				},
+				"top_k": {
+					Type: "number",
+					Desc: fmt.Sprintf("Maximum number of articles to return (default: %d, max: %d).", cfg.DefaultTopK, cfg.MaxTopK),
+				},
+			})),
+		},
+		r.recommend,
+	), nil
+}
+
+func (r *articleRecommender) recommend(ctx context.Context, in *RecommendArticlesInput) (*RecommendArticlesOutput, error) {
+	if len(in.IDs) == 0 {
+		return nil, fmt.Errorf("ids are required")
+	}
+	ids := make([]int64, len(in.IDs))
+	for i, s := range in.IDs {
+		id, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid article id %q", s)
+		}
+		ids[i] = id
+	}
+
+	topK := r.cfg.topK(in.TopK)
+	depth := topK
+	if r.reranker != nil {
+		depth = r.reranker.Depth(topK)
+	}
+	rec, err := r.searcher.Recommend(ctx, retrieval.RecommendRequest{IDs: ids, TopK: depth, Filter: in.Filter()})
+	if err != nil {
+		return nil, fmt.Errorf("recommend articles: %w", err)
+	}
+	hits := rec.Hits
+	if r.reranker != nil {
+		hits, err = r.reranker.Rerank(ctx, rec.Query(), hits, topK)
+		if err != nil {
+			return nil, fmt.Errorf("rerank articles: %w", err)
+		}
+	}
+
+	results := articleResults(hits)
+	return &RecommendArticlesOutput{
+		Articles: results,
+		Total:    len(results),
+	}, nil
+}
@@ -0,0 +1,210 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+)
+
+// SideEffect classifies what a tool may change, so callers can decide which
+// tools need confirmation or must never be retried.
+type SideEffect string
+
+const (
+	// SideEffectReadOnly tools only read data and are safe to retry.
+	SideEffectReadOnly SideEffect = "read_only"
+	// SideEffectWrite tools change data owned by this service.
+	SideEffectWrite SideEffect = "write"
+	// SideEffectExternal tools act on external systems (orders, payments, messages).
+	SideEffectExternal SideEffect = "external"
+)
+
+// defaultToolTimeout applies when a tool is registered without a timeout.
+const defaultToolTimeout = 10 * time.Second
+
+// Spec describes a tool to register. Name, description and input schema come
+// from the tool's ToolInfo.
+type Spec struct {
+	Tool       tool.InvokableTool
+	Timeout    time.Duration
+	SideEffect SideEffect
+}
+
+// Entry is a registered tool and its metadata.
+type Entry struct {
+	Name       string
+	Info       *schema.ToolInfo
+	Timeout    time.Duration
+	SideEffect SideEffect
+	tool       tool.InvokableTool
+}
+
+// Registry is a name-keyed set of tools with per-intent exposure rules.
+type Registry struct {
+	mu          sync.RWMutex
+	entries     map[string]*Entry
+	intentTools map[string][]string
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		entries:     map[string]*Entry{},
+		intentTools: map[string][]string{},
+	}
+}
+
+// Register adds a tool under the name in its ToolInfo. Registering a name twice is an error.
+func (r *Registry) Register(ctx context.Context, spec Spec) error {
+	if spec.Tool == nil {
+		return fmt.Errorf("tool is nil")
+	}
+	info, err := spec.Tool.Info(ctx)
+	if err != nil {
+		return fmt.Errorf("get tool info: %w", err)
+	}
+	if info == nil || strings.TrimSpace(info.Name) == "" {
+		return fmt.Errorf("tool info has no name")
+	}
+	if spec.Timeout <= 0 {
+		spec.Timeout = defaultToolTimeout
+	}
+	if spec.SideEffect == "" {
+		spec.SideEffect = SideEffectReadOnly
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.entries[info.Name]; exists {
+		return fmt.Errorf("tool %s already registered", info.Name)
+	}
+	r.entries[info.Name] = &Entry{
+		Name:       info.Name,
+		Info:       info,
+		Timeout:    spec.Timeout,
+		SideEffect: spec.SideEffect,
+		tool:       spec.Tool,
+	}
+	return nil
+}
+
+// Lookup returns the named tool wrapped with its timeout.
+func (r *Registry) Lookup(name string) (tool.InvokableTool, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	e, ok := r.entries[name]
+	if !ok {
+		return nil, false
+	}
+	return &timeoutTool{InvokableTool: e.tool, timeout: e.Timeout}, true
+}
+
+// Entry returns the metadata of the named tool.
+func (r *Registry) Entry(name string) (Entry, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	e, ok := r.entries[name]
+	if !ok {
+		return Entry{}, false
+	}
+	return *e, true
+}
+
+// List returns all entries sorted by name.
+func (r *Registry) List() []Entry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]Entry, 0, len(r.entries))
+	for _, e := range r.entries {
+		out = append(out, *e)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// SetIntentTools limits the tools exposed for intentName. It overrides
+// NLU_TOOLS_<INTENT> and the built-in default for that intent.
+func (r *Registry) SetIntentTools(intentName string, names ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.intentTools[intentName] = append([]string{}, names...)
+}
+
+// ToolsForIntent returns the tools exposed for intentName, wrapped with their
+// timeouts. The limit comes from SetIntentTools, then NLU_TOOLS_<INTENT>, then
+// the built-in default of the intent; without any every registered tool is exposed.
+func (r *Registry) ToolsForIntent(intentName string) []tool.BaseTool {
+	names, limited := r.allowedNames(intentName)
+	if !limited {
+		for _, e := range r.List() {
+			names = append(names, e.Name)
+		}
+	}
+	out := make([]tool.BaseTool, 0, len(names))
+	for _, name := range names {
+		if t, ok := r.Lookup(name); ok {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// ToolInfosForIntent returns the ToolInfos to bind to a chat model for intentName.
+func (r *Registry) ToolInfosForIntent(ctx context.Context, intentName string) ([]*schema.ToolInfo, error) {
+	return GetToolInfos(ctx, r.ToolsForIntent(intentName))
+}
+
+func (r *Registry) allowedNames(intentName string) ([]string, bool) {
+	r.mu.RLock()
+	names, ok := r.intentTools[intentName]
+	r.mu.RUnlock()
+	if ok {
+		return append([]string{}, names...), true
+	}
+	if names, ok := ToolNamesForIntent(intentName); ok {
+		return names, true
+	}
+	names, ok = defaultIntentTools[intentName]
+	return append([]string{}, names...), ok
+}
+
+// ToolNamesForIntent reads the tool allow-list for a given intent from environment variables.
+// Looks up NLU_TOOLS_<INTENT_NAME_IN_UPPER_SNAKE> and splits comma-separated values.
+// The second result is false when the variable is unset, meaning no limit.
+func ToolNamesForIntent(intentName string) ([]string, bool) {
+	if intentName == "" {
+		return nil, false
+	}
+	replacer := strings.NewReplacer(" ", "_", "-", "_")
+	envKey := "NLU_TOOLS_" + strings.ToUpper(replacer.Replace(strings.TrimSpace(intentName)))
+	value, ok := os.LookupEnv(envKey)
+	if !ok {
+		return nil, false
+	}
+	var names []string
+	for _, part := range strings.Split(value, ",") {
+		if trimmed := strings.TrimSpace(part); trimmed != "" {
+			names = append(names, trimmed)
+		}
+	}
+	return names, true
+}
+
+// timeoutTool bounds each call of the wrapped tool.
+type timeoutTool struct {
+	tool.InvokableTool
+	timeout time.Duration
+}
+
+func (t *timeoutTool) InvokableRun(ctx context.Context, argumentsInJSON string, opts ...tool.Option) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return t.InvokableTool.InvokableRun(ctx, argumentsInJSON, opts...)
+}
@@ -0,0 +1,110 @@
+package tools
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/schema"
+)
+
+// stubTool answers every call with its name, after an optional delay.
+type stubTool struct {
+	name  string
+	delay time.Duration
+}
+
+func (s stubTool) Info(ctx context.Context) (*schema.ToolInfo, error) {
+	return &schema.ToolInfo{Name: s.name, Desc: s.name}, nil
+}
+
+func (s stubTool) InvokableRun(ctx context.Context, args string, opts ...tool.Option) (string, error) {
+	select {
+	case <-time.After(s.delay):
+		return s.name, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func testRegistry(t *testing.T, names ...string) *Registry {
+	t.Helper()
+	r := NewRegistry()
+	for _, name := range names {
+		if err := r.Register(context.Background(), Spec{Tool: stubTool{name: name}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return r
+}
+
+func exposed(t *testing.T, r *Registry, intentName string) []string {
+	t.Helper()
+	infos, err := r.ToolInfosForIntent(context.Background(), intentName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, info := range infos {
+		names = append(names, info.Name)
+	}
+	return names
+}
+
+func TestToolsForIntent(t *testing.T) {
+	tests := []struct {
+		name   string
+		intent string
+		env    map[string]string
+		set    []string
+		want   []string
+	}{
+		{"default mapping", "inquiry_intent", nil, nil, []string{ToolSearchArticles, ToolRecommendArticles}},
+		{"default without tools", "greet", nil, nil, []string{}},
+		{"unmapped intent gets everything", "support_intent", nil, nil, []string{"create_ticket", ToolRecommendArticles, ToolSearchArticles}},
+		{"no intent gets everything", "", nil, nil, []string{"create_ticket", ToolRecommendArticles, ToolSearchArticles}},
+		{"env overrides the default", "inquiry_intent", map[string]string{"NLU_TOOLS_INQUIRY_INTENT": "search_articles"}, nil, []string{ToolSearchArticles}},
+		{"empty env exposes nothing", "inquiry_intent", map[string]string{"NLU_TOOLS_INQUIRY_INTENT": ""}, nil, []string{}},
+		{"SetIntentTools overrides env", "inquiry_intent", map[string]string{"NLU_TOOLS_INQUIRY_INTENT": "search_articles"}, []string{"create_ticket"}, []string{"create_ticket"}},
+		{"unknown names are skipped", "support_intent", map[string]string{"NLU_TOOLS_SUPPORT_INTENT": "missing,create_ticket"}, nil, []string{"create_ticket"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			r := testRegistry(t, ToolSearchArticles, ToolRecommendArticles, "create_ticket")
+			if tt.set != nil {
+				r.SetIntentTools(tt.intent, tt.set...)
+			}
+			if got := exposed(t, r, tt.intent); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("exposed = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegistryRegister(t *testing.T) {
+	r := testRegistry(t, ToolSearchArticles)
+	if err := r.Register(context.Background(), Spec{Tool: stubTool{name: ToolSearchArticles}}); err == nil {
+		t.Error("registered a name twice")
+	}
+	e, ok := r.Entry(ToolSearchArticles)
+	if !ok || e.Timeout != defaultToolTimeout || e.SideEffect != SideEffectReadOnly {
+		t.Errorf("entry = %+v, want the default timeout and read-only", e)
+	}
+}
+
+func TestLookupAppliesTimeout(t *testing.T) {
+	r := NewRegistry()
+	spec := Spec{Tool: stubTool{name: "slow", delay: time.Second}, Timeout: 10 * time.Millisecond}
+	if err := r.Register(context.Background(), spec); err != nil {
+		t.Fatal(err)
+	}
+	slow, _ := r.Lookup("slow")
+	if _, err := slow.InvokableRun(context.Background(), "{}"); err == nil {
+		t.Error("slow tool finished past its timeout")
+	}
+}
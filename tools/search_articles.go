@@ -1,250 +1,213 @@
 package tools
 
-// import (
-// 	"context"
-// 	"fmt"
-// 	"os"
-// 	"strings"
-
-// 	geminiembed "github.com/cloudwego/eino-ext/components/embedding/gemini"
-// 	"github.com/cloudwego/eino/components/tool"
-// 	"github.com/cloudwego/eino/components/tool/utils"
-// 	"github.com/cloudwego/eino/schema"
-// 	"github.com/milvus-io/milvus/client/v2/column"
-// 	"github.com/milvus-io/milvus/client/v2/entity"
-// 	"github.com/milvus-io/milvus/client/v2/milvusclient"
-// 	"google.golang.org/genai"
-// )
-
-// const (
-// 	defaultArticleTopK     = 5
-// 	articlesCollectionName = "articles"
-// 	titleVectorField       = "title_vector"
-// 	defaultEmbeddingModel  = "gemini-embedding-001"
-// )
-
-// // SearchArticlesInput contains the query and optional parameters for article search.
-// type SearchArticlesInput struct {
-// 	Query string `json:"query"`
-// 	TopK  int    `json:"top_k,omitempty"`
-// }
-
-// // ArticleSearchResult represents a single article hit returned from Milvus.
-// type ArticleSearchResult struct {
-// 	ID          string  `json:"id"`
-// 	Title       string  `json:"title"`
-// 	Link        string  `json:"link"`
-// 	Publication string  `json:"publication"`
-// 	ReadingTime int     `json:"reading_time"`
-// 	Claps       int     `json:"claps"`
-// 	Responses   int     `json:"responses"`
-// 	Score       float64 `json:"score"`
-// }
-
-// // SearchArticlesOutput wraps the list of retrieved articles.
-// type SearchArticlesOutput struct {
-// 	Articles []ArticleSearchResult `json:"articles"`
-// 	Total    int                   `json:"total"`
-// }
-
-// func createSearchArticleTool() tool.BaseTool {
-// 	return utils.NewTool(
-// 		&schema.ToolInfo{
-// 			Name: ToolSearchArticles,
-// 			Desc: "Semantic search over the articles vector database. Provide a natural language question to retrieve relevant Medium-style articles (title, publication, link, engagement metrics).",
-// 			ParamsOneOf: schema.NewParamsOneOfByParams(map[string]*schema.ParameterInfo{
-// 				"query": {
-// 					Type:     "string",
-// 					Desc:     "Free-form question or keywords describing the article you are looking for.",
-// 					Required: true,
-// 				},
-// 				"top_k": {
-// 					Type: "number",
-// 					Desc: "Maximum number of articles to return (default: 5, max: 20).",
-// 				},
-// 			}),
-// 		},
-// 		func(ctx context.Context, in *SearchArticlesInput) (*SearchArticlesOutput, error) {
-// 			if in.Query == "" {
-// 				return nil, fmt.Errorf("query is required")
-// 			}
-
-// 			topK := in.TopK
-// 			if topK <= 0 {
-// 				topK = defaultArticleTopK
-// 			}
-// 			if topK > 20 {
-// 				topK = 20
-// 			}
-
-// 			apiKey := strings.TrimSpace(os.Getenv("GEMINI_API_KEY"))
-// 			if apiKey == "" {
-// 				return nil, fmt.Errorf("missing GEMINI_API_KEY")
-// 			}
-
-// 			genaiClient, err := genai.NewClient(ctx, &genai.ClientConfig{
-// 				APIKey:  apiKey,
-// 				Backend: genai.BackendGeminiAPI,
-// 			})
-// 			if err != nil {
-// 				return nil, fmt.Errorf("create genai client: %w", err)
-// 			}
-
-// 			embedder, err := geminiembed.NewEmbedder(ctx, &geminiembed.EmbeddingConfig{
-// 				Client: genaiClient,
-// 				Model:  defaultEmbeddingModel,
-// 			})
-// 			if err != nil {
-// 				return nil, fmt.Errorf("create embedder: %w", err)
-// 			}
-
-// 			embeddings, err := embedder.EmbedStrings(ctx, []string{in.Query})
-// 			if err != nil {
-// 				return nil, fmt.Errorf("embed query: %w", err)
-// 			}
-// 			if len(embeddings) == 0 || len(embeddings[0]) == 0 {
-// 				return nil, fmt.Errorf("embed query: empty embedding returned")
-// 			}
-
-// 			queryVector := make([]float32, len(embeddings[0]))
-// 			for i, v := range embeddings[0] {
-// 				queryVector[i] = float32(v)
-// 			}
-
-// 			addr := strings.TrimSpace(os.Getenv("MILVUS_ADDR"))
-// 			if addr == "" {
-// 				return nil, fmt.Errorf("missing MILVUS_ADDR")
-// 			}
-
-// 			milvusClient, err := milvusclient.New(ctx, &milvusclient.ClientConfig{
-// 				Address:  addr,
-// 				Username: strings.TrimSpace(os.Getenv("MILVUS_USERNAME")),
-// 				Password: strings.TrimSpace(os.Getenv("MILVUS_PASSWORD")),
-// 			})
-// 			if err != nil {
-// 				return nil, fmt.Errorf("create milvus client: %w", err)
-// 			}
-// 			defer milvusClient.Close(ctx)
-
-// 			loadTask, err := milvusClient.LoadCollection(ctx, milvusclient.NewLoadCollectionOption(articlesCollectionName))
-// 			if err != nil {
-// 				return nil, fmt.Errorf("load collection %s: %w", articlesCollectionName, err)
-// 			}
-// 			if err := loadTask.Await(ctx); err != nil {
-// 				return nil, fmt.Errorf("await collection load: %w", err)
-// 			}
-
-// 			searchOpt := milvusclient.NewSearchOption(articlesCollectionName, topK, []entity.Vector{entity.FloatVector(queryVector)}).
-// 				WithANNSField(titleVectorField).
-// 				WithOutputFields("title", "link", "publication", "reading_time", "claps", "responses").
-// 				WithSearchParam("metric_type", string(entity.COSINE)).
-// 				WithSearchParam("params", "{\"nprobe\": 10}")
-
-// 			resultSets, err := milvusClient.Search(ctx, searchOpt)
-// 			if err != nil {
-// 				return nil, fmt.Errorf("search collection: %w", err)
-// 			}
-
-// 			if len(resultSets) == 0 || resultSets[0].ResultCount == 0 {
-// 				return &SearchArticlesOutput{Articles: nil, Total: 0}, nil
-// 			}
-
-// 			rs := resultSets[0]
-// 			titleCol := rs.GetColumn("title")
-// 			linkCol := rs.GetColumn("link")
-// 			publicationCol := rs.GetColumn("publication")
-// 			readingTimeCol := rs.GetColumn("reading_time")
-// 			clapsCol := rs.GetColumn("claps")
-// 			responsesCol := rs.GetColumn("responses")
-
-// 			articles := make([]ArticleSearchResult, 0, rs.ResultCount)
-// 			for idx := 0; idx < rs.ResultCount; idx++ {
-// 				idVal, err := rs.IDs.Get(idx)
-// 				if err != nil {
-// 					return nil, fmt.Errorf("result %d: get id: %w", idx, err)
-// 				}
-
-// 				title, err := valueAsString(titleCol, idx)
-// 				if err != nil {
-// 					return nil, fmt.Errorf("result %d: decode title: %w", idx, err)
-// 				}
-
-// 				link, err := valueAsString(linkCol, idx)
-// 				if err != nil {
-// 					return nil, fmt.Errorf("result %d: decode link: %w", idx, err)
-// 				}
-
-// 				publication, err := valueAsString(publicationCol, idx)
-// 				if err != nil {
-// 					return nil, fmt.Errorf("result %d: decode publication: %w", idx, err)
-// 				}
-
-// 				readingTime, err := valueAsInt(readingTimeCol, idx)
-// 				if err != nil {
-// 					return nil, fmt.Errorf("result %d: decode reading_time: %w", idx, err)
-// 				}
-
-// 				claps, err := valueAsInt(clapsCol, idx)
-// 				if err != nil {
-// 					return nil, fmt.Errorf("result %d: decode claps: %w", idx, err)
-// 				}
-
-// 				responses, err := valueAsInt(responsesCol, idx)
-// 				if err != nil {
-// 					return nil, fmt.Errorf("result %d: decode responses: %w", idx, err)
-// 				}
-
-// 				articles = append(articles, ArticleSearchResult{
-// 					ID:          fmt.Sprint(idVal),
-// 					Title:       title,
-// 					Link:        link,
-// 					Publication: publication,
-// 					ReadingTime: readingTime,
-// 					Claps:       claps,
-// 					Responses:   responses,
-// 					Score:       float64(rs.Scores[idx]),
-// 				})
-// 			}
-
-// 			return &SearchArticlesOutput{
-// 				Articles: articles,
-// 				Total:    len(articles),
-// 			}, nil
-// 		},
-// 	)
-// }
-
-// func valueAsString(col column.Column, idx int) (string, error) {
-// 	if col == nil {
-// 		return "", nil
-// 	}
-// 	val, err := col.Get(idx)
-// 	if err != nil {
-// 		return "", err
-// 	}
-// 	s, ok := val.(string)
-// 	if !ok {
-// 		return fmt.Sprintf("%v", val), nil
-// 	}
-// 	return s, nil
-// }
-
-// func valueAsInt(col column.Column, idx int) (int, error) {
-// 	if col == nil {
-// 		return 0, nil
-// 	}
-// 	val, err := col.Get(idx)
-// 	if err != nil {
-// 		return 0, err
-// 	}
-// 	switch v := val.(type) {
-// 	case int:
-// 		return v, nil
-// 	case int32:
-// 		return int(v), nil
-// 	case int64:
-// 		return int(v), nil
-// 	default:
-// 		return 0, fmt.Errorf("unexpected type %T", val)
-// 	}
-// }
+import (
+	"context"
+	"fmt"
+
+	"github.com/cloudwego/eino/components/tool"
+	"github.com/cloudwego/eino/components/tool/utils"
+	"github.com/cloudwego/eino/schema"
+	"github.com/pawarison/eino-multi-modal-poc/articles"
+	"github.com/pawarison/eino-multi-modal-poc/retrieval"
+)
+
+// SearchArticlesConfig controls the search_articles tool. The collection and
+// fusion settings live in retrieval.Config.
+type SearchArticlesConfig struct {
+	DefaultTopK int `envconfig:"SEARCH_DEFAULT_TOP_K" default:"5"`
+	MaxTopK     int `envconfig:"SEARCH_MAX_TOP_K" default:"20"`
+}
+
+// SearchArticlesInput contains the query and optional parameters for article search.
+// Unset filters do not restrict the results.
+type SearchArticlesInput struct {
+	Query string `json:"query"`
+	TopK  int    `json:"top_k,omitempty"`
+	ArticleFilterInput
+}
+
+// ArticleFilterInput holds the metadata filters shared by the article tools.
+type ArticleFilterInput struct {
+	Publications   []string `json:"publications,omitempty"`
+	MinReadingTime *int32   `json:"min_reading_time,omitempty"`
+	MaxReadingTime *int32   `json:"max_reading_time,omitempty"`
+	MinClaps       *int32   `json:"min_claps,omitempty"`
+	MinResponses   *int32   `json:"min_responses,omitempty"`
+}
+
+// Filter returns the metadata filter of the input.
+func (in *ArticleFilterInput) Filter() articles.Filter {
+	return articles.Filter{
+		Publications:   in.Publications,
+		MinReadingTime: in.MinReadingTime,
+		MaxReadingTime: in.MaxReadingTime,
+		MinClaps:       in.MinClaps,
+		MinResponses:   in.MinResponses,
+	}
+}
+
+// ScoreBreakdown splits the final score into additive parts.
+type ScoreBreakdown struct {
+	Relevance  float64 `json:"relevance"`
+	Popularity float64 `json:"popularity"`
+	LLM        float64 `json:"llm"`
+	Diversity  float64 `json:"diversity"`
+}
+
+// ArticleSearchResult represents a single article hit. Score is the final
+// score after reranking; the retriever scores are 0 when that retriever
+// missed the article.
+type ArticleSearchResult struct {
+	ID             string         `json:"id"`
+	Title          string         `json:"title"`
+	Link           string         `json:"link"`
+	Publication    string         `json:"publication"`
+	ReadingTime    int            `json:"reading_time"`
+	Claps          int            `json:"claps"`
+	Responses      int            `json:"responses"`
+	Score          float64        `json:"score"`
+	ScoreBreakdown ScoreBreakdown `json:"score_breakdown"`
+	VectorScore    float64        `json:"vector_score"`
+	LexicalScore   float64        `json:"lexical_score"`
+	// Passage is the best matching part of a long article, when articles are
+	// stored in chunks.
+	Passage string `json:"passage,omitempty"`
+}
+
+// SearchArticlesOutput wraps the list of retrieved articles.
+type SearchArticlesOutput struct {
+	Articles []ArticleSearchResult `json:"articles"`
+	Total    int                   `json:"total"`
+}
+
+// articleSearcher runs searches with clients that outlive the tool calls.
+type articleSearcher struct {
+	cfg      SearchArticlesConfig
+	searcher *retrieval.Searcher
+	reranker *retrieval.Reranker
+}
+
+// NewSearchArticlesTool builds the search_articles tool on top of an existing
+// hybrid searcher and an optional reranker. The clients behind them are owned
+// by the caller, who closes them on shutdown.
+func NewSearchArticlesTool(cfg *SearchArticlesConfig, searcher *retrieval.Searcher, reranker *retrieval.Reranker) (tool.InvokableTool, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("search articles config is nil")
+	}
+	if searcher == nil {
+		return nil, fmt.Errorf("searcher is nil")
+	}
+	if cfg.DefaultTopK <= 0 || cfg.MaxTopK < cfg.DefaultTopK {
+		return nil, fmt.Errorf("invalid top k: default %d, max %d", cfg.DefaultTopK, cfg.MaxTopK)
+	}
+
+	s := &articleSearcher{cfg: *cfg, searcher: searcher, reranker: reranker}
+	return utils.NewTool(
+		&schema.ToolInfo{
+			Name: ToolSearchArticles,
+			Desc: "Hybrid keyword and semantic search over the articles database. Provide a natural language question or keywords to retrieve relevant Medium-style articles (title, publication, link, engagement metrics).",
+			ParamsOneOf: schema.NewParamsOneOfByParams(withFilterParams(map[string]*schema.ParameterInfo{
+				"query": {
+					Type:     "string",
+					Desc:     "Free-form question or keywords describing the article you are looking for.",
+					Required: true,
+				},
+				"top_k": {
+					Type: "number",
+					Desc: fmt.Sprintf("Maximum number of articles to return (default: %d, max: %d).", cfg.DefaultTopK, cfg.MaxTopK),
+				},
+			})),
+		},
+		s.search,
+	), nil
+}
+
+// withFilterParams adds the parameters of ArticleFilterInput to params.
+func withFilterParams(params map[string]*schema.ParameterInfo) map[string]*schema.ParameterInfo {
+	params["publications"] = &schema.ParameterInfo{
+		Type:     "array",
+		Desc:     fmt.Sprintf("Only return articles from these publications, matched exactly (at most %d).", articles.MaxFilterPublications),
+		ElemInfo: &schema.ParameterInfo{Type: "string"},
+	}
+	params["min_reading_time"] = &schema.ParameterInfo{
+		Type: "integer",
+		Desc: "Minimum reading time in minutes.",
+	}
+	params["max_reading_time"] = &schema.ParameterInfo{
+		Type: "integer",
+		Desc: "Maximum reading time in minutes.",
+	}
+	params["min_claps"] = &schema.ParameterInfo{
+		Type: "integer",
+		Desc: "Minimum number of claps.",
+	}
+	params["min_responses"] = &schema.ParameterInfo{
+		Type: "integer",
+		Desc: "Minimum number of responses.",
+	}
+	return params
+}
+
+// topK applies the configured default and maximum to a requested top k.
+func (c SearchArticlesConfig) topK(requested int) int {
+	if requested <= 0 {
+		return c.DefaultTopK
+	}
+	return min(requested, c.MaxTopK)
+}
+
+func (s *articleSearcher) search(ctx context.Context, in *SearchArticlesInput) (*SearchArticlesOutput, error) {
+	if in.Query == "" {
+		return nil, fmt.Errorf("query is required")
+	}
+
+	topK := s.cfg.topK(in.TopK)
+	depth := topK
+	if s.reranker != nil {
+		depth = s.reranker.Depth(topK)
+	}
+	hits, err := s.searcher.Search(ctx, retrieval.Request{Query: in.Query, TopK: depth, Filter: in.Filter()})
+	if err != nil {
+		return nil, fmt.Errorf("search articles: %w", err)
+	}
+	if s.reranker != nil {
+		hits, err = s.reranker.Rerank(ctx, in.Query, hits, topK)
+		if err != nil {
+			return nil, fmt.Errorf("rerank articles: %w", err)
+		}
+	}
+
+	results := articleResults(hits)
+	return &SearchArticlesOutput{
+		Articles: results,
+		Total:    len(results),
+	}, nil
+}
+
+// articleResults converts hits into tool results.
+func articleResults(hits []retrieval.Hit) []ArticleSearchResult {
+	results := make([]ArticleSearchResult, 0, len(hits))
+	for _, h := range hits {
+		a := h.Article
+		results = append(results, ArticleSearchResult{
+			ID:          fmt.Sprint(a.ID),
+			Title:       a.Title,
+			Link:        a.Link,
+			Publication: a.Publication,
+			ReadingTime: int(a.ReadingTime),
+			Claps:       int(a.Claps),
+			Responses:   int(a.Responses),
+			Score:       h.Score,
+			ScoreBreakdown: ScoreBreakdown{
+				Relevance:  h.Breakdown.Relevance,
+				Popularity: h.Breakdown.Popularity,
+				LLM:        h.Breakdown.LLM,
+				Diversity:  h.Breakdown.Diversity,
+			},
+			VectorScore:  h.VectorScore,
+			LexicalScore: h.LexicalScore,
+			Passage:      h.Passage,
+		})
+	}
+	return results
+}
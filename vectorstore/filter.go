@@ -0,0 +1,194 @@
+package vectorstore
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Op is a filter comparison.
+type Op string
+
+const (
+	OpEq  Op = "=="
+	OpIn  Op = "in"
+	OpGte Op = ">="
+	OpLte Op = "<="
+)
+
+// Condition compares one field against one or more values.
+type Condition struct {
+	Field  string
+	Op     Op
+	Values []any
+}
+
+// Filter is a conjunction of conditions. The zero value matches everything.
+type Filter []Condition
+
+// Eq matches documents whose field equals v.
+func Eq(field string, v any) Condition {
+	return Condition{Field: field, Op: OpEq, Values: []any{v}}
+}
+
+// In matches documents whose field equals any of values.
+func In(field string, values ...any) Condition {
+	return Condition{Field: field, Op: OpIn, Values: values}
+}
+
+// Gte matches documents whose numeric field is at least v.
+func Gte(field string, v any) Condition {
+	return Condition{Field: field, Op: OpGte, Values: []any{v}}
+}
+
+// Lte matches documents whose numeric field is at most v.
+func Lte(field string, v any) Condition {
+	return Condition{Field: field, Op: OpLte, Values: []any{v}}
+}
+
+var fieldNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Validate checks every condition against the collection fields: the field
+// must exist or be PrimaryField, numeric comparisons need a numeric field and
+// each value must fit the field type.
+func (f Filter) Validate(spec CollectionSpec) error {
+	for _, c := range f {
+		if !fieldNamePattern.MatchString(c.Field) {
+			return fmt.Errorf("filter: invalid field name %q", c.Field)
+		}
+		field, ok := spec.Field(c.Field)
+		if c.Field == PrimaryField {
+			field, ok = Field{Name: PrimaryField, Type: FieldInt64}, true
+		}
+		if !ok {
+			return fmt.Errorf("filter: unknown field %s", c.Field)
+		}
+		switch c.Op {
+		case OpEq, OpGte, OpLte:
+			if len(c.Values) != 1 {
+				return fmt.Errorf("filter: %s %s needs exactly one value", c.Field, c.Op)
+			}
+		case OpIn:
+			if len(c.Values) == 0 {
+				return fmt.Errorf("filter: %s in needs at least one value", c.Field)
+			}
+		default:
+			return fmt.Errorf("filter: unsupported operator %q", c.Op)
+		}
+		if (c.Op == OpGte || c.Op == OpLte) && !isNumeric(field.Type) {
+			return fmt.Errorf("filter: %s %s needs a numeric field", c.Field, c.Op)
+		}
+		for _, v := range c.Values {
+			// length limits do not apply to filter values
+			check := field
+			check.MaxLength = 0
+			if _, err := convertValue(check, v); err != nil {
+				return fmt.Errorf("filter: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// Expr renders the filter as a Milvus boolean expression. String values are
+// quoted and escaped, so values cannot change the expression structure.
+func (f Filter) Expr(spec CollectionSpec) (string, error) {
+	if err := f.Validate(spec); err != nil {
+		return "", err
+	}
+	parts := make([]string, 0, len(f))
+	for _, c := range f {
+		values := make([]string, len(c.Values))
+		for i, v := range c.Values {
+			values[i] = exprLiteral(v)
+		}
+		switch c.Op {
+		case OpIn:
+			parts = append(parts, fmt.Sprintf("%s in [%s]", c.Field, strings.Join(values, ", ")))
+		default:
+			parts = append(parts, fmt.Sprintf("%s %s %s", c.Field, c.Op, values[0]))
+		}
+	}
+	return strings.Join(parts, " and "), nil
+}
+
+// Match evaluates the filter against a document's fields in memory.
+func (f Filter) Match(id int64, fields map[string]any) bool {
+	for _, c := range f {
+		var v any
+		if c.Field == PrimaryField {
+			v = id
+		} else {
+			v = fields[c.Field]
+		}
+		if !matchCondition(c, v) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchCondition(c Condition, v any) bool {
+	switch c.Op {
+	case OpEq, OpIn:
+		for _, want := range c.Values {
+			if equalValues(v, want) {
+				return true
+			}
+		}
+		return false
+	case OpGte, OpLte:
+		order, ok := compareNumbers(v, c.Values[0])
+		if !ok {
+			return false
+		}
+		if c.Op == OpGte {
+			return order >= 0
+		}
+		return order <= 0
+	default:
+		return false
+	}
+}
+
+func equalValues(a, b any) bool {
+	if order, ok := compareNumbers(a, b); ok {
+		return order == 0
+	}
+	return a == b
+}
+
+// compareNumbers returns -1, 0 or 1 as a is less than, equal to or greater
+// than b. Two integers compare exactly; otherwise both compare as float64.
+func compareNumbers(a, b any) (int, bool) {
+	if ia, ok := toInt64(a); ok {
+		if ib, ok := toInt64(b); ok {
+			return cmp.Compare(ia, ib), true
+		}
+	}
+	fa, ok := toFloat64(a)
+	if !ok {
+		return 0, false
+	}
+	fb, ok := toFloat64(b)
+	if !ok {
+		return 0, false
+	}
+	return cmp.Compare(fa, fb), true
+}
+
+func exprLiteral(v any) string {
+	switch x := v.(type) {
+	case string:
+		return strconv.Quote(x)
+	case bool:
+		return strconv.FormatBool(x)
+	}
+	if n, ok := toInt64(v); ok {
+		return strconv.FormatInt(n, 10)
+	}
+	n, _ := toFloat64(v)
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
@@ -0,0 +1,113 @@
+package vectorstore
+
+import (
+	"math"
+	"testing"
+)
+
+var filterSpec = CollectionSpec{
+	Name:        "articles",
+	VectorField: "vector",
+	Dim:         4,
+	Fields: []Field{
+		{Name: "title", Type: FieldVarChar, MaxLength: 16},
+		{Name: "claps", Type: FieldInt32},
+		{Name: "parent_id", Type: FieldInt64},
+		{Name: "score", Type: FieldDouble},
+		{Name: "published", Type: FieldBool},
+	},
+}
+
+// big is above 2^53, where float64 can no longer tell neighbouring integers apart.
+const big int64 = 1<<53 + 1
+
+func TestFilterExpr(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter Filter
+		want   string
+	}{
+		{"empty", nil, ""},
+		{"string is quoted", Filter{Eq("title", `a "quoted" \ title`)}, `title == "a \"quoted\" \\ title"`},
+		{"conjunction", Filter{Gte("claps", 10), Lte("score", 2.5), Eq("published", true)}, "claps >= 10 and score <= 2.5 and published == true"},
+		{"large id", Filter{Eq(PrimaryField, big)}, "id == 9007199254740993"},
+		{"large ids in", Filter{In(PrimaryField, big, int64(math.MaxInt64))}, "id in [9007199254740993, 9223372036854775807]"},
+		{"large int64 field", Filter{Gte("parent_id", big)}, "parent_id >= 9007199254740993"},
+		{"integral float", Filter{Eq("claps", 3.0)}, "claps == 3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.filter.Expr(filterSpec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Expr = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter Filter
+	}{
+		{"unknown field", Filter{Eq("author", "x")}},
+		{"invalid field name", Filter{Eq("title or 1", "x")}},
+		{"range on varchar", Filter{Gte("title", "a")}},
+		{"string for a number", Filter{Eq("claps", "10")}},
+		{"fractional integer", Filter{Eq("claps", 1.5)}},
+		{"int32 overflow", Filter{Eq("claps", int64(math.MaxInt32)+1)}},
+		{"uint64 overflow", Filter{Eq(PrimaryField, uint64(math.MaxUint64))}},
+		{"empty in", Filter{In("claps")}},
+		{"two values for eq", Filter{{Field: "claps", Op: OpEq, Values: []any{1, 2}}}},
+		{"unknown operator", Filter{{Field: "claps", Op: "!=", Values: []any{1}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.filter.Validate(filterSpec); err == nil {
+				t.Errorf("Validate(%+v) = nil, want an error", tt.filter)
+			}
+		})
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	fields := map[string]any{"title": "Go", "claps": int32(12), "parent_id": big, "score": 0.5, "published": true}
+	tests := []struct {
+		name   string
+		filter Filter
+		id     int64
+		want   bool
+	}{
+		{"empty matches", nil, 1, true},
+		{"large id", Filter{Eq(PrimaryField, big)}, big, true},
+		{"large id neighbour", Filter{Eq(PrimaryField, big-1)}, big, false},
+		{"large id in", Filter{In(PrimaryField, big-1, big+1)}, big, false},
+		{"large field range", Filter{Gte("parent_id", big)}, 1, true},
+		{"large field range neighbour", Filter{Gte("parent_id", big+1)}, 1, false},
+		{"int against float", Filter{Eq("claps", 12.0)}, 1, true},
+		{"double range", Filter{Lte("score", 0.5), Gte("score", 0.25)}, 1, true},
+		{"string", Filter{In("title", "Rust", "Go")}, 1, true},
+		{"bool", Filter{Eq("published", false)}, 1, false},
+		{"missing field", Filter{Gte("missing", 1)}, 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Match(tt.id, fields); got != tt.want {
+				t.Errorf("Match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertValueKeepsLargeIntegers(t *testing.T) {
+	got, err := convertValue(Field{Name: "parent_id", Type: FieldInt64}, big)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != big {
+		t.Errorf("convertValue = %v, want %d", got, big)
+	}
+}
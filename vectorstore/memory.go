@@ -0,0 +1,294 @@
+package vectorstore
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+)
+
+// Memory is an in-process store with brute-force cosine search. It is meant
+// for local development and small datasets; nothing is persisted.
+type Memory struct {
+	mu          sync.RWMutex
+	collections map[string]*memCollection
+	aliases     map[string]string
+}
+
+type memCollection struct {
+	spec CollectionSpec
+	docs map[int64]Document
+}
+
+// NewMemory creates an empty in-memory store.
+func NewMemory() *Memory {
+	return &Memory{collections: map[string]*memCollection{}, aliases: map[string]string{}}
+}
+
+func (m *Memory) EnsureCollection(_ context.Context, spec CollectionSpec) error {
+	if err := spec.validate(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if c, err := m.collection(spec.Name); err == nil {
+		return spec.Check(c.spec)
+	}
+	if spec.Dim <= 0 {
+		return fmt.Errorf("collection %s: dimension is required to create it", spec.Name)
+	}
+	m.collections[spec.Name] = &memCollection{spec: spec.clone(), docs: map[int64]Document{}}
+	return nil
+}
+
+func (m *Memory) Describe(_ context.Context, collection string) (CollectionSpec, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	c, err := m.collection(collection)
+	if err != nil {
+		return CollectionSpec{}, err
+	}
+	return c.spec.clone(), nil
+}
+
+func (m *Memory) Upsert(_ context.Context, collection string, docs []Document) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, err := m.collection(collection)
+	if err != nil {
+		return err
+	}
+	rows := make([]Document, len(docs))
+	for i, d := range docs {
+		if len(d.Vector) != c.spec.Dim {
+			return fmt.Errorf("document %d: vector dimension %d, want %d", d.ID, len(d.Vector), c.spec.Dim)
+		}
+		fields := make(map[string]any, len(c.spec.Fields))
+		for _, f := range c.spec.Fields {
+			v, err := convertValue(f, d.Fields[f.Name])
+			if err != nil {
+				return fmt.Errorf("document %d: %w", d.ID, err)
+			}
+			fields[f.Name] = v
+		}
+		rows[i] = Document{ID: d.ID, Vector: append([]float32{}, d.Vector...), Fields: fields}
+	}
+	for _, d := range rows {
+		c.docs[d.ID] = d
+	}
+	return nil
+}
+
+func (m *Memory) Delete(_ context.Context, collection string, ids []int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, err := m.collection(collection)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		delete(c.docs, id)
+	}
+	return nil
+}
+
+func (m *Memory) DeleteWhere(_ context.Context, collection string, filter Filter) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, err := m.collection(collection)
+	if err != nil {
+		return err
+	}
+	if len(filter) == 0 {
+		return fmt.Errorf("delete needs a filter")
+	}
+	if err := filter.Validate(c.spec); err != nil {
+		return err
+	}
+	for id, d := range c.docs {
+		if filter.Match(d.ID, d.Fields) {
+			delete(c.docs, id)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) Search(_ context.Context, collection string, req SearchRequest) ([]Hit, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	c, err := m.collection(collection)
+	if err != nil {
+		return nil, err
+	}
+	if len(req.Vector) != c.spec.Dim {
+		return nil, fmt.Errorf("query vector dimension %d, want %d", len(req.Vector), c.spec.Dim)
+	}
+	if req.TopK <= 0 {
+		return nil, fmt.Errorf("invalid top k: %d", req.TopK)
+	}
+	if err := req.Filter.Validate(c.spec); err != nil {
+		return nil, err
+	}
+	outputFields := req.OutputFields
+	if len(outputFields) == 0 {
+		outputFields = c.spec.FieldNames()
+	}
+
+	hits := make([]Hit, 0, len(c.docs))
+	for _, d := range c.docs {
+		if !req.Filter.Match(d.ID, d.Fields) {
+			continue
+		}
+		hits = append(hits, Hit{ID: d.ID, Score: cosine(req.Vector, d.Vector)})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	if len(hits) > req.TopK {
+		hits = hits[:req.TopK]
+	}
+	for i := range hits {
+		doc := c.docs[hits[i].ID]
+		hits[i].Fields = make(map[string]any, len(outputFields))
+		for _, name := range outputFields {
+			if v, ok := doc.Fields[name]; ok {
+				hits[i].Fields[name] = v
+			}
+		}
+	}
+	return hits, nil
+}
+
+func (m *Memory) Query(_ context.Context, collection string, filter Filter) ([]Document, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	c, err := m.collection(collection)
+	if err != nil {
+		return nil, err
+	}
+	if len(filter) == 0 {
+		return nil, fmt.Errorf("query needs a filter")
+	}
+	if err := filter.Validate(c.spec); err != nil {
+		return nil, err
+	}
+	var docs []Document
+	for _, d := range c.docs {
+		if !filter.Match(d.ID, d.Fields) {
+			continue
+		}
+		fields := make(map[string]any, len(d.Fields))
+		for k, v := range d.Fields {
+			fields[k] = v
+		}
+		docs = append(docs, Document{ID: d.ID, Vector: append([]float32(nil), d.Vector...), Fields: fields})
+	}
+	return docs, nil
+}
+
+func (m *Memory) Flush(_ context.Context, collection string) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, err := m.collection(collection)
+	return err
+}
+
+func (m *Memory) Count(_ context.Context, collection string) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	c, err := m.collection(collection)
+	if err != nil {
+		return 0, err
+	}
+	return len(c.docs), nil
+}
+
+func (m *Memory) ListCollections(context.Context) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	names := make([]string, 0, len(m.collections))
+	for name := range m.collections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (m *Memory) RenameCollection(_ context.Context, collection, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.collections[collection]
+	if !ok {
+		return fmt.Errorf("%s: %w", collection, ErrCollectionNotFound)
+	}
+	if _, ok := m.collections[name]; ok {
+		return fmt.Errorf("rename %s: collection %s exists", collection, name)
+	}
+	if _, ok := m.aliases[name]; ok {
+		return fmt.Errorf("rename %s: %s is an alias", collection, name)
+	}
+	delete(m.collections, collection)
+	c.spec.Name = name
+	m.collections[name] = c
+	for alias, target := range m.aliases {
+		if target == collection {
+			m.aliases[alias] = name
+		}
+	}
+	return nil
+}
+
+func (m *Memory) SetAlias(_ context.Context, alias, collection string) error {
+	if alias == "" {
+		return fmt.Errorf("alias is empty")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.collections[alias]; ok {
+		return fmt.Errorf("alias %s: a collection has that name", alias)
+	}
+	if _, ok := m.collections[collection]; !ok {
+		return fmt.Errorf("%s: %w", collection, ErrCollectionNotFound)
+	}
+	m.aliases[alias] = collection
+	return nil
+}
+
+func (m *Memory) ResolveAlias(_ context.Context, alias string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	name, ok := m.aliases[alias]
+	if !ok {
+		return "", fmt.Errorf("%s: %w", alias, ErrAliasNotFound)
+	}
+	return name, nil
+}
+
+// collection looks name up as a collection, then as an alias.
+func (m *Memory) collection(name string) (*memCollection, error) {
+	if target, ok := m.aliases[name]; ok {
+		name = target
+	}
+	c, ok := m.collections[name]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", name, ErrCollectionNotFound)
+	}
+	return c, nil
+}
+
+func cosine(a, b []float32) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
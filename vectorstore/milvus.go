@@ -0,0 +1,490 @@
+package vectorstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/milvus-io/milvus/client/v2/column"
+	"github.com/milvus-io/milvus/client/v2/entity"
+	"github.com/milvus-io/milvus/client/v2/index"
+	"github.com/milvus-io/milvus/client/v2/milvusclient"
+	"github.com/milvus-io/milvus/pkg/v2/util/merr"
+)
+
+// Milvus is a Store backed by a Milvus client. The client is owned by the caller.
+type Milvus struct {
+	cli *milvusclient.Client
+
+	mu    sync.RWMutex
+	specs map[string]CollectionSpec
+}
+
+// NewMilvus wraps an existing Milvus client.
+func NewMilvus(cli *milvusclient.Client) *Milvus {
+	return &Milvus{cli: cli, specs: map[string]CollectionSpec{}}
+}
+
+// EnsureCollection creates the collection with a cosine AUTOINDEX on the
+// vector field when it is missing, checks it against spec when it exists, then
+// loads it for search.
+func (m *Milvus) EnsureCollection(ctx context.Context, spec CollectionSpec) error {
+	if err := spec.validate(); err != nil {
+		return err
+	}
+	has, err := m.cli.HasCollection(ctx, milvusclient.NewHasCollectionOption(spec.Name))
+	if err != nil {
+		return fmt.Errorf("check collection %s: %w", spec.Name, err)
+	}
+	if has {
+		// check before loading so a mismatched collection is left untouched
+		existing, err := m.describe(ctx, spec.Name)
+		if err != nil {
+			return err
+		}
+		if err := spec.Check(existing); err != nil {
+			return err
+		}
+	} else {
+		if spec.Dim <= 0 {
+			return fmt.Errorf("collection %s: dimension is required to create it", spec.Name)
+		}
+		if err := m.create(ctx, spec); err != nil {
+			return err
+		}
+	}
+
+	loadTask, err := m.cli.LoadCollection(ctx, milvusclient.NewLoadCollectionOption(spec.Name))
+	if err != nil {
+		return fmt.Errorf("load collection %s: %w", spec.Name, err)
+	}
+	if err := loadTask.Await(ctx); err != nil {
+		return fmt.Errorf("await collection load: %w", err)
+	}
+
+	// cache the schema as stored, which is authoritative for existing collections
+	_, err = m.describe(ctx, spec.Name)
+	return err
+}
+
+func (m *Milvus) create(ctx context.Context, spec CollectionSpec) error {
+	schema := entity.NewSchema().
+		WithName(spec.Name).
+		WithDynamicFieldEnabled(true).
+		WithField(entity.NewField().WithName(PrimaryField).WithDataType(entity.FieldTypeInt64).WithIsPrimaryKey(true).WithIsAutoID(false)).
+		WithField(entity.NewField().WithName(spec.VectorField).WithDataType(entity.FieldTypeFloatVector).WithDim(int64(spec.Dim)))
+	for _, f := range spec.Fields {
+		field := entity.NewField().WithName(f.Name)
+		switch f.Type {
+		case FieldInt32:
+			field = field.WithDataType(entity.FieldTypeInt32)
+		case FieldInt64:
+			field = field.WithDataType(entity.FieldTypeInt64)
+		case FieldDouble:
+			field = field.WithDataType(entity.FieldTypeDouble)
+		case FieldBool:
+			field = field.WithDataType(entity.FieldTypeBool)
+		case FieldVarChar:
+			if f.MaxLength <= 0 {
+				return fmt.Errorf("field %s: varchar needs a max length", f.Name)
+			}
+			field = field.WithDataType(entity.FieldTypeVarChar).WithMaxLength(int64(f.MaxLength))
+		default:
+			return fmt.Errorf("field %s: unsupported type %q", f.Name, f.Type)
+		}
+		schema = schema.WithField(field)
+	}
+
+	createOption := milvusclient.NewCreateCollectionOption(spec.Name, schema).
+		WithIndexOptions(
+			milvusclient.NewCreateIndexOption(spec.Name,
+				spec.VectorField,
+				index.NewAutoIndex(entity.COSINE)).
+				WithIndexName(spec.VectorField + "_idx"),
+		).WithConsistencyLevel(entity.ClSession)
+	for k, v := range spec.Properties {
+		createOption = createOption.WithProperty(k, v)
+	}
+	if err := m.cli.CreateCollection(ctx, createOption); err != nil {
+		return fmt.Errorf("create collection %s: %w", spec.Name, err)
+	}
+	return nil
+}
+
+// describe reads the collection schema from Milvus and caches it.
+func (m *Milvus) describe(ctx context.Context, name string) (CollectionSpec, error) {
+	coll, err := m.cli.DescribeCollection(ctx, milvusclient.NewDescribeCollectionOption(name))
+	if err != nil {
+		return CollectionSpec{}, fmt.Errorf("describe collection %s: %w", name, err)
+	}
+	spec := CollectionSpec{Name: name, Properties: coll.Properties}
+	for _, f := range coll.Schema.Fields {
+		if f.PrimaryKey {
+			continue
+		}
+		switch f.DataType {
+		case entity.FieldTypeFloatVector:
+			dim, err := f.GetDim()
+			if err != nil {
+				return CollectionSpec{}, fmt.Errorf("collection %s: field %s: %w", name, f.Name, err)
+			}
+			spec.VectorField = f.Name
+			spec.Dim = int(dim)
+		case entity.FieldTypeInt32:
+			spec.Fields = append(spec.Fields, Field{Name: f.Name, Type: FieldInt32})
+		case entity.FieldTypeInt64:
+			spec.Fields = append(spec.Fields, Field{Name: f.Name, Type: FieldInt64})
+		case entity.FieldTypeDouble:
+			spec.Fields = append(spec.Fields, Field{Name: f.Name, Type: FieldDouble})
+		case entity.FieldTypeBool:
+			spec.Fields = append(spec.Fields, Field{Name: f.Name, Type: FieldBool})
+		case entity.FieldTypeVarChar:
+			maxLength, _ := strconv.Atoi(f.TypeParams[entity.TypeParamMaxLength])
+			spec.Fields = append(spec.Fields, Field{Name: f.Name, Type: FieldVarChar, MaxLength: maxLength})
+		}
+	}
+	if spec.VectorField == "" {
+		return CollectionSpec{}, fmt.Errorf("collection %s has no float vector field", name)
+	}
+
+	m.mu.Lock()
+	m.specs[name] = spec
+	m.mu.Unlock()
+	return spec, nil
+}
+
+func (m *Milvus) Describe(ctx context.Context, collection string) (CollectionSpec, error) {
+	spec, err := m.spec(ctx, collection)
+	if err != nil {
+		return CollectionSpec{}, err
+	}
+	return spec.clone(), nil
+}
+
+func (m *Milvus) spec(ctx context.Context, name string) (CollectionSpec, error) {
+	m.mu.RLock()
+	spec, ok := m.specs[name]
+	m.mu.RUnlock()
+	if ok {
+		return spec, nil
+	}
+	has, err := m.cli.HasCollection(ctx, milvusclient.NewHasCollectionOption(name))
+	if err != nil {
+		return CollectionSpec{}, fmt.Errorf("check collection %s: %w", name, err)
+	}
+	if !has {
+		return CollectionSpec{}, fmt.Errorf("%s: %w", name, ErrCollectionNotFound)
+	}
+	return m.describe(ctx, name)
+}
+
+func (m *Milvus) Upsert(ctx context.Context, collection string, docs []Document) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	spec, err := m.spec(ctx, collection)
+	if err != nil {
+		return err
+	}
+
+	ids := make([]int64, len(docs))
+	vectors := make([][]float32, len(docs))
+	values := make([][]any, len(spec.Fields))
+	for i, d := range docs {
+		if len(d.Vector) != spec.Dim {
+			return fmt.Errorf("document %d: vector dimension %d, want %d", d.ID, len(d.Vector), spec.Dim)
+		}
+		ids[i] = d.ID
+		vectors[i] = d.Vector
+		for j, f := range spec.Fields {
+			v, err := convertValue(f, d.Fields[f.Name])
+			if err != nil {
+				return fmt.Errorf("document %d: %w", d.ID, err)
+			}
+			values[j] = append(values[j], v)
+		}
+	}
+
+	columns := []column.Column{
+		column.NewColumnInt64(PrimaryField, ids),
+		column.NewColumnFloatVector(spec.VectorField, spec.Dim, vectors),
+	}
+	for j, f := range spec.Fields {
+		columns = append(columns, scalarColumn(f, values[j]))
+	}
+	if _, err := m.cli.Upsert(ctx, milvusclient.NewColumnBasedInsertOption(collection, columns...)); err != nil {
+		return fmt.Errorf("upsert into %s: %w", collection, err)
+	}
+	return nil
+}
+
+// scalarColumn builds a column from values already coerced by convertValue.
+func scalarColumn(f Field, values []any) column.Column {
+	switch f.Type {
+	case FieldInt32:
+		return column.NewColumnInt32(f.Name, typed[int32](values))
+	case FieldInt64:
+		return column.NewColumnInt64(f.Name, typed[int64](values))
+	case FieldDouble:
+		return column.NewColumnDouble(f.Name, typed[float64](values))
+	case FieldBool:
+		return column.NewColumnBool(f.Name, typed[bool](values))
+	default:
+		return column.NewColumnVarChar(f.Name, typed[string](values))
+	}
+}
+
+func typed[T any](values []any) []T {
+	out := make([]T, len(values))
+	for i, v := range values {
+		out[i] = v.(T)
+	}
+	return out
+}
+
+func (m *Milvus) Delete(ctx context.Context, collection string, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if _, err := m.cli.Delete(ctx, milvusclient.NewDeleteOption(collection).WithInt64IDs(PrimaryField, ids)); err != nil {
+		return fmt.Errorf("delete from %s: %w", collection, err)
+	}
+	return nil
+}
+
+func (m *Milvus) DeleteWhere(ctx context.Context, collection string, filter Filter) error {
+	spec, err := m.spec(ctx, collection)
+	if err != nil {
+		return err
+	}
+	if len(filter) == 0 {
+		return fmt.Errorf("delete needs a filter")
+	}
+	expr, err := filter.Expr(spec)
+	if err != nil {
+		return err
+	}
+	if _, err := m.cli.Delete(ctx, milvusclient.NewDeleteOption(collection).WithExpr(expr)); err != nil {
+		return fmt.Errorf("delete from %s where %s: %w", collection, expr, err)
+	}
+	return nil
+}
+
+func (m *Milvus) Search(ctx context.Context, collection string, req SearchRequest) ([]Hit, error) {
+	spec, err := m.spec(ctx, collection)
+	if err != nil {
+		return nil, err
+	}
+	if len(req.Vector) != spec.Dim {
+		return nil, fmt.Errorf("query vector dimension %d, want %d", len(req.Vector), spec.Dim)
+	}
+	if req.TopK <= 0 {
+		return nil, fmt.Errorf("invalid top k: %d", req.TopK)
+	}
+	expr, err := req.Filter.Expr(spec)
+	if err != nil {
+		return nil, err
+	}
+	outputFields := req.OutputFields
+	if len(outputFields) == 0 {
+		outputFields = spec.FieldNames()
+	}
+
+	searchOpt := milvusclient.NewSearchOption(collection, req.TopK, []entity.Vector{entity.FloatVector(req.Vector)}).
+		WithANNSField(spec.VectorField).
+		WithOutputFields(outputFields...).
+		WithSearchParam("metric_type", string(entity.COSINE)).
+		WithSearchParam("params", "{\"nprobe\": 10}")
+	if expr != "" {
+		searchOpt = searchOpt.WithFilter(expr)
+	}
+
+	resultSets, err := m.cli.Search(ctx, searchOpt)
+	if err != nil {
+		return nil, fmt.Errorf("search collection %s: %w", collection, err)
+	}
+	if len(resultSets) == 0 || resultSets[0].ResultCount == 0 {
+		return nil, nil
+	}
+
+	rs := resultSets[0]
+	hits := make([]Hit, 0, rs.ResultCount)
+	for idx := 0; idx < rs.ResultCount; idx++ {
+		idVal, err := rs.IDs.Get(idx)
+		if err != nil {
+			return nil, fmt.Errorf("result %d: get id: %w", idx, err)
+		}
+		id, ok := idVal.(int64)
+		if !ok {
+			return nil, fmt.Errorf("result %d: unexpected id type %T", idx, idVal)
+		}
+		hit := Hit{ID: id, Score: float64(rs.Scores[idx]), Fields: make(map[string]any, len(outputFields))}
+		for _, name := range outputFields {
+			col := rs.GetColumn(name)
+			if col == nil {
+				continue
+			}
+			v, err := col.Get(idx)
+			if err != nil {
+				return nil, fmt.Errorf("result %d: decode %s: %w", idx, name, err)
+			}
+			hit.Fields[name] = v
+		}
+		hits = append(hits, hit)
+	}
+	return hits, nil
+}
+
+// Query reads with strong consistency, so documents upserted before the call
+// are found.
+func (m *Milvus) Query(ctx context.Context, collection string, filter Filter) ([]Document, error) {
+	spec, err := m.spec(ctx, collection)
+	if err != nil {
+		return nil, err
+	}
+	if len(filter) == 0 {
+		return nil, fmt.Errorf("query needs a filter")
+	}
+	expr, err := filter.Expr(spec)
+	if err != nil {
+		return nil, err
+	}
+	outputFields := append([]string{PrimaryField, spec.VectorField}, spec.FieldNames()...)
+	rs, err := m.cli.Query(ctx, milvusclient.NewQueryOption(collection).
+		WithFilter(expr).
+		WithOutputFields(outputFields...).
+		WithConsistencyLevel(entity.ClStrong))
+	if err != nil {
+		return nil, fmt.Errorf("query %s: %w", collection, err)
+	}
+
+	ids, vectors := rs.GetColumn(PrimaryField), rs.GetColumn(spec.VectorField)
+	if rs.ResultCount > 0 && (ids == nil || vectors == nil) {
+		return nil, fmt.Errorf("query %s: ids or vectors missing from the result", collection)
+	}
+	docs := make([]Document, 0, rs.ResultCount)
+	for idx := 0; idx < rs.ResultCount; idx++ {
+		idVal, err := ids.Get(idx)
+		if err != nil {
+			return nil, fmt.Errorf("result %d: get id: %w", idx, err)
+		}
+		id, ok := idVal.(int64)
+		if !ok {
+			return nil, fmt.Errorf("result %d: unexpected id type %T", idx, idVal)
+		}
+		vecVal, err := vectors.Get(idx)
+		if err != nil {
+			return nil, fmt.Errorf("result %d: get vector: %w", idx, err)
+		}
+		vec, ok := vecVal.(entity.FloatVector)
+		if !ok {
+			return nil, fmt.Errorf("result %d: unexpected vector type %T", idx, vecVal)
+		}
+		doc := Document{ID: id, Vector: []float32(vec), Fields: make(map[string]any, len(spec.Fields))}
+		for _, name := range spec.FieldNames() {
+			col := rs.GetColumn(name)
+			if col == nil {
+				continue
+			}
+			v, err := col.Get(idx)
+			if err != nil {
+				return nil, fmt.Errorf("result %d: decode %s: %w", idx, name, err)
+			}
+			doc.Fields[name] = v
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+func (m *Milvus) Flush(ctx context.Context, collection string) error {
+	flushTask, err := m.cli.Flush(ctx, milvusclient.NewFlushOption(collection))
+	if err != nil {
+		return fmt.Errorf("flush %s: %w", collection, err)
+	}
+	if err := flushTask.Await(ctx); err != nil {
+		return fmt.Errorf("await flush %s: %w", collection, err)
+	}
+	return nil
+}
+
+// Count queries count(*) with strong consistency, so rows written before the
+// call are included.
+func (m *Milvus) Count(ctx context.Context, collection string) (int, error) {
+	rs, err := m.cli.Query(ctx, milvusclient.NewQueryOption(collection).
+		WithOutputFields("count(*)").
+		WithConsistencyLevel(entity.ClStrong))
+	if err != nil {
+		return 0, fmt.Errorf("count %s: %w", collection, err)
+	}
+	col := rs.GetColumn("count(*)")
+	if col == nil || col.Len() == 0 {
+		return 0, fmt.Errorf("count %s: empty result", collection)
+	}
+	v, err := col.Get(0)
+	if err != nil {
+		return 0, fmt.Errorf("count %s: %w", collection, err)
+	}
+	n, ok := v.(int64)
+	if !ok {
+		return 0, fmt.Errorf("count %s: unexpected type %T", collection, v)
+	}
+	return int(n), nil
+}
+
+func (m *Milvus) ListCollections(ctx context.Context) ([]string, error) {
+	names, err := m.cli.ListCollections(ctx, milvusclient.NewListCollectionOption())
+	if err != nil {
+		return nil, fmt.Errorf("list collections: %w", err)
+	}
+	return names, nil
+}
+
+func (m *Milvus) RenameCollection(ctx context.Context, collection, name string) error {
+	if err := m.cli.RenameCollection(ctx, milvusclient.NewRenameCollectionOption(collection, name)); err != nil {
+		if errors.Is(err, merr.ErrCollectionNotFound) {
+			return fmt.Errorf("%s: %w", collection, ErrCollectionNotFound)
+		}
+		return fmt.Errorf("rename collection %s to %s: %w", collection, name, err)
+	}
+	m.mu.Lock()
+	delete(m.specs, collection)
+	m.mu.Unlock()
+	return nil
+}
+
+// SetAlias creates the alias or alters it in place; Milvus switches an
+// altered alias atomically.
+func (m *Milvus) SetAlias(ctx context.Context, alias, collection string) error {
+	_, err := m.ResolveAlias(ctx, alias)
+	switch {
+	case errors.Is(err, ErrAliasNotFound):
+		if err := m.cli.CreateAlias(ctx, milvusclient.NewCreateAliasOption(collection, alias)); err != nil {
+			return fmt.Errorf("create alias %s for %s: %w", alias, collection, err)
+		}
+	case err != nil:
+		return err
+	default:
+		if err := m.cli.AlterAlias(ctx, milvusclient.NewAlterAliasOption(alias, collection)); err != nil {
+			return fmt.Errorf("alter alias %s to %s: %w", alias, collection, err)
+		}
+	}
+	// a spec cached under the alias describes the previous collection
+	m.mu.Lock()
+	delete(m.specs, alias)
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *Milvus) ResolveAlias(ctx context.Context, alias string) (string, error) {
+	a, err := m.cli.DescribeAlias(ctx, milvusclient.NewDescribeAliasOption(alias))
+	if errors.Is(err, merr.ErrAliasNotFound) {
+		return "", fmt.Errorf("%s: %w", alias, ErrAliasNotFound)
+	}
+	if err != nil {
+		return "", fmt.Errorf("describe alias %s: %w", alias, err)
+	}
+	return a.CollectionName, nil
+}
@@ -0,0 +1,325 @@
+// Package vectorstore hides the vector database behind a small interface so
+// ingestion, retrieval and the tools run against Milvus or an in-memory store.
+package vectorstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// PrimaryField is the int64 primary key of every collection.
+const PrimaryField = "id"
+
+var (
+	// ErrCollectionNotFound is returned when a collection does not exist.
+	ErrCollectionNotFound = errors.New("collection not found")
+	// ErrAliasNotFound is returned when an alias does not exist.
+	ErrAliasNotFound = errors.New("alias not found")
+	// ErrSchemaMismatch is returned when an existing collection does not match the expected spec.
+	ErrSchemaMismatch = errors.New("schema mismatch")
+)
+
+// FieldType is the type of a scalar field.
+type FieldType string
+
+const (
+	FieldInt32   FieldType = "int32"
+	FieldInt64   FieldType = "int64"
+	FieldDouble  FieldType = "double"
+	FieldVarChar FieldType = "varchar"
+	FieldBool    FieldType = "bool"
+)
+
+// Field is a scalar field stored next to the vector.
+type Field struct {
+	Name string
+	Type FieldType
+	// MaxLength is the maximum byte length of a varchar field.
+	MaxLength int
+}
+
+// CollectionSpec describes a collection: the int64 primary key "id", one
+// cosine-indexed float vector field and a set of scalar fields.
+type CollectionSpec struct {
+	Name        string
+	VectorField string
+	// Dim is the vector dimension. It may be 0 when ensuring a collection that
+	// must already exist.
+	Dim    int
+	Fields []Field
+	// Properties are stored with the collection when it is created, such as
+	// how its vectors were produced. Check does not compare them.
+	Properties map[string]string
+}
+
+// Field returns the scalar field called name. The primary key is reported as an int64 field.
+func (s CollectionSpec) Field(name string) (Field, bool) {
+	if name == PrimaryField {
+		return Field{Name: PrimaryField, Type: FieldInt64}, true
+	}
+	for _, f := range s.Fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+// FieldNames returns the names of the scalar fields in declaration order.
+func (s CollectionSpec) FieldNames() []string {
+	names := make([]string, len(s.Fields))
+	for i, f := range s.Fields {
+		names[i] = f.Name
+	}
+	return names
+}
+
+// Check reports every way existing differs from s: the vector field, the
+// dimension when s.Dim is set, and the type and length of each field of s.
+// Extra fields in existing are allowed. The error wraps ErrSchemaMismatch.
+func (s CollectionSpec) Check(existing CollectionSpec) error {
+	var errs []error
+	if s.VectorField != existing.VectorField {
+		errs = append(errs, fmt.Errorf("vector field is %s, want %s", existing.VectorField, s.VectorField))
+	}
+	if s.Dim > 0 && s.Dim != existing.Dim {
+		errs = append(errs, fmt.Errorf("dimension is %d, want %d", existing.Dim, s.Dim))
+	}
+	for _, want := range s.Fields {
+		got, ok := existing.Field(want.Name)
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Errorf("field %s is missing", want.Name))
+		case got.Type != want.Type:
+			errs = append(errs, fmt.Errorf("field %s is %s, want %s", want.Name, got.Type, want.Type))
+		case want.Type == FieldVarChar && got.MaxLength < want.MaxLength:
+			errs = append(errs, fmt.Errorf("field %s max length is %d, want at least %d", want.Name, got.MaxLength, want.MaxLength))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("collection %s: %w: %w", s.Name, ErrSchemaMismatch, errors.Join(errs...))
+	}
+	return nil
+}
+
+// clone copies the fields and properties so callers cannot mutate a cached spec.
+func (s CollectionSpec) clone() CollectionSpec {
+	s.Fields = append([]Field{}, s.Fields...)
+	if s.Properties != nil {
+		props := make(map[string]string, len(s.Properties))
+		for k, v := range s.Properties {
+			props[k] = v
+		}
+		s.Properties = props
+	}
+	return s
+}
+
+func (s CollectionSpec) validate() error {
+	if strings.TrimSpace(s.Name) == "" {
+		return fmt.Errorf("collection name is empty")
+	}
+	if strings.TrimSpace(s.VectorField) == "" {
+		return fmt.Errorf("collection %s: vector field is empty", s.Name)
+	}
+	if s.Dim < 0 {
+		return fmt.Errorf("collection %s: invalid dimension %d", s.Name, s.Dim)
+	}
+	return nil
+}
+
+// Document is one row to upsert.
+type Document struct {
+	ID     int64
+	Vector []float32
+	Fields map[string]any
+}
+
+// SearchRequest is a top-k cosine search. Filter conditions are ANDed.
+// OutputFields defaults to every scalar field.
+type SearchRequest struct {
+	Vector       []float32
+	TopK         int
+	Filter       Filter
+	OutputFields []string
+}
+
+// Hit is one search result. Score is the cosine similarity.
+type Hit struct {
+	ID     int64
+	Score  float64
+	Fields map[string]any
+}
+
+// String returns a field as a string, or "" when missing.
+func (h Hit) String(name string) string {
+	v, ok := h.Fields[name]
+	if !ok || v == nil {
+		return ""
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprint(v)
+}
+
+// Int returns a numeric field as an int, or 0 when missing.
+func (h Hit) Int(name string) int {
+	if n, ok := toInt64(h.Fields[name]); ok {
+		return int(n)
+	}
+	f, ok := toFloat64(h.Fields[name])
+	if !ok {
+		return 0
+	}
+	return int(f)
+}
+
+// Store is a vector database holding collections of documents.
+type Store interface {
+	// EnsureCollection creates the collection when it is missing and makes it
+	// ready for search. An existing collection is never modified; it is checked
+	// against spec and ErrSchemaMismatch is returned when it differs.
+	EnsureCollection(ctx context.Context, spec CollectionSpec) error
+	// Describe returns the spec of an existing collection or ErrCollectionNotFound.
+	Describe(ctx context.Context, collection string) (CollectionSpec, error)
+	// Upsert inserts or replaces documents by ID.
+	Upsert(ctx context.Context, collection string, docs []Document) error
+	// Delete removes documents by ID. Unknown IDs are ignored.
+	Delete(ctx context.Context, collection string, ids []int64) error
+	// DeleteWhere removes every document matching filter, which must not be empty.
+	DeleteWhere(ctx context.Context, collection string, filter Filter) error
+	// Search returns the TopK documents most similar to the request vector.
+	Search(ctx context.Context, collection string, req SearchRequest) ([]Hit, error)
+	// Query returns every document matching filter, vectors included, in no
+	// particular order. It is meant for lookups such as documents by id, so
+	// filter must not be empty.
+	Query(ctx context.Context, collection string, filter Filter) ([]Document, error)
+	// Flush persists pending writes.
+	Flush(ctx context.Context, collection string) error
+	// Count returns the number of documents in a collection.
+	Count(ctx context.Context, collection string) (int, error)
+	// ListCollections returns the names of all collections.
+	ListCollections(ctx context.Context) ([]string, error)
+	// RenameCollection renames a collection, or returns ErrCollectionNotFound.
+	// name must not be taken by another collection or alias.
+	RenameCollection(ctx context.Context, collection, name string) error
+	// SetAlias points alias at collection, creating the alias when missing.
+	// Repointing is atomic for readers going through the alias.
+	SetAlias(ctx context.Context, alias, collection string) error
+	// ResolveAlias returns the collection alias points at or ErrAliasNotFound.
+	ResolveAlias(ctx context.Context, alias string) (string, error)
+}
+
+// convertValue coerces v to the Go type stored for field f:
+// int32, int64, float64, string or bool.
+func convertValue(f Field, v any) (any, error) {
+	switch f.Type {
+	case FieldInt32, FieldInt64:
+		n, ok := toInt64(v)
+		if !ok {
+			return nil, fmt.Errorf("field %s: want integer, got %T", f.Name, v)
+		}
+		if f.Type == FieldInt32 {
+			if n < math.MinInt32 || n > math.MaxInt32 {
+				return nil, fmt.Errorf("field %s: %v overflows int32", f.Name, v)
+			}
+			return int32(n), nil
+		}
+		return n, nil
+	case FieldDouble:
+		n, ok := toFloat64(v)
+		if !ok {
+			return nil, fmt.Errorf("field %s: want number, got %T", f.Name, v)
+		}
+		return n, nil
+	case FieldVarChar:
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("field %s: want string, got %T", f.Name, v)
+		}
+		if f.MaxLength > 0 && len(s) > f.MaxLength {
+			return nil, fmt.Errorf("field %s: %d bytes exceeds max length %d", f.Name, len(s), f.MaxLength)
+		}
+		return s, nil
+	case FieldBool:
+		b, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("field %s: want bool, got %T", f.Name, v)
+		}
+		return b, nil
+	default:
+		return nil, fmt.Errorf("field %s: unsupported type %q", f.Name, f.Type)
+	}
+}
+
+func toFloat64(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	default:
+		return 0, false
+	}
+}
+
+// toInt64 converts integers exactly, without a detour through float64 that
+// loses precision above 2^53. Floats convert only when they hold an integer
+// within range.
+func toInt64(v any) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int8:
+		return int64(n), true
+	case int16:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case uint:
+		return int64(n), uint64(n) <= math.MaxInt64
+	case uint32:
+		return int64(n), true
+	case uint64:
+		return int64(n), n <= math.MaxInt64
+	case float32:
+		return floatToInt64(float64(n))
+	case float64:
+		return floatToInt64(n)
+	default:
+		return 0, false
+	}
+}
+
+func floatToInt64(f float64) (int64, bool) {
+	if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+		return 0, false
+	}
+	return int64(f), true
+}
+
+func isNumeric(t FieldType) bool {
+	return t == FieldInt32 || t == FieldInt64 || t == FieldDouble
+}